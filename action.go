@@ -46,6 +46,7 @@ type parameterDefinition struct {
 	optional     bool
 	infinite     bool
 	literal      bool
+	record       *recordType
 }
 
 // actionArgument is a varValue value used to define collected argument values by the parser.
@@ -88,8 +89,10 @@ type actionDefinition struct {
 	appendParams       map[string]any // appendParams allows for adding additional parameters not based on the provided arguments without affecting automatic handling.
 	appendParamsFunc   paramsFunc     // appendParamsFunc allows for adding additional parameters based on the provided arguments without disabling automatic handling.
 	decomp             func(action *ShortcutAction) (arguments []string)
+	decompMatch        func(parameters map[string]any) bool // decompMatch determines if an action with parameters can be decompiled as this action, for actions that share an identifier with actions in an include.
 	appIntent          appIntent
 	outputType         tokenType
+	outputRecord       *recordType
 	defaultAction      bool // Default action for this identifier during decompilation.
 	macOnly            bool
 	nonMacOnly         bool
@@ -408,6 +411,13 @@ func realVariableValue(identifier string, lastValueType tokenType) (variableValu
 	return
 }
 
+// coercedType returns the type a variable reference is coerced to using a type suffix (e.g. @variable.text).
+func coercedType(coerce string) (valueType tokenType, coerced bool) {
+	valueType = tokenType(coerce)
+	coerced = slices.Contains([]tokenType{String, Integer, Float, Bool, Dict, Arr, Date}, valueType)
+	return
+}
+
 func checkTypeTransform(valueType tokenType) tokenType {
 	if valueType == Expression {
 		valueType = Integer
@@ -429,12 +439,15 @@ func typeCheck(param *parameterDefinition, argument *actionArgument) {
 		var getVar = realVariableValue(identifier, String)
 		argValueType = checkTypeTransform(getVar.valueType)
 		argVal = getVar.value
+		if coercedValueType, coerced := coercedType(argument.value.(varValue).coerce); coerced {
+			argValueType = coercedValueType
+		}
 		if argValueType == Action {
 			validActionOutput(param, argVal)
 			return
 		}
 		if argValueType != param.validType && param.validType != Variable && getVar.variableType != Ask {
-			if argValueType == Date && param.validType == String {
+			if acceptsText(param.validType, argValueType) {
 				return
 			}
 			if argValueType == Float && param.validType == Integer {
@@ -452,12 +465,18 @@ func typeCheck(param *parameterDefinition, argument *actionArgument) {
 	case argValueType == Nil:
 	case argValueType == Reference:
 	case param.validType == String && argument.valueType == RawString:
+	case (param.validType == Date || param.validType == Regex) && (argValueType == String || argValueType == RawString):
 	case argValueType != param.validType:
 		if argValueType == Float && param.validType == Integer {
 			return
 		}
-		if argValueType == String {
+		switch argValueType {
+		case String:
 			argVal = "\"" + argVal.(string) + "\""
+		case Date:
+			argVal = "d\"" + argVal.(string) + "\""
+		case Regex:
+			argVal = "/" + argVal.(string) + "/"
 		}
 		parserError(fmt.Sprintf("Invalid value %v (%s) for argument '%s' (%s).\n%s",
 			argVal,
@@ -469,6 +488,12 @@ func typeCheck(param *parameterDefinition, argument *actionArgument) {
 	}
 }
 
+// acceptsText checks if a parameter of validType accepts a variable or action output of valueType, dates and patterns are text in Shortcuts.
+func acceptsText(validType tokenType, valueType tokenType) bool {
+	var textTypes = []tokenType{String, Date, Regex}
+	return slices.Contains(textTypes, validType) && slices.Contains(textTypes, valueType)
+}
+
 // validActionOutput checks the output of an action in the case that the output has been assigned to a variable.
 func validActionOutput(param *parameterDefinition, value any) {
 	var actionIdent = value.(action).ident
@@ -478,7 +503,7 @@ func validActionOutput(param *parameterDefinition, value any) {
 			return
 		}
 		if actionOutputType != param.validType && param.validType != Variable {
-			if actionOutputType == Date && param.validType == String {
+			if acceptsText(param.validType, actionOutputType) {
 				return
 			}
 			parserError(fmt.Sprintf("Invalid variable value of action '%v' (%s) for argument '%s' (%s).\n%s",
@@ -531,6 +556,17 @@ func checkArg(param *parameterDefinition, argument *actionArgument) {
 
 	typeCheck(param, argument)
 
+	if argument.valueType == Quantity && param.enum != "" {
+		checkQuantityUnit(param, argument)
+	}
+	if param.validType == Regex {
+		checkRegexArgument(argument)
+	}
+
+	if param.record != nil {
+		checkRecordArgument(param, argument)
+	}
+
 	questionArg(param, argument)
 
 	if param.literal {
@@ -895,7 +931,7 @@ func collectDefinedAction() {
 
 	var m = collectActionPrefixModifiers()
 
-	var identifier, arguments, outputType = collectActionDefinition('\n')
+	var identifier, arguments, outputType, outputRecord = collectActionDefinition('\n')
 	if m.shortIdentifier == "" {
 		m.shortIdentifier = strings.ToLower(identifier)
 	}
@@ -911,6 +947,7 @@ func collectDefinedAction() {
 		overrideIdentifier: m.overrideIdentifier,
 		parameters:         arguments,
 		outputType:         outputType,
+		outputRecord:       outputRecord,
 		appendParams:       setParams,
 		defaultAction:      defaultAction,
 		macOnly:            m.macOnly,
@@ -1052,7 +1089,7 @@ func collectVersionLimitsDefinition() (minVersion float64, maxVersion float64) {
 	return minVersion, maxVersion
 }
 
-func collectActionDefinition(until rune) (identifier string, arguments []parameterDefinition, outputType tokenType) {
+func collectActionDefinition(until rune) (identifier string, arguments []parameterDefinition, outputType tokenType, outputRecord *recordType) {
 	identifier = collectIdentifier()
 	if _, found := functions[identifier]; found {
 		parserError(fmt.Sprintf("Duplicate declaration of function '%s()'", identifier))
@@ -1071,8 +1108,10 @@ func collectActionDefinition(until rune) (identifier string, arguments []paramet
 
 	if tokenAhead(Colon) {
 		skipWhitespace()
-		var value any
-		collectType(&outputType, &value, until)
+		if outputRecord = collectRecordType(&outputType); outputRecord == nil {
+			var value any
+			collectType(&outputType, &value, until)
+		}
 	}
 
 	return
@@ -1108,8 +1147,11 @@ func collectParameterDefinitions() (arguments []parameterDefinition) {
 
 		var quantity bool
 		var enumeration = collectEnumerationType(&valueType, &quantity, ' ')
+		var record *recordType
 		if enumeration == "" {
-			collectType(&valueType, &value, ' ')
+			if record = collectRecordType(&valueType); record == nil {
+				collectType(&valueType, &value, ' ')
+			}
 		}
 
 		var literal bool
@@ -1170,6 +1212,7 @@ func collectParameterDefinitions() (arguments []parameterDefinition) {
 			qty:          quantity,
 			ref:          acceptsRef,
 			literal:      literal,
+			record:       record,
 		})
 
 		skipWhitespace()
@@ -7,6 +7,7 @@ package main
 import (
 	"encoding/base64"
 	"fmt"
+	"maps"
 	"os"
 	"reflect"
 	"regexp"
@@ -14,7 +15,6 @@ import (
 	"strings"
 
 	"github.com/electrikmilk/args-parser"
-	"github.com/google/uuid"
 )
 
 const SetVariableIdentifier = "is.workflow.actions.setvariable"
@@ -543,12 +543,33 @@ var actions = map[string]*actionDefinition{
 			if textArg.valueType == Variable {
 				args[1] = actionArgument{
 					valueType: String,
-					value:     fmt.Sprintf("^{%s}", textArg.value),
+					value:     fmt.Sprintf("^{%s}", makeVariableReferenceString(textArg.value.(varValue))),
 				}
 			} else {
 				args[1].value = fmt.Sprintf("^%s", textArg.value)
 			}
 		},
+		decomp: func(action *ShortcutAction) (arguments []string) {
+			arguments = append(arguments,
+				decompValue(action.WFWorkflowActionParameters["text"]),
+				strings.Replace(decompValue(action.WFWorkflowActionParameters["WFMatchTextPattern"]), "^", "", 1),
+			)
+			if caseSensitive, set := action.WFWorkflowActionParameters["WFMatchTextCaseSensitive"].(bool); set && !caseSensitive {
+				arguments = append(arguments, "false")
+			}
+
+			return
+		},
+		decompMatch: func(parameters map[string]any) bool {
+			var pattern = parameters["WFMatchTextPattern"]
+			if textPattern, isText := pattern.(map[string]interface{}); isText {
+				var value, _ = textPattern["Value"].(map[string]interface{})
+				pattern = value["string"]
+			}
+			var patternString, _ = pattern.(string)
+
+			return strings.HasPrefix(patternString, "^")
+		},
 	},
 	"getFileFromFolder": {
 		doc: selfDoc{
@@ -603,6 +624,12 @@ var actions = map[string]*actionDefinition{
 				},
 			}
 		},
+		decompMatch: func(parameters map[string]any) bool {
+			var file, _ = parameters["WFFile"].(map[string]interface{})
+			var _, hasLocation = file["fileLocation"]
+
+			return hasLocation
+		},
 	},
 	"splitText": {
 		doc: selfDoc{
@@ -1031,31 +1058,27 @@ var actions = map[string]*actionDefinition{
 				}
 			}
 
-			if args[0].valueType == Variable {
-				params["WFSecondaryAppIdentifier"] = argumentValue(args, 0)
+			if args[1].valueType == Variable {
+				params["WFSecondaryAppIdentifier"] = argumentValue(args, 1)
 			} else {
 				params["WFSecondaryAppIdentifier"] = map[string]any{
-					"BundleIdentifier": argumentValue(args, 0),
+					"BundleIdentifier": argumentValue(args, 1),
 				}
 			}
 
 			return params
 		},
 		decomp: func(action *ShortcutAction) (arguments []string) {
-			var splitRatio = decompValue(action.WFWorkflowActionParameters["WFAppRatio"])
+			arguments = append(arguments, decompAppAction("WFPrimaryAppIdentifier", action)...)
+			arguments = append(arguments, decompAppAction("WFSecondaryAppIdentifier", action)...)
 
-			var ratio = "half"
-			switch splitRatio {
+			switch action.WFWorkflowActionParameters["WFAppRatio"] {
 			case "½ + ½":
-				ratio = "half"
+				arguments = append(arguments, "\"half\"")
 			case "⅓ + ⅔":
-				ratio = "thirdByTwo"
+				arguments = append(arguments, "\"thirdByTwo\"")
 			}
 
-			arguments = append(arguments, fmt.Sprintf("\"%s\"", ratio))
-			arguments = append(arguments, decompAppAction("WFPrimaryAppIdentifier", action)...)
-			arguments = append(arguments, decompAppAction("WFSecondaryAppIdentifier", action)...)
-
 			return
 		},
 	},
@@ -1083,8 +1106,11 @@ var actions = map[string]*actionDefinition{
 		decomp: func(action *ShortcutAction) (arguments []string) {
 			if action.WFWorkflowActionParameters["target"] != nil {
 				var workflow = action.WFWorkflowActionParameters["target"].(map[string]interface{})
-				var title = workflow["title"].(map[string]interface{})
-				arguments = append(arguments, decompValue(title["key"]))
+				if title, localized := workflow["title"].(map[string]interface{}); localized {
+					arguments = append(arguments, decompValue(title["key"]))
+				} else {
+					arguments = append(arguments, decompValue(workflow["title"]))
+				}
 			}
 			return
 		},
@@ -1110,9 +1136,10 @@ var actions = map[string]*actionDefinition{
 				}
 			}
 
+			var identifierSalt = "workflowIdentifier"
 			return map[string]any{
 				"WFWorkflow": map[string]any{
-					"workflowIdentifier": uuid.New().String(),
+					"workflowIdentifier": createUUID(&identifierSalt),
 					"isSelf":             true,
 					"workflowName":       workflowName,
 				},
@@ -1121,6 +1148,8 @@ var actions = map[string]*actionDefinition{
 		decomp: func(action *ShortcutAction) (arguments []string) {
 			if action.WFWorkflowActionParameters["WFInput"] != nil {
 				arguments = append(arguments, decompValue(action.WFWorkflowActionParameters["WFInput"]))
+			} else {
+				arguments = append(arguments, "nil")
 			}
 			return
 		},
@@ -1159,6 +1188,12 @@ var actions = map[string]*actionDefinition{
 				if reflect.TypeOf(item).String() != "string" {
 					itemValue = item.(map[string]interface{})["WFValue"]
 				}
+				// Items that are not text, such as the dictionaries of an embedded file, are wrapped in another value.
+				if value, isValue := itemValue.(map[string]interface{}); isValue {
+					if wrapped, isWrapped := value["Value"].(map[string]interface{}); isWrapped && wrapped["Value"] != nil {
+						itemValue = wrapped
+					}
+				}
 				arguments = append(arguments, decompValue(itemValue))
 			}
 			return
@@ -1776,6 +1811,49 @@ var actions = map[string]*actionDefinition{
 				},
 			}
 		},
+		decomp: func(action *ShortcutAction) (arguments []string) {
+			arguments = append(arguments, decompValue(action.WFWorkflowActionParameters["prompt"]))
+
+			var image = "nil"
+			if action.WFWorkflowActionParameters["image"] != nil {
+				image = decompValue(action.WFWorkflowActionParameters["image"])
+			}
+			var style, hasStyle = action.WFWorkflowActionParameters["style"].(map[string]interface{})
+			var saveToPlayground, hasSaveToPlayground = action.WFWorkflowActionParameters["saveToPlayground"]
+			if !hasStyle && !hasSaveToPlayground {
+				if image != "nil" {
+					arguments = append(arguments, image)
+				}
+				return
+			}
+			arguments = append(arguments, image)
+
+			if hasStyle {
+				switch style["identifier"] {
+				case "z_external_provider":
+					arguments = append(arguments, "\"chatgpt\"")
+				case "z_external_provider_1":
+					arguments = append(arguments, "\"chatgpt_oil_painting\"")
+				case "z_external_provider_2":
+					arguments = append(arguments, "\"chatgpt_watercolor\"")
+				case "z_external_provider_3":
+					arguments = append(arguments, "\"chatgpt_vector\"")
+				case "z_external_provider_4":
+					arguments = append(arguments, "\"chatgpt_anime\"")
+				case "z_external_provider_5":
+					arguments = append(arguments, "\"chatgpt_print\"")
+				default:
+					arguments = append(arguments, decompValue(style["identifier"]))
+				}
+			} else {
+				arguments = append(arguments, "nil")
+			}
+			if hasSaveToPlayground {
+				arguments = append(arguments, decompValue(saveToPlayground))
+			}
+
+			return
+		},
 	},
 }
 
@@ -1891,9 +1969,7 @@ func includeStandardActions() {
 func checkMissingStandardInclude(identifier *string, parsing bool) {
 	if !parsing && !args.Using("no-toolkit") {
 		connectToolkitDB()
-		var identifiers = strings.Split(*identifier, ".")
-		identifiers = append(identifiers[:3], identifiers[4:]...)
-		var baseIdentifier = strings.Join(identifiers, ".")
+		var baseIdentifier = toolkitIdentifier(*identifier)
 
 		var containerId, containerErr = getContainerIdByIdentifier(&baseIdentifier)
 		if containerErr == nil {
@@ -1910,10 +1986,12 @@ func checkMissingStandardInclude(identifier *string, parsing bool) {
 	}
 
 	for _, actionInclude := range actionIncludes {
-		if slices.Contains(included, fmt.Sprintf("actions/%s", actionInclude)) {
+		var includePath = fmt.Sprintf("actions/%s", actionInclude)
+		if slices.Contains(included, includePath) {
 			continue
 		}
-		lines = append([]string{fmt.Sprintf("#include 'actions/%s'\n", actionInclude)}, lines...)
+		var definedActions, definedEnumerations = maps.Clone(actions), maps.Clone(enumerations)
+		lines = append([]string{fmt.Sprintf("#include '%s'\n", includePath)}, lines...)
 		resetParse()
 		handleIncludes()
 		handleActionDefinitions()
@@ -1924,6 +2002,13 @@ func checkMissingStandardInclude(identifier *string, parsing bool) {
 
 		var name, nameErr = getActionNameByIdentifier(identifier)
 		if nameErr != nil {
+			if !parsing {
+				// The decompiled code will not include these actions, so they can't be matched by later actions.
+				actions, enumerations = definedActions, definedEnumerations
+				included = slices.DeleteFunc(included, func(path string) bool { return path == includePath })
+				identifierMap = nil
+				mapSplitActions()
+			}
 			continue
 		}
 
@@ -1938,6 +2023,44 @@ func checkMissingStandardInclude(identifier *string, parsing bool) {
 	return
 }
 
+// toolkitIdentifier returns the identifier of the app in the ToolKit database that defines the action with identifier.
+func toolkitIdentifier(identifier string) string {
+	var identifiers = strings.Split(identifier, ".")
+	if len(identifiers) < 4 {
+		return identifier
+	}
+	identifiers = append(identifiers[:3], identifiers[4:]...)
+
+	return strings.Join(identifiers, ".")
+}
+
+// includeSplitActions includes the standard actions that define another action with identifier,
+// for actions split between an action that is always defined and actions in an include.
+func includeSplitActions(identifier string) bool {
+	var quotedIdentifier = fmt.Sprintf("'%s'", strings.TrimPrefix(identifier, "is.workflow.actions."))
+	for _, actionInclude := range actionIncludes {
+		var includePath = fmt.Sprintf("actions/%s", actionInclude)
+		if slices.Contains(included, includePath) {
+			continue
+		}
+		var includeBytes, readErr = stdActions.ReadFile(includePath + ".cherri")
+		if readErr != nil || !strings.Contains(string(includeBytes), quotedIdentifier) {
+			continue
+		}
+
+		lines = append([]string{fmt.Sprintf("#include '%s'\n", includePath)}, lines...)
+		resetParse()
+		handleIncludes()
+		handleActionDefinitions()
+		mapSplitActions()
+		popLine(fmt.Sprintf("#include '%s'", includePath))
+
+		return true
+	}
+
+	return false
+}
+
 func getActionNameByIdentifier(identifier *string) (name string, err error) {
 	if actions[*identifier] == nil {
 		var actionName, found = findActionByIdentifier(identifier)
@@ -56,6 +56,31 @@ func init() {
 		Description:  "[BETA] Import Shortcut from an iCloud link or file path and convert to Cherri.",
 		ExpectsValue: true,
 	})
+	args.Register(args.Argument{
+		Name:         "import-split",
+		Description:  "Import into a package directory with a file included for each top-level comment, and each top-level menu item using --import-split=menus.",
+		ExpectsValue: true,
+		Values:       []string{"comments", "menus"},
+		DefaultValue: "comments",
+	})
+	args.Register(args.Argument{
+		Name:         "import-dir",
+		Description:  "Import every Shortcut in a directory into a mirrored directory of Cherri files and print a summary.",
+		ExpectsValue: true,
+	})
+	args.Register(args.Argument{
+		Name:        "import-dedupe",
+		Description: "Replace repeated actions in an import with copy blocks or functions.",
+	})
+	args.Register(args.Argument{
+		Name:        "roundtrip",
+		Description: "Decompile the compiled Shortcut, compile it again and report the first action that differs.",
+	})
+	args.Register(args.Argument{
+		Name:         "coverage",
+		Description:  "Report the definitions matched by the actions used by a Shortcut or a directory of Shortcuts and their unmatched parameters.",
+		ExpectsValue: true,
+	})
 	args.Register(args.Argument{
 		Name:         "refs",
 		Description:  "Encode device content references from a Shortcut for re-use in Cherri code.",
@@ -125,12 +150,50 @@ func init() {
 		Name:        "skip-sign",
 		Description: "Do not sign the compiled Shortcut.",
 	})
+	args.Register(args.Argument{
+		Name:         "define",
+		Description:  "Define a flag for conditional compilation (e.g. --define NAME=value), can be used multiple times.",
+		ExpectsValue: true,
+	})
+	args.Register(args.Argument{
+		Name:        "redact",
+		Description: "Mask the values of secret environment variables in debug output.",
+	})
+	args.Register(args.Argument{
+		Name:         "locale",
+		Description:  "Only compile for the locale with this string table (e.g. --locale=de-DE).",
+		ExpectsValue: true,
+	})
+	args.Register(args.Argument{
+		Name:        "extract-strings",
+		Description: "List every string table key used by t(\"key\") and the locales it is missing from.",
+	})
+	args.Register(args.Argument{
+		Name:        "release",
+		Description: "Remove assertions, debug-only blocks and comment actions.",
+	})
+	args.Register(args.Argument{
+		Name:         "variant",
+		Description:  "Compile a build variant (e.g. --variant \"Mac:mac=true,version=17,color=blue,FLAG=value\"), can be used multiple times.",
+		ExpectsValue: true,
+	})
+	args.Register(args.Argument{
+		Name:         "build-variant",
+		Description:  "Only compile the build variant with this name.",
+		ExpectsValue: true,
+	})
 	args.Register(args.Argument{
 		Name:         "action",
 		Description:  "Search for available actions. Empty prints all definitions.",
 		DefaultValue: "",
 		ExpectsValue: true,
 	})
+	args.Register(args.Argument{
+		Name:         "methods",
+		Description:  "List actions that can be called as methods on a value of a type (e.g. @value.uppercase()).",
+		DefaultValue: "",
+		ExpectsValue: true,
+	})
 	args.Register(args.Argument{
 		Name:         "glyph",
 		Description:  "Search for available glyphs.",
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Assertions
+
+assert <condition>, "message" is replaced with a conditional that stops the Shortcut with the message,
+the file and the line of the assertion if the condition is not met.
+
+Using --release, assertions, the statement or block after a // debug-only comment and comment actions are removed.
+Removed lines are replaced with empty lines so that line numbers in errors are preserved.
+
+*/
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/electrikmilk/args-parser"
+)
+
+var assertRegex = regexp.MustCompile(`^(\s*)assert(?:\s+(.*?))?\s*$`)
+var assertMessageRegex = regexp.MustCompile(`^(.+?)\s*,\s*("(?:[^"\\]|\\.)*")$`)
+
+const debugOnlyComment = "// debug-only"
+
+func handleAssertions() {
+	if !strings.Contains(contents, "assert") && !strings.Contains(contents, debugOnlyComment) {
+		return
+	}
+
+	parseAssertions()
+	resetParse()
+}
+
+func parseAssertions() {
+	for i := 0; i < len(lines); i++ {
+		if args.Using("release") && strings.TrimSpace(lines[i]) == debugOnlyComment {
+			i = removeDebugOnly(i)
+			continue
+		}
+
+		var matches = assertRegex.FindStringSubmatch(lines[i])
+		if matches == nil {
+			continue
+		}
+		if args.Using("release") {
+			lines[i] = ""
+			continue
+		}
+
+		lineIdx = i
+		lineCharIdx = len(matches[1])
+		lines[i] = matches[1] + makeAssertion(matches[2])
+	}
+}
+
+// makeAssertion makes a conditional that stops the Shortcut with a message if condition is not met.
+func makeAssertion(assertion string) string {
+	if assertion == "" {
+		parserError("Expected condition for assertion.")
+	}
+
+	var condition = assertion
+	var message = stringLiteral(assertion)
+	if matches := assertMessageRegex.FindStringSubmatch(assertion); matches != nil {
+		condition, message = matches[1], matches[2]
+	}
+
+	var filename, line, _ = delinquentFile()
+	var failure = fmt.Sprintf(`"Assertion failed: %s (%s:%d)"`, message[1:len(message)-1], filename, line)
+
+	return fmt.Sprintf("if %s {} else { mustOutput(%s, %s) }", condition, failure, failure)
+}
+
+// removeDebugOnly removes the debug-only comment on line start and the statement or block after it, returns the last line removed.
+// Nothing after the comment is removed if it is the last line of the block it is in.
+func removeDebugOnly(start int) int {
+	lines[start] = ""
+
+	var depth int
+	for i := start + 1; i < len(lines); i++ {
+		var line = lines[i]
+		if depth == 0 && strings.TrimSpace(line) == "" {
+			continue
+		}
+		if depth == 0 && (blockDepthChange(line) < 0 || strings.HasPrefix(strings.TrimSpace(line), "}")) {
+			return i - 1
+		}
+
+		lines[i] = ""
+		depth += blockDepthChange(line)
+		if depth <= 0 {
+			return i
+		}
+	}
+
+	return len(lines) - 1
+}
+
+// blockDepthChange returns the number of blocks opened minus the number of blocks closed on line, ignoring strings and comments.
+func blockDepthChange(line string) (change int) {
+	var lineChars = []rune(line)
+	for i := 0; i < len(lineChars); i++ {
+		switch lineChars[i] {
+		case '"', '\'':
+			i = quotedStringEnd(lineChars, i+1, lineChars[i]) - 1
+		case '/':
+			if i+1 < len(lineChars) && lineChars[i+1] == '/' {
+				return
+			}
+		case '{':
+			change++
+		case '}':
+			change--
+		}
+	}
+
+	return
+}
@@ -5,13 +5,21 @@
 package main
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"maps"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/electrikmilk/args-parser"
+	"howett.net/plist"
 )
 
 var currentTest string
@@ -107,6 +115,7 @@ func TestPackages(t *testing.T) {
 }
 
 func TestDecomp(t *testing.T) {
+	resetActions()
 	defer resetParser()
 
 	fmt.Println("Decompiling...")
@@ -167,10 +176,676 @@ func TestRoundTrip(t *testing.T) {
 	}
 }
 
+func TestDecompDefinitions(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+
+	currentTest = "tests/definitions.cherri"
+	os.Args[1] = currentTest
+
+	compile()
+
+	var compiled, marshalErr = plist.Marshal(shortcut, plist.XMLFormat)
+	handle(marshalErr)
+	resetParser()
+	defer resetParser()
+
+	args.Args["output"] = os.DevNull
+	decompile(compiled)
+	delete(args.Args, "output")
+
+	var expected = []string{
+		"#define inputs image, text",
+		"#define outputs app, file",
+		"#define from menubar, sleepmode, onscreen, quickactions",
+		"#define quickactions finder, services",
+		"#define noinput getclipboard",
+	}
+	for _, definition := range expected {
+		if !strings.Contains(code.String(), definition+"\n") {
+			t.Errorf("Expected decompiled definition %q, got:\n%s", definition, code.String())
+		}
+	}
+}
+
+func TestDecompFunctions(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+	// Grouping identifiers derived from the same names must not be paired across statements.
+	args.Args["derive-uuids"] = ""
+
+	currentTest = "tests/functions.cherri"
+	os.Args[1] = currentTest
+
+	compile()
+	delete(args.Args, "derive-uuids")
+
+	var compiled, marshalErr = plist.Marshal(shortcut, plist.XMLFormat)
+	handle(marshalErr)
+	resetParser()
+	defer resetParser()
+
+	var decompiledPath = filepath.Join(t.TempDir(), "functions.cherri")
+	args.Args["output"] = decompiledPath
+	decompile(compiled)
+	delete(args.Args, "output")
+
+	var expected = []string{
+		"function fibonacci(number n): text {",
+		"function processBool(bool condition) {",
+		"\toutput(\"{@condition}\")",
+		"@boolVar = true",
+		"\t\tconst fib1 = fibonacci(minusOne)",
+		"function greetDefault(text name, text salutation = \"Hello\"): text {",
+		"function processArray(array items) {",
+		"function processVariable(variable val) {",
+		"const fib = fibonacci(7)",
+		"const pair = formatPair(@pairLabel, @pairCount)",
+		"const overriddenGreet = greetDefault(\"World\", \"Hi\")",
+		"const arrResult = processArray(@arrVar)",
+	}
+	for _, line := range expected {
+		if !strings.Contains(code.String(), line+"\n") {
+			t.Errorf("Expected decompiled line %q, got:\n%s", line, code.String())
+		}
+	}
+	if strings.Contains(code.String(), "_cherri_") {
+		t.Errorf("Expected functions header and calls to be removed, got:\n%s", code.String())
+	}
+
+	// The decompiled code must compile again.
+	resetParser()
+	currentTest = decompiledPath
+	os.Args[1] = decompiledPath
+	compile()
+	if len(shortcut.WFWorkflowActions) == 0 {
+		t.Errorf("Expected decompiled functions to compile, got:\n%s", code.String())
+	}
+}
+
+func TestDecompRepeats(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+
+	currentTest = "tests/repeated-actions.cherri"
+	os.Args[1] = currentTest
+
+	compile()
+
+	var compiled, marshalErr = plist.Marshal(shortcut, plist.XMLFormat)
+	handle(marshalErr)
+	resetParser()
+	defer resetParser()
+
+	args.Args["output"] = os.DevNull
+	args.Args["import-dedupe"] = ""
+	decompile(compiled)
+	delete(args.Args, "output")
+	delete(args.Args, "import-dedupe")
+
+	var expected = []string{
+		"function block1(number value1, text value2) {",
+		"\twait(@value1)",
+		"\tshowNotification(@value2, \"App\")",
+		"block1(2, \"Starting\")",
+		"block1(4, \"Restarting\")",
+		"copy block2 {",
+		"\twait(1)",
+		"paste block2",
+	}
+	for _, line := range expected {
+		if !strings.Contains(code.String(), line+"\n") {
+			t.Errorf("Expected decompiled line %q, got:\n%s", line, code.String())
+		}
+	}
+	if strings.Count(code.String(), "paste block2\n") != 2 {
+		t.Errorf("Expected copy block to be pasted twice, got:\n%s", code.String())
+	}
+}
+
+func TestDecompTypes(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+
+	currentTest = "tests/typed-variables.cherri"
+	os.Args[1] = currentTest
+
+	compile()
+
+	var compiled, marshalErr = plist.Marshal(shortcut, plist.XMLFormat)
+	handle(marshalErr)
+	resetParser()
+	defer resetParser()
+
+	args.Args["output"] = os.DevNull
+	decompile(compiled)
+	delete(args.Args, "output")
+
+	var expected = []string{
+		"@input = ShortcutInput",
+		"@copied: number = @number",
+		"@copiedText: text = @text",
+		"@coerced: number = ShortcutInput.number",
+		"@seconds: number = @coerced",
+	}
+	for _, line := range expected {
+		if !strings.Contains(code.String(), line+"\n") {
+			t.Errorf("Expected decompiled line %q, got:\n%s", line, code.String())
+		}
+	}
+}
+
+func TestDecompReferences(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	resetActions()
+	defer resetParser()
+
+	var file = map[string]any{
+		"displayName": "Notes.txt",
+		"filename":    "Notes.txt",
+		"fileLocation": map[string]any{
+			"WFFileLocationType":   "iCloud",
+			"fileProviderDomainID": "com.apple.CloudDocsFileProvider",
+			"relativeSubpath":      "Notes.txt",
+		},
+	}
+	var song = map[string]any{
+		"persistentIdentifier": uint64(18446744073709551557),
+		"itemName":             "Song",
+		"type":                 "song",
+	}
+	var workflow, marshalErr = plist.Marshal(Shortcut{WFWorkflowActions: []ShortcutAction{
+		{
+			WFWorkflowActionIdentifier: "is.workflow.actions.documentpicker.open",
+			WFWorkflowActionParameters: map[string]any{"WFGetFilePath": "notes", "WFFile": file},
+		},
+		{
+			WFWorkflowActionIdentifier: "is.workflow.actions.file.reveal",
+			WFWorkflowActionParameters: map[string]any{"WFFile": file},
+		},
+		{
+			WFWorkflowActionIdentifier: "is.workflow.actions.playmusic",
+			WFWorkflowActionParameters: map[string]any{"WFMediaItems": song},
+		},
+	}}, plist.XMLFormat)
+	handle(marshalErr)
+
+	args.Args["output"] = os.DevNull
+	decompile(workflow)
+	delete(args.Args, "output")
+
+	var expected = []string{
+		"getFile(\"notes\", Notestxt)",
+		"reveal(Notestxt)",
+		"playMusic(Song)",
+	}
+	for _, line := range expected {
+		if !strings.Contains(code.String(), line+"\n") {
+			t.Errorf("Expected decompiled line %q, got:\n%s", line, code.String())
+		}
+	}
+	if strings.Count(code.String(), "#ref ") != 2 {
+		t.Errorf("Expected a reference for the file and the song, got:\n%s", code.String())
+	}
+
+	var ref = extractedReference{value: song}
+	var decoded, decodeErr = decodeReferenceHash(makeReferenceHash(&ref))
+	if decodeErr != nil {
+		t.Fatal(decodeErr)
+	}
+	if decoded["persistentIdentifier"] != song["persistentIdentifier"] {
+		t.Errorf("Expected persistent identifier %v, got %v", song["persistentIdentifier"], decoded["persistentIdentifier"])
+	}
+}
+
+func TestSignedShortcut(t *testing.T) {
+	args.Args["no-ansi"] = ""
+
+	var workflow, marshalErr = plist.Marshal(map[string]any{"WFWorkflowActions": []any{}}, plist.BinaryFormat)
+	handle(marshalErr)
+
+	var path = []byte(signedShortcutFile)
+	var entry = []byte("AA01\x00\x00TYP1FPATP")
+	entry = binary.LittleEndian.AppendUint16(entry, uint16(len(path)))
+	entry = append(entry, path...)
+	entry = append(entry, "DATB"...)
+	entry = binary.LittleEndian.AppendUint32(entry, uint32(len(workflow)))
+	binary.LittleEndian.PutUint16(entry[4:], uint16(len(entry)))
+	var archive = append(entry, workflow...)
+
+	var segment = []byte(lzfseUncompressedMagic)
+	segment = binary.LittleEndian.AppendUint32(segment, uint32(len(archive)))
+	segment = append(segment, archive...)
+	segment = append(segment, lzfseEndOfStreamMagic...)
+
+	var signed = signedArchive(archive, segment)
+	if !hasSignedBytes(signed) {
+		t.Fatal("Expected archive to be detected as a signed Shortcut")
+	}
+	if !bytes.Equal(readSignedShortcut(signed), workflow) {
+		t.Error("Expected Shortcut extracted from signed archive to match the unsigned Shortcut")
+	}
+}
+
+// The compressed streams in tests/lzfse were made with an encoder written separately from the decoder,
+// following the LZFSE reference format. archive.aar is an Apple Archive of the Shortcut in tests/hello-world.cherri.
+var lzfseFixtures = map[string]string{
+	"archive.lzvn.lzfse": "archive.aar",
+	"archive.v2.lzfse":   "archive.aar",
+	"text.lzvn.lzfse":    "text.txt",
+	"text.v2.lzfse":      "text.txt",
+	"text.mixed.lzfse":   "text.txt",
+}
+
+func TestLZFSE(t *testing.T) {
+	for compressedFile, expectedFile := range lzfseFixtures {
+		var compressed, readErr = os.ReadFile(filepath.Join("tests", "lzfse", compressedFile))
+		handle(readErr)
+		var expected, expectedErr = os.ReadFile(filepath.Join("tests", "lzfse", expectedFile))
+		handle(expectedErr)
+
+		var contents, read, decompressErr = lzfseDecompress(compressed)
+		if decompressErr != nil {
+			t.Errorf("%s: %s", compressedFile, decompressErr)
+			continue
+		}
+		if !bytes.Equal(contents, expected) {
+			t.Errorf("%s: Expected contents of %s", compressedFile, expectedFile)
+		}
+		if read != len(compressed) {
+			t.Errorf("%s: Expected to read %d bytes, read %d", compressedFile, len(compressed), read)
+		}
+
+		var padded = append(slices.Clone(compressed), "trailing data"...)
+		if _, read, _ := lzfseDecompress(padded); read != len(compressed) {
+			t.Errorf("%s: Expected data after the end of stream to be ignored, read %d bytes", compressedFile, read)
+		}
+
+		for _, size := range []int{4, 12, 40, len(compressed) / 2, len(compressed) - 4} {
+			if _, _, truncatedErr := lzfseDecompress(compressed[:size]); truncatedErr == nil {
+				t.Errorf("%s: Expected an error when truncated to %d bytes", compressedFile, size)
+			}
+		}
+
+		var corrupted = slices.Clone(compressed)
+		binary.LittleEndian.PutUint32(corrupted[4:], uint32(len(expected)+1))
+		if _, _, corruptErr := lzfseDecompress(corrupted); corruptErr == nil {
+			t.Errorf("%s: Expected an error when the size of a block is wrong", compressedFile)
+		}
+		for i := 8; i < len(compressed); i += 7 {
+			corrupted = slices.Clone(compressed)
+			corrupted[i] ^= 0xff
+			_, _, _ = lzfseDecompress(corrupted)
+		}
+	}
+}
+
+func FuzzLZFSE(f *testing.F) {
+	for compressedFile := range lzfseFixtures {
+		var compressed, readErr = os.ReadFile(filepath.Join("tests", "lzfse", compressedFile))
+		handle(readErr)
+		f.Add(compressed)
+	}
+	f.Add([]byte(lzfseEndOfStreamMagic))
+
+	f.Fuzz(func(t *testing.T, src []byte) {
+		var contents, read, decompressErr = lzfseDecompress(src)
+		if decompressErr != nil {
+			if contents != nil || read != 0 {
+				t.Errorf("Expected no contents when decompressing fails, got %d bytes and read %d", len(contents), read)
+			}
+			return
+		}
+		if read < 4 || read > len(src) {
+			t.Fatalf("Expected to read between 4 and %d bytes, read %d", len(src), read)
+		}
+		if again, _, againErr := lzfseDecompress(src[:read]); againErr != nil || !bytes.Equal(again, contents) {
+			t.Errorf("Expected the %d bytes read to decompress to the same contents", read)
+		}
+	})
+}
+
+func TestSignedShortcutCompressed(t *testing.T) {
+	args.Args["no-ansi"] = ""
+
+	var archive, readErr = os.ReadFile("tests/lzfse/archive.aar")
+	handle(readErr)
+	var workflow = archive[binary.LittleEndian.Uint16(archive[4:]):]
+
+	for _, compressedFile := range []string{"archive.lzvn.lzfse", "archive.v2.lzfse"} {
+		var segment, segmentErr = os.ReadFile(filepath.Join("tests", "lzfse", compressedFile))
+		handle(segmentErr)
+
+		if !bytes.Equal(readSignedShortcut(signedArchive(archive, segment)), workflow) {
+			t.Errorf("Expected Shortcut extracted from signed archive with %s segment to match the unsigned Shortcut", compressedFile)
+		}
+	}
+}
+
+// signedArchive makes a signed archive with a single LZFSE segment of the Apple Archive archive.
+func signedArchive(archive []byte, segment []byte) []byte {
+	var authData, authErr = plist.Marshal(map[string]any{"SigningCertificateChain": []any{}}, plist.BinaryFormat)
+	handle(authErr)
+
+	var signed = []byte(aeaMagic)
+	signed = binary.LittleEndian.AppendUint32(signed, aeaSignedProfile)
+	signed = binary.LittleEndian.AppendUint32(signed, uint32(len(authData)))
+	signed = append(signed, authData...)
+	signed = append(signed, make([]byte, aeaSignatureSizes[0]+aeaSaltSize+aeaMACSize)...)
+	signed = binary.LittleEndian.AppendUint64(signed, uint64(len(archive)))
+	signed = binary.LittleEndian.AppendUint64(signed, 0)
+	signed = binary.LittleEndian.AppendUint32(signed, 1<<20)
+	signed = binary.LittleEndian.AppendUint32(signed, 1)
+	signed = append(signed, aeaLZFSECompression)
+	signed = append(signed, make([]byte, 23+aeaMACSize)...)
+	signed = binary.LittleEndian.AppendUint32(signed, uint32(len(archive)))
+	signed = binary.LittleEndian.AppendUint32(signed, uint32(len(segment)))
+	signed = append(signed, make([]byte, aeaSegmentHeaderSize-8+aeaMACSize*2)...)
+
+	return append(signed, segment...)
+}
+
+func TestImportSplit(t *testing.T) {
+	var decompiled = strings.Join([]string{
+		"#define name Split",
+		importSectionMarker + "Setup",
+		"// Setup",
+		"@count = 1",
+		importSectionEndMarker,
+		importSectionMarker + "Setup",
+		"menu \"Pick\" {",
+		"item \"Say Hello\":",
+		"\t" + importSectionMarker + "Say Hello",
+		"\talert(\"Hello\")",
+		"\t" + importSectionEndMarker,
+		"}",
+		"",
+	}, "\n")
+
+	var sections = splitImportSections(decompiled)
+	var expected = map[string]string{
+		"main.cherri":      "#define name Split\n#include 'setup.cherri'\n#include 'setup-2.cherri'",
+		"setup.cherri":     "// Setup\n@count = 1",
+		"setup-2.cherri":   "menu \"Pick\" {\nitem \"Say Hello\":\n\t#include 'say-hello.cherri'\n}",
+		"say-hello.cherri": "alert(\"Hello\")",
+	}
+	if len(sections) != len(expected) {
+		t.Fatalf("Expected %d sections, got %d", len(expected), len(sections))
+	}
+	for _, section := range sections {
+		if contents := strings.Join(section.lines, "\n"); contents != expected[section.filename] {
+			t.Errorf("Expected %s to contain:\n%s\ngot:\n%s", section.filename, expected[section.filename], contents)
+		}
+	}
+}
+
+func TestImportDir(t *testing.T) {
+	var dir = t.TempDir()
+	for _, path := range []string{"b.shortcut", "sub/a.plist", "notes.txt"} {
+		var mkdirErr = os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0755)
+		handle(mkdirErr)
+		var writeErr = os.WriteFile(filepath.Join(dir, path), []byte{}, 0600)
+		handle(writeErr)
+	}
+	if paths := shortcutPaths(dir); !slices.Equal(paths, []string{"b.shortcut", "sub/a.plist"}) {
+		t.Errorf("Expected Shortcut paths, got %v", paths)
+	}
+
+	var action = func(uuid string, text string) ShortcutAction {
+		return ShortcutAction{
+			WFWorkflowActionIdentifier: "is.workflow.actions.gettext",
+			WFWorkflowActionParameters: map[string]any{UUID: uuid, "WFTextActionText": text},
+		}
+	}
+	var showResult = func(uuid string) ShortcutAction {
+		return ShortcutAction{
+			WFWorkflowActionIdentifier: "is.workflow.actions.showresult",
+			WFWorkflowActionParameters: map[string]any{"Text": map[string]any{"OutputUUID": uuid, "OutputName": "Text"}},
+		}
+	}
+
+	var original = []ShortcutAction{action("A", "Hello"), showResult("A")}
+	if difference := actionsDifference(original, []ShortcutAction{action("B", "Hello"), showResult("B")}); difference != "" {
+		t.Errorf("Expected actions that only differ in UUIDs to be equivalent, got %s", difference)
+	}
+	var number = func(value any) []ShortcutAction {
+		return []ShortcutAction{{
+			WFWorkflowActionIdentifier: "is.workflow.actions.number",
+			WFWorkflowActionParameters: map[string]any{"WFNumberActionNumber": value},
+		}}
+	}
+	if difference := actionsDifference(number(uint64(5)), number(float64(5))); difference != "" {
+		t.Errorf("Expected numbers decoded as different types to be equivalent, got %s", difference)
+	}
+	if actionsDifference(original, []ShortcutAction{action("B", "Goodbye"), showResult("B")}) == "" {
+		t.Error("Expected actions with different parameters not to be equivalent")
+	}
+	if actionsDifference(original, []ShortcutAction{action("B", "Hello"), action("C", "Hello")}) == "" {
+		t.Error("Expected different actions not to be equivalent")
+	}
+}
+
+func TestRoundTripEquivalence(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+
+	var files, err = os.ReadDir("tests")
+	handle(err)
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".cherri") || file.Name() == "decomp-expected.cherri" || file.Name() == "decomp-me.cherri" {
+			continue
+		}
+		var path = fmt.Sprintf("tests/%s", file.Name())
+		t.Run(path, func(t *testing.T) {
+			if message, exits := roundTripExits[file.Name()]; exits {
+				expectExit(t, "TestRoundTripEquivalence/"+path, message, func() {
+					roundTripDifference(t, path)
+				})
+				return
+			}
+
+			var difference = roundTripDifference(t, path)
+			if expected, differs := roundTripDifferences[file.Name()]; differs {
+				if difference != expected {
+					t.Errorf("Expected round trip of %s to differ by %q, got %q", path, expected, difference)
+				}
+				return
+			}
+			if difference != "" {
+				t.Errorf("Round trip of %s differs: %s", path, difference)
+			}
+		})
+	}
+}
+
+// roundTripDifferences are the first differences of the test files that the decompiled code can't compile back into the same Shortcut,
+// as the Cherri code the decompiler writes can't express how the file was written.
+var roundTripDifferences = map[string]string{
+	// Constants are inlined, but a constant set to an embedded file is set by a text action.
+	"menus.cherri": "action 0 is is.workflow.actions.gettext, got is.workflow.actions.nothing",
+	// Raw actions can leave out the parameters an action always sets and give a variable where text is expected.
+	"raw-action.cherri":                 "action 0 (is.workflow.actions.alert) parameter WFAlertActionCancelButtonShown is missing, got true",
+	"raw-action-variable-values.cherri": "action 2 (is.workflow.actions.notification) parameter WFNotificationActionTitle.Value.Type is \"Variable\", got missing",
+}
+
+// roundTripExits are the errors the decompiled code of test files exits with when it is compiled.
+var roundTripExits = map[string]string{
+	// A list of dictionaries can only be embedded.
+	"embed.cherri": "(dictionary) for argument 'listItem' (text).",
+}
+
+// definedActions and definedEnumerations are the actions and enumerations defined before any actions are included.
+var definedActions = maps.Clone(actions)
+var definedEnumerations = maps.Clone(enumerations)
+
+// resetActions removes the actions and enumerations defined by includes and the file that was compiled.
+func resetActions() {
+	resetParser()
+	actions = maps.Clone(definedActions)
+	enumerations = maps.Clone(definedEnumerations)
+	includedBasicStandardActions = false
+}
+
+// roundTripDifference compiles the file at path, decompiles it and compiles the Cherri code again, then returns the first difference.
+// Flags set by other tests and actions included by other tests are cleared, so the result does not depend on the order tests run in,
+// and the decompiled code is compiled with only the actions it includes.
+func roundTripDifference(t *testing.T, path string) string {
+	delete(args.Args, "comments")
+	delete(args.Args, "release")
+	delete(args.Args, "import")
+	args.Args["derive-uuids"] = ""
+	defer delete(args.Args, "derive-uuids")
+
+	var testActions, testEnumerations, testBasicActions = actions, enumerations, includedBasicStandardActions
+	defer func() {
+		resetParser()
+		actions, enumerations, includedBasicStandardActions = testActions, testEnumerations, testBasicActions
+	}()
+
+	resetActions()
+	loadStandardActions()
+	resetParser()
+	currentTest = path
+	os.Args[1] = path
+	compile()
+
+	var compiled, marshalErr = plist.Marshal(shortcut, plist.BinaryFormat)
+	handle(marshalErr)
+	var original Shortcut
+	var _, unmarshalErr = plist.Unmarshal(compiled, &original)
+	handle(unmarshalErr)
+	resetActions()
+
+	var decompiledPath = filepath.Join(t.TempDir(), "decompiled.cherri")
+	args.Args["output"] = decompiledPath
+	args.Args["comments"] = ""
+	decompile(compiled)
+	delete(args.Args, "output")
+	delete(args.Args, "comments")
+	resetActions()
+
+	currentTest = decompiledPath
+	os.Args[1] = decompiledPath
+	compile()
+
+	var recompiled Shortcut
+	var recompiledBytes, recompiledErr = plist.Marshal(shortcut, plist.BinaryFormat)
+	handle(recompiledErr)
+	_, unmarshalErr = plist.Unmarshal(recompiledBytes, &recompiled)
+	handle(unmarshalErr)
+
+	return shortcutDifference(original, recompiled)
+}
+
+func TestShortcutDifference(t *testing.T) {
+	var text = func(uuid string, value any) ShortcutAction {
+		return ShortcutAction{
+			WFWorkflowActionIdentifier: "is.workflow.actions.gettext",
+			WFWorkflowActionParameters: map[string]any{UUID: uuid, "WFTextActionText": map[string]any{"Value": map[string]any{"string": value}}},
+		}
+	}
+	var number = func(value any) ShortcutAction {
+		return ShortcutAction{
+			WFWorkflowActionIdentifier: "is.workflow.actions.number",
+			WFWorkflowActionParameters: map[string]any{"WFNumberActionNumber": value},
+		}
+	}
+
+	var original = Shortcut{
+		WFWorkflowActions:                 []ShortcutAction{text("A", "Hello"), number(uint64(5))},
+		WFWorkflowInputContentItemClasses: []string{"WFStringContentItem", "WFImageContentItem"},
+	}
+	var same = Shortcut{
+		WFWorkflowActions:                 []ShortcutAction{text("B", "Hello"), number(int64(5))},
+		WFWorkflowInputContentItemClasses: []string{"WFImageContentItem", "WFStringContentItem"},
+	}
+	if difference := shortcutDifference(original, same); difference != "" {
+		t.Errorf("Expected no difference, got %s", difference)
+	}
+
+	var changed = Shortcut{WFWorkflowActions: []ShortcutAction{text("B", "Goodbye"), number(5)}}
+	var expected = "action 0 (is.workflow.actions.gettext) parameter WFTextActionText.Value.string is \"Hello\", got \"Goodbye\""
+	if difference := shortcutDifference(original, changed); difference != expected {
+		t.Errorf("Expected difference %q, got %q", expected, difference)
+	}
+
+	var missing = Shortcut{WFWorkflowActions: []ShortcutAction{text("B", "Hello")}}
+	expected = "action 1 (is.workflow.actions.number) is missing, got 1 actions instead of 2"
+	if difference := shortcutDifference(original, missing); difference != expected {
+		t.Errorf("Expected difference %q, got %q", expected, difference)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	args.Args["no-toolkit"] = ""
+	defer delete(args.Args, "no-toolkit")
+	resetParser()
+	defer resetParser()
+
+	loadBasicStandardActions()
+	mapSplitActions()
+
+	var covered = actionCoverageOf(&ShortcutAction{
+		WFWorkflowActionIdentifier: "is.workflow.actions.showresult",
+		WFWorkflowActionParameters: map[string]any{UUID: "A", "Text": "Hello", "WFUnknown": true},
+	})
+	if covered.source != coverageStandard || covered.name != "show" || !slices.Equal(covered.unmatched, []string{"WFUnknown"}) {
+		t.Errorf("Expected show() to match with unmatched parameter WFUnknown, got %+v", covered)
+	}
+
+	covered = actionCoverageOf(&ShortcutAction{
+		WFWorkflowActionIdentifier: "is.workflow.actions.alert",
+		WFWorkflowActionParameters: map[string]any{"WFAlertActionMessage": "Hello", "WFAlertActionCancelButtonShown": false},
+	})
+	if covered.source != coverageSplit || covered.params == 0 {
+		t.Errorf("Expected alert to match a split action with a score, got %+v", covered)
+	}
+
+	covered = actionCoverageOf(&ShortcutAction{
+		WFWorkflowActionIdentifier: "com.example.app.UnknownIntent",
+		WFWorkflowActionParameters: map[string]any{"target": "value"},
+	})
+	if covered.source != coverageRaw || !slices.Equal(covered.unmatched, []string{"target"}) {
+		t.Errorf("Expected unknown action to be raw with unmatched parameter target, got %+v", covered)
+	}
+
+	covered = actionCoverageOf(&ShortcutAction{WFWorkflowActionIdentifier: "is.workflow.actions.conditional"})
+	if covered.source != coverageSyntax || covered.name != "if" {
+		t.Errorf("Expected conditional to be decompiled as syntax, got %+v", covered)
+	}
+}
+
+func TestCoverageOpenApp(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+	args.Args["no-toolkit"] = ""
+	defer delete(args.Args, "no-toolkit")
+
+	currentTest = "tests/split-screen.cherri"
+	os.Args[1] = currentTest
+	compile()
+
+	var actions = shortcut.WFWorkflowActions
+	var openedApps int
+	for _, action := range actions {
+		var covered = actionCoverageOf(&action)
+		if covered.name == "openApp" {
+			openedApps++
+		}
+	}
+	resetParser()
+
+	if openedApps == 0 {
+		t.Error("Expected coverage of openApp() actions")
+	}
+}
+
 func TestActionIdentifiers(t *testing.T) {
 	args.Args["no-ansi"] = ""
 	args.Args["skip-sign"] = ""
+	resetActions()
 	loadStandardActions()
+	resetParser()
 
 	currentTest = "tests/zz-action-identifiers.cherri"
 	os.Args[1] = currentTest
@@ -203,6 +878,73 @@ func TestActionIdentifiers(t *testing.T) {
 	resetParser()
 }
 
+func TestRelease(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+	args.Args["comments"] = ""
+	defer delete(args.Args, "comments")
+
+	currentTest = "tests/assertions.cherri"
+	os.Args[1] = currentTest
+
+	compile()
+	if !containsAction(shortcut.WFWorkflowActions, "is.workflow.actions.conditional") {
+		t.Error("Expected assertions to be compiled into conditionals without --release")
+	}
+	resetParser()
+
+	args.Args["release"] = ""
+	defer delete(args.Args, "release")
+	compile()
+
+	var removed = []string{
+		"is.workflow.actions.conditional",
+		"is.workflow.actions.output",
+		"is.workflow.actions.alert",
+		"is.workflow.actions.comment",
+	}
+	for _, a := range shortcut.WFWorkflowActions {
+		if slices.Contains(removed, a.WFWorkflowActionIdentifier) {
+			t.Errorf("Expected %s to be removed from release build", a.WFWorkflowActionIdentifier)
+		}
+	}
+
+	var actions = shortcut.WFWorkflowActions
+	if len(actions) == 0 || actions[len(actions)-1].WFWorkflowActionIdentifier != "is.workflow.actions.showresult" {
+		t.Errorf("Expected release build to end with the final show action, got %v", actions)
+	}
+
+	resetParser()
+}
+
+func TestReleaseDebugOnlyEndOfBlock(t *testing.T) {
+	args.Args["release"] = ""
+	defer delete(args.Args, "release")
+	defer resetParser()
+
+	lines = []string{"if @count > 1 {", "    // debug-only", "}", "show(\"done\")"}
+	parseAssertions()
+
+	var expected = []string{"if @count > 1 {", "", "}", "show(\"done\")"}
+	if !slices.Equal(lines, expected) {
+		t.Errorf("Expected the end of the block to be kept, got %q", lines)
+	}
+
+	lines = []string{"if @count > 1 {", "    // debug-only", "    show(@count)", "} else {", "    show(\"one\")", "}"}
+	parseAssertions()
+
+	expected = []string{"if @count > 1 {", "", "", "} else {", "    show(\"one\")", "}"}
+	if !slices.Equal(lines, expected) {
+		t.Errorf("Expected only the statement after debug-only to be removed, got %q", lines)
+	}
+}
+
+func containsAction(actions []ShortcutAction, identifier string) bool {
+	return slices.ContainsFunc(actions, func(action ShortcutAction) bool {
+		return action.WFWorkflowActionIdentifier == identifier
+	})
+}
+
 func TestCapitalizeEmptyString(t *testing.T) {
 	if got := capitalize(""); got != "" {
 		t.Fatalf("expected empty string, got %q", got)
@@ -235,12 +977,17 @@ func resetParser() {
 	idx = 0
 	lineIdx = 0
 	lineCharIdx = -1
+	sourceLines = nil
+	sourceText = nil
 	controlFlowGroups = map[int]controlFlowGroup{}
 	groupingIdx = 0
 	variables = map[string]varValue{}
+	scopes = map[int]map[string]string{}
+	outOfScope = map[string]bool{}
+	scopedVariables = map[string]string{}
 	iconColor = -1263359489
 	iconGlyph = 61440
-	clientVersion = "900"
+	clientVersion = versions["26"]
 	iosVersion = 26.0
 	questions = map[string]*question{}
 	hasShortcutInputVariables = false
@@ -256,6 +1003,12 @@ func resetParser() {
 	menus = map[string][]varValue{}
 	uuids = map[string]string{}
 	functions = map[string]*function{}
+	records = map[string]*recordType{}
+	constants = map[string]*constantValue{}
+	envFile = nil
+	currentLocale = ""
+	currentVariant = nil
+	compileFlags = nil
 	shortcut = Shortcut{}
 	actionIndex = 0
 	code.Reset()
@@ -275,3 +1028,622 @@ func resetParser() {
 	repeatItemIndex = 1
 	repeatIndexDepth = 1
 }
+
+func TestRepeatEnumerateIndex(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+	defer resetParser()
+
+	var path = filepath.Join(t.TempDir(), "enumerate.cherri")
+	var contents = "@letters = [\"a\", \"b\"]\n" +
+		"repeat i for 2 {\n    for (idx, letter) in @letters {\n        show(\"{@i}{@idx}{@letter}\")\n    }\n}\n" +
+		"for (position, letter2) in @letters {\n    show(\"{@position}{@letter2}\")\n}\n"
+	var writeErr = os.WriteFile(path, []byte(contents), 0600)
+	handle(writeErr)
+
+	currentTest = path
+	os.Args[1] = path
+	compile()
+
+	var values = make(map[string]string)
+	for _, a := range shortcut.WFWorkflowActions {
+		var input, isAttachment = a.WFWorkflowActionParameters["WFInput"].(WFTextTokenAttachment)
+		if a.WFWorkflowActionIdentifier == SetVariableIdentifier && isAttachment {
+			values[a.WFWorkflowActionParameters["WFVariableName"].(string)] = input.Value.VariableName
+		}
+	}
+
+	var expected = map[string]string{
+		"i":        "Repeat Index",
+		"idx":      "Repeat Index 2",
+		"letter":   "Repeat Item",
+		"position": "Repeat Index",
+		"letter2":  "Repeat Item",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Expected @%s to be set to %q, got %q", name, value, values[name])
+		}
+	}
+}
+
+func TestRedactDebugOutput(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+	args.Args["debug"] = ""
+	args.Args["redact"] = ""
+	defer delete(args.Args, "debug")
+	defer delete(args.Args, "redact")
+	defer resetParser()
+
+	// Compile a copy so the processed file and plist written for debugging are not left in tests/.
+	var dir = t.TempDir()
+	for _, name := range []string{"env.cherri", ".env"} {
+		var contents, readErr = os.ReadFile(filepath.Join("tests", name))
+		handle(readErr)
+		handle(os.WriteFile(filepath.Join(dir, name), contents, 0600))
+	}
+
+	currentTest = filepath.Join(dir, "env.cherri")
+	os.Args[1] = currentTest
+	var output = captureStdout(t, compile)
+
+	var secret, found = envSecrets["CHERRI_TEST_API_KEY"]
+	if !found {
+		t.Fatal("Expected CHERRI_TEST_API_KEY to be a secret")
+	}
+	for _, form := range secretForms(secret) {
+		if strings.Contains(output, form) {
+			t.Errorf("Expected debug output to redact %q", form)
+		}
+	}
+	if !strings.Contains(output, "const apiKey = "+redactedSecret) {
+		t.Errorf("Expected debug output to list apiKey as %q", redactedSecret)
+	}
+}
+
+func TestEnvRawString(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+	defer resetParser()
+	t.Setenv("CHERRI_TEST_RAW", "replaced")
+
+	var path = filepath.Join(t.TempDir(), "raw.cherri")
+	var contents = "show('#env CHERRI_TEST_RAW env(\"CHERRI_TEST_RAW\")')\n"
+	handle(os.WriteFile(path, []byte(contents), 0600))
+
+	currentTest = path
+	os.Args[1] = path
+	compile()
+
+	var text = fmt.Sprintf("%v", shortcut.WFWorkflowActions[0].WFWorkflowActionParameters["Text"])
+	if text != `#env CHERRI_TEST_RAW env("CHERRI_TEST_RAW")` {
+		t.Errorf("Expected environment variables in a raw string to not be replaced, got %s", text)
+	}
+}
+
+func TestLocalesUnused(t *testing.T) {
+	var dir = t.TempDir()
+	handle(os.Mkdir(filepath.Join(dir, localesDirectory), 0755))
+	for _, locale := range []string{"en-US", "de-DE"} {
+		handle(os.WriteFile(filepath.Join(dir, localesDirectory, locale+".json"), []byte(`{"greeting": "Hello"}`), 0600))
+	}
+
+	var previousPath = filePath
+	defer func() { filePath = previousPath }()
+	filePath = filepath.Join(dir, "untranslated.cherri")
+	handle(os.WriteFile(filePath, []byte("show(\"Hello\")\n"), 0600))
+	if handleLocales() {
+		t.Error("Expected a file that does not use t() to not be compiled for each locale")
+	}
+
+	handle(os.WriteFile(filePath, []byte("show(t(\"greeting\"))\n"), 0600))
+	if !usesLocalization() {
+		t.Error("Expected a file that uses t() to be compiled for each locale")
+	}
+}
+
+// captureStdout returns what print writes to stdout.
+func captureStdout(t *testing.T, print func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var captured = make(chan string)
+	go func() {
+		var output bytes.Buffer
+		_, _ = output.ReadFrom(r)
+		captured <- output.String()
+	}()
+
+	defer func(v *os.File) { os.Stdout = v }(os.Stdout)
+	os.Stdout = w
+	print()
+	handle(w.Close())
+
+	return <-captured
+}
+
+func TestParseVariant(t *testing.T) {
+	var variant = parseVariant("Mac:suffix= (Mac),color=red,glyph=apple,mac=true,version=17,DEBUG=1,BETA")
+	if variant.Name != "Mac" || variant.Suffix != " (Mac)" || variant.Color != "red" || variant.Glyph != "apple" || variant.Version != "17" {
+		t.Errorf("Unexpected build variant: %+v", variant)
+	}
+	if variant.Mac == nil || !*variant.Mac {
+		t.Error("Expected mac to be true")
+	}
+
+	var expectedDefines = map[string]string{"DEBUG": "1", "BETA": "true"}
+	if !maps.Equal(variant.Defines, expectedDefines) {
+		t.Errorf("Expected flags %v, got %v", expectedDefines, variant.Defines)
+	}
+
+	var nameOnly = parseVariant(" Lite ")
+	if nameOnly.Name != "Lite" || nameOnly.Mac != nil || len(nameOnly.Defines) != 0 {
+		t.Errorf("Unexpected build variant: %+v", nameOnly)
+	}
+	if nameOnly.suffix() != " Lite" {
+		t.Errorf("Expected default suffix ' Lite', got %q", nameOnly.suffix())
+	}
+}
+
+func TestLoadBuildVariants(t *testing.T) {
+	t.Chdir(t.TempDir())
+	defer func(v []string) { os.Args = v }(os.Args)
+	defer func() { buildVariants = nil }()
+
+	var mac = true
+	var pkg = cherriPackage{
+		Name: "variants",
+		Variants: []buildVariant{
+			{Name: "Mac", Mac: &mac, Defines: map[string]string{"DESKTOP": "true"}},
+			{Name: "Pro", Suffix: "+", Color: "blue"},
+		},
+	}
+	var pkgPlist, marshalErr = plist.MarshalIndent(pkg, plist.XMLFormat, "\t")
+	handle(marshalErr)
+	handle(os.WriteFile("info.plist", pkgPlist, 0600))
+
+	os.Args = []string{os.Args[0], "app.cherri", "--variant", "Beta:BETA", "--variant=Lite:version=17"}
+	loadBuildVariants()
+
+	var names []string
+	for _, variant := range buildVariants {
+		names = append(names, variant.Name)
+	}
+	if !slices.Equal(names, []string{"Mac", "Pro", "Beta", "Lite"}) {
+		t.Fatalf("Expected variants [Mac Pro Beta Lite], got %v", names)
+	}
+	if buildVariants[0].Mac == nil || !*buildVariants[0].Mac || buildVariants[0].Defines["DESKTOP"] != "true" {
+		t.Errorf("Unexpected info.plist variant: %+v", buildVariants[0])
+	}
+	if buildVariants[1].suffix() != "+" || buildVariants[1].Color != "blue" {
+		t.Errorf("Unexpected info.plist variant: %+v", buildVariants[1])
+	}
+	if buildVariants[2].Defines["BETA"] != "true" {
+		t.Errorf("Expected BETA flag in variant Beta, got %v", buildVariants[2].Defines)
+	}
+	if buildVariants[3].Version != "17" {
+		t.Errorf("Expected version 17 in variant Lite, got %q", buildVariants[3].Version)
+	}
+}
+
+func TestBuildVariant(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+	args.Args["build-variant"] = "Mac"
+	defer delete(args.Args, "build-variant")
+	defer func(v []string) { os.Args = v }(os.Args)
+	defer func() { buildVariants = nil }()
+	defer resetParser()
+
+	var dir = t.TempDir()
+	var path = filepath.Join(dir, "app.cherri")
+	var contents = "#if mac\n@device = \"mac\"\n#else\n@device = \"mobile\"\n#endif\n#if DEBUG\n@debug = true\n#endif\nshow(\"{@device}\")\n"
+	handle(os.WriteFile(path, []byte(contents), 0600))
+
+	currentTest = path
+	os.Args = []string{os.Args[0], path, "--variant", "Mac:mac=true,DEBUG", "--variant", "Phone:suffix=-phone"}
+	compile()
+
+	if workflowName != "app Mac" {
+		t.Errorf("Expected name 'app Mac', got %q", workflowName)
+	}
+	if _, statErr := os.Stat(filepath.Join(dir, "app Mac"+unsignedEnd)); statErr != nil {
+		t.Errorf("Expected variant to be written with its suffix: %s", statErr)
+	}
+
+	var setVariables = make(map[string]any)
+	for _, a := range shortcut.WFWorkflowActions {
+		if a.WFWorkflowActionIdentifier == SetVariableIdentifier {
+			setVariables[a.WFWorkflowActionParameters["WFVariableName"].(string)] = true
+		}
+	}
+	if definitions["mac"] != true {
+		t.Error("Expected mac definition of variant to be applied")
+	}
+	if setVariables["debug"] == nil {
+		t.Error("Expected DEBUG flag of variant to be defined")
+	}
+
+	args.Args["output"] = filepath.Join(dir, "out.shortcut")
+	defer delete(args.Args, "output")
+	if output := getOutputPath(workflowName + ".shortcut"); output != filepath.Join(dir, "out Mac.shortcut") {
+		t.Errorf("Expected output path with variant suffix, got %q", output)
+	}
+}
+
+func TestDecompConstants(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+	defer resetParser()
+
+	var path = filepath.Join(t.TempDir(), "constants.cherri")
+	var contents = "const greeting = \"Hello\"\n@a = greeting\n@b = getListItem(greeting, 1)\n@c = count(greeting)\nshow(greeting)\n" +
+		"if @a == \"x\" {\n    const inner = \"World\"\n    @d = getListItem(inner, 1)\n}\n@e = \"World\"\n" +
+		"const limit = 10\n@f = getListItem(limit, 1)\n@g = 10\nconst separator = \",\"\n@h = getListItem(separator, 1)\n@i = \",\"\n" +
+		"const first = \"Same value\"\nconst second = \"Same value\"\n@j = getListItem(first, 1)\n@k = getListItem(second, 1)\n@l = \"Same value\"\n"
+	var writeErr = os.WriteFile(path, []byte(contents), 0600)
+	handle(writeErr)
+
+	currentTest = path
+	os.Args[1] = path
+	compile()
+
+	var compiled, marshalErr = plist.Marshal(shortcut, plist.XMLFormat)
+	handle(marshalErr)
+	resetParser()
+
+	args.Args["output"] = os.DevNull
+	decompile(compiled)
+	delete(args.Args, "output")
+
+	var expected = []string{
+		"const greeting = \"Hello\"",
+		"@a = greeting",
+		"@b = getListItem(greeting, 1)",
+		"show(greeting)",
+		"@e = \"World\"",
+		"@f = getListItem(limit, 1)",
+		"@g = 10\n",
+		"@i = \",\"",
+		"@j = getListItem(first, 1)",
+		"@l = \"Same value\"",
+	}
+	for _, line := range expected {
+		if !strings.Contains(code.String(), line) {
+			t.Errorf("Expected decompiled line %q, got:\n%s", line, code.String())
+		}
+	}
+
+	if difference := roundTripDifference(t, path); difference != "" {
+		t.Errorf("Expected decompiled constants to compile to the same Shortcut: %s", difference)
+	}
+}
+
+func TestFoldExpressions(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+	defer resetParser()
+
+	var path = filepath.Join(t.TempDir(), "expressions.cherri")
+	var contents = "const total = 2 * (3 + 4)\n@calculated = 2 * 3\n@folded = total + 1\nshow(\"{@calculated} {@folded}\")\n"
+	handle(os.WriteFile(path, []byte(contents), 0600))
+
+	currentTest = path
+	os.Args[1] = path
+	compile()
+
+	var calculations []string
+	for _, a := range shortcut.WFWorkflowActions {
+		if a.WFWorkflowActionIdentifier == "is.workflow.actions.math" || a.WFWorkflowActionIdentifier == "is.workflow.actions.calculateexpression" {
+			calculations = append(calculations, fmt.Sprintf("%v", a.WFWorkflowActionParameters))
+		}
+	}
+	if len(calculations) != 1 {
+		t.Errorf("Expected only the expression without a constant operand to be calculated by the Shortcut, got %v", calculations)
+	}
+	if constant, found := constants["total"]; !found || constant.value != 14 {
+		t.Errorf("Expected the expression of a constant to be evaluated at compile time, got %v", constants["total"])
+	}
+}
+
+func TestDecompScopedVariables(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+	defer resetParser()
+
+	var path = filepath.Join(t.TempDir(), "scoped.cherri")
+	var contents = "@i = \"outer\"\n@x__2 = \"user\"\n@flag = \"yes\"\nif @flag == \"yes\" {\n    let i = \"inner\"\n    @x__2 = \"{@i}!\"\n    show(\"i: {@i}\")\n}\nshow(\"{@i} {@x__2}\")\n"
+	var writeErr = os.WriteFile(path, []byte(contents), 0600)
+	handle(writeErr)
+
+	currentTest = path
+	os.Args[1] = path
+	compile()
+
+	var setVariables []string
+	for _, a := range shortcut.WFWorkflowActions {
+		if a.WFWorkflowActionIdentifier == SetVariableIdentifier {
+			setVariables = append(setVariables, a.WFWorkflowActionParameters["WFVariableName"].(string))
+		}
+	}
+	if !slices.Contains(setVariables, "i"+scopedVariableSeparator+"2") {
+		t.Errorf("Expected let i to be renamed to 'i%s2', got %v", scopedVariableSeparator, setVariables)
+	}
+
+	var compiled, marshalErr = plist.Marshal(shortcut, plist.XMLFormat)
+	handle(marshalErr)
+	resetParser()
+
+	args.Args["output"] = os.DevNull
+	decompile(compiled)
+	delete(args.Args, "output")
+
+	var expected = []string{
+		"@x__2 = \"user\"",
+		"let i = \"inner\"",
+		"@x__2 = \"{@i}!\"",
+		"show(\"{@i} {@x__2}\")",
+	}
+	for _, line := range expected {
+		if !strings.Contains(code.String(), line+"\n") {
+			t.Errorf("Expected decompiled line %q, got:\n%s", line, code.String())
+		}
+	}
+	if strings.Contains(code.String(), "let x") {
+		t.Errorf("Expected @x__2 not to be decompiled as a block-scoped variable, got:\n%s", code.String())
+	}
+
+	if difference := roundTripDifference(t, path); difference != "" {
+		t.Errorf("Expected decompiled block-scoped variables to compile to the same Shortcut: %s", difference)
+	}
+
+	// A variable named like a renamed block-scoped variable in the Shortcuts app is not a block-scoped variable.
+	contents = "@flag = \"yes\"\nif @flag == \"yes\" {\n    @item = \"inner\"\n}\nshow(\"{@item}\")\n"
+	writeErr = os.WriteFile(path, []byte(contents), 0600)
+	handle(writeErr)
+
+	resetParser()
+	currentTest = path
+	os.Args[1] = path
+	compile()
+
+	compiled, marshalErr = plist.Marshal(shortcut, plist.XMLFormat)
+	handle(marshalErr)
+	compiled = bytes.ReplaceAll(compiled, []byte("<string>item</string>"), []byte("<string>Item"+scopedVariableSeparator+"2</string>"))
+	resetParser()
+
+	var decompiledPath = filepath.Join(t.TempDir(), "decompiled.cherri")
+	args.Args["output"] = decompiledPath
+	decompile(compiled)
+	delete(args.Args, "output")
+
+	if strings.Contains(code.String(), "let ") {
+		t.Errorf("Expected a variable named in the Shortcuts app not to be decompiled as a block-scoped variable, got:\n%s", code.String())
+	}
+	for _, line := range []string{"@Item2 = \"inner\"", "show(@Item2)"} {
+		if !strings.Contains(code.String(), line+"\n") {
+			t.Errorf("Expected decompiled line %q, got:\n%s", line, code.String())
+		}
+	}
+
+	resetParser()
+	currentTest = decompiledPath
+	os.Args[1] = decompiledPath
+	compile()
+}
+
+func TestDecodeYAML(t *testing.T) {
+	var document = `# comment
+name: "Cherri # not a comment"
+template: "{name}"
+count: 2
+ratio: 1.5
+enabled: true
+missing: ~
+server:
+  ports: [80, 443]
+  1: numeric key
+users:
+  - name: Ana
+    roles: [admin, dev]
+literal: |
+  line one
+  line two
+`
+	var data = decodeEmbeddedFile("config.yaml", []byte(document))
+	var expected = map[string]interface{}{
+		"name":     "Cherri # not a comment",
+		"template": literalOpenBrace + "name" + literalCloseBrace,
+		"count":    float64(2),
+		"ratio":    1.5,
+		"enabled":  true,
+		"missing":  nil,
+		"server": map[string]interface{}{
+			"ports": []interface{}{float64(80), float64(443)},
+			"1":     "numeric key",
+		},
+		"users": []interface{}{
+			map[string]interface{}{"name": "Ana", "roles": []interface{}{"admin", "dev"}},
+		},
+		"literal": "line one\nline two\n",
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, data)
+	}
+
+	expectExit(t, "TestDecodeYAML", "Invalid YAML in embedded file 'malformed.yaml'", func() {
+		decodeEmbeddedFile("malformed.yaml", []byte("a: [1, 2\nb: 1"))
+	})
+}
+
+func TestDecodeCSV(t *testing.T) {
+	var contents = "name,quote,notes\nAna,\"Hello, \"\"world\"\"\",\"two\nlines\"\nBo,,{braces}\n"
+	var data = decodeEmbeddedFile("people.csv", []byte(contents))
+
+	var expected = []interface{}{
+		map[string]interface{}{"name": "Ana", "quote": "Hello, \"world\"", "notes": "two\nlines"},
+		map[string]interface{}{"name": "Bo", "quote": "", "notes": escapeBraces("{braces}")},
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, data)
+	}
+
+	if empty := decodeCSV("empty.csv", []byte("")); !reflect.DeepEqual(empty, []interface{}{}) {
+		t.Errorf("Expected an empty CSV file to be an empty array, got %#v", empty)
+	}
+
+	expectExit(t, "TestDecodeCSV", "Invalid CSV in embedded file 'malformed.csv'", func() {
+		decodeCSV("malformed.csv", []byte("name,quote\nAna,\"unterminated\n"))
+	})
+}
+
+// expectExit runs the test again in a new process to check that fn exits with the error message.
+func expectExit(t *testing.T, test string, message string, fn func()) {
+	if os.Getenv("CHERRI_TEST_EXIT") == test {
+		args.Args["no-ansi"] = ""
+		fn()
+		os.Exit(0)
+	}
+
+	var command = exec.Command(os.Args[0], "-test.run=^"+test+"$")
+	command.Env = append(os.Environ(), "CHERRI_TEST_EXIT="+test)
+	var output, runErr = command.CombinedOutput()
+	if runErr == nil || !strings.Contains(string(output), message) {
+		t.Errorf("Expected %s to exit with error %q, got:\n%s", test, message, output)
+	}
+}
+
+func TestEmbeddedData(t *testing.T) {
+	var data = decodeEmbeddedFile("config.json", []byte(`{"template": "{name}", "count": 2, "items": [{"id": 1}]}`))
+	var expected = map[string]interface{}{
+		"template": literalOpenBrace + "name" + literalCloseBrace,
+		"count":    float64(2),
+		"items":    []interface{}{map[string]interface{}{"id": float64(1)}},
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, data)
+	}
+	if unescaped := unescapeBraces(data.(map[string]interface{})["template"].(string)); unescaped != "{name}" {
+		t.Errorf("Expected escaped braces to be unescaped, got %q", unescaped)
+	}
+}
+
+func TestEmbeddedText(t *testing.T) {
+	resetParser()
+	defer resetParser()
+	variables["name"] = varValue{variableType: "Variable", valueType: String}
+
+	var script = "function greet() {\r\n  return `Hello, {@name}! {name}`;\r\n}\r\n"
+	var text = embeddedText("greet.js", script, false)
+	var expected = "function greet() " + literalOpenBrace + "\n  return `Hello, {@name}! " + literalOpenBrace + "name" + literalCloseBrace + "`;\n" + literalCloseBrace + "\n"
+	if text != expected {
+		t.Errorf("Expected %q, got %q", expected, text)
+	}
+	if unescaped := unescapeBraces(text); unescaped != strings.ReplaceAll(script, "\r\n", "\n") {
+		t.Errorf("Expected braces to be restored, got %q", unescaped)
+	}
+	if plain := unescapeBraces("no braces"); plain != "no braces" {
+		t.Errorf("Expected text without escaped braces to be unchanged, got %q", plain)
+	}
+}
+
+func TestMinifyJS(t *testing.T) {
+	var scripts = map[string]string{
+		"// comment\nvar a = 1; // trailing\n":                  "var a = 1;",
+		"/* block\n comment */\n\n    var b = 2;\n\n\tb++":      "var b = 2;\nb++",
+		"var url = \"https://example.com\"; // link":            "var url = \"https://example.com\";",
+		"var s = 'a /* not */ b';":                              "var s = 'a /* not */ b';",
+		"var t = `line // kept\n  ${a}`;":                       "var t = `line // kept\n${a}`;",
+		"var q = \"say \\\"hi\\\" // kept\";":                   "var q = \"say \\\"hi\\\" // kept\";",
+		"var re = /\\/\\/+/g; // regex":                         "var re = /\\/\\/+/g;",
+		"var quote = /\"/.test(s);":                             "var quote = /\"/.test(s);",
+		"var half = total / 2; // division\nvar x = a / b / c;": "var half = total / 2;\nvar x = a / b / c;",
+		"if (a) {\n    return;\n}\n":                            "if (a) {\nreturn;\n}",
+	}
+	for script, expected := range scripts {
+		if minified := minifyJS(script); minified != expected {
+			t.Errorf("Expected %q to be minified to %q, got %q", script, expected, minified)
+		}
+	}
+}
+
+func TestInactiveDefinitions(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+	defer resetParser()
+
+	var path = filepath.Join(t.TempDir(), "defines.cherri")
+	var contents = "#if UNDEFINED_FLAG\n#define mac true\n#define version 17\n#endif\n#if mac || version < 18\n@device = \"mac\"\n#else\n@device = \"mobile\"\n#endif\nshow(\"{@device}\")\n"
+	handle(os.WriteFile(path, []byte(contents), 0600))
+
+	currentTest = path
+	os.Args[1] = path
+	compile()
+
+	var compiled, marshalErr = plist.Marshal(shortcut, plist.XMLFormat)
+	handle(marshalErr)
+	if !bytes.Contains(compiled, []byte("mobile")) || bytes.Contains(compiled, []byte("<string>mac</string>")) {
+		t.Errorf("Expected definitions in an inactive region to have no effect, got:\n%s", compiled)
+	}
+	if definitions["mac"] == true {
+		t.Error("Expected mac definition in an inactive region not to be applied")
+	}
+}
+
+func TestErrorLine(t *testing.T) {
+	expectExit(t, "TestErrorLine", "Ending has no starting statement. (2:1)", func() {
+		var path = filepath.Join(t.TempDir(), "error.cherri")
+		handle(os.WriteFile(path, []byte("@a = 1\n}\n@b = 2\n}\n"), 0600))
+		args.Args["skip-sign"] = ""
+		os.Args[1] = path
+		compile()
+	})
+}
+
+func TestLambdaParameters(t *testing.T) {
+	args.Args["no-ansi"] = ""
+	args.Args["skip-sign"] = ""
+	defer resetParser()
+
+	var path = filepath.Join(t.TempDir(), "lambdas.cherri")
+	var contents = "@fruit = \"kept\"\n@fruits = list(\"a\", \"b\")\n@upper = map(@fruits, (fruit) => \"{fruit}!\")\nshow(\"{@fruit}\")\n"
+	handle(os.WriteFile(path, []byte(contents), 0600))
+
+	currentTest = path
+	os.Args[1] = path
+	compile()
+
+	var fruitSets int
+	for _, a := range shortcut.WFWorkflowActions {
+		if a.WFWorkflowActionIdentifier == SetVariableIdentifier && a.WFWorkflowActionParameters["WFVariableName"] == "fruit" {
+			fruitSets++
+		}
+	}
+	if fruitSets != 1 {
+		t.Errorf("Expected the lambda parameter not to set the variable 'fruit', it was set %d times", fruitSets)
+	}
+}
+
+func TestLambdaErrorLine(t *testing.T) {
+	expectExit(t, "TestLambdaErrorLine", "Value of type 'text' not allowed in expression (2:", func() {
+		var path = filepath.Join(t.TempDir(), "error.cherri")
+		handle(os.WriteFile(path, []byte("@numbers = [1, 2]\n@doubled = map(@numbers, (n) => \"{n}\" * 2)\n@a = 1\n"), 0600))
+		args.Args["skip-sign"] = ""
+		includedBasicStandardActions = true
+		os.Args[1] = path
+		compile()
+	})
+}
+
+func TestUnknownMethod(t *testing.T) {
+	expectExit(t, "TestUnknownMethod", "No method 'low()' for value of type 'text'.", func() {
+		var path = filepath.Join(t.TempDir(), "methods.cherri")
+		handle(os.WriteFile(path, []byte("#include 'actions/text'\n@text = \"Hello\"\n@lower = @text.low()\n"), 0600))
+		args.Args["skip-sign"] = ""
+		os.Args[1] = path
+		compile()
+	})
+}
@@ -0,0 +1,321 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Conditional Compilation
+
+#if, #else and #endif directives include or exclude regions of a file based on
+the mac definition, the target iOS version, flags defined using --define NAME=value
+and if a package is installed. Directive lines and the lines of inactive regions
+are replaced with empty lines so that line numbers in errors are preserved.
+A mac or version definition only applies to the directives after it, and a
+definition in an inactive region has no effect.
+
+*/
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/electrikmilk/args-parser"
+)
+
+// compileFlags are the flags defined using --define NAME=value.
+var compileFlags map[string]string
+
+var reservedCompileFlags = []string{"mac", "version", "package", "true", "false"}
+
+var directiveRegex = regexp.MustCompile(`(?m)^\s*#(?:if|else|endif)\b`)
+var conditionComparisonRegex = regexp.MustCompile(`^([A-Za-z_]\w*)\s*(==|!=|>=|<=|>|<)\s*(.+)$`)
+var conditionPackageRegex = regexp.MustCompile(`^package\s+'?([^']+?)'?$`)
+var targetDefinitionRegex = regexp.MustCompile(`^\s*#define (mac|version) (.+?)\s*$`)
+
+// targetDefinitions are the mac and version definitions in the included regions of the file up to the current directive.
+var targetDefinitions map[string]string
+
+// conditionalRegion is an #if directive that has not yet been closed by an #endif directive.
+type conditionalRegion struct {
+	line          int
+	parentActive  bool
+	conditionMet  bool
+	insideElse    bool
+	includeRegion bool
+}
+
+// handleConditionalCompilation evaluates #if directives and removes the regions of the file that are not included.
+func handleConditionalCompilation() {
+	if compileFlags == nil {
+		compileFlags = definedCompileFlags()
+	}
+	if !directiveRegex.MatchString(contents) {
+		return
+	}
+
+	parseConditionalDirectives()
+
+	if args.Using("debug") {
+		printConditionalCompilationDebug()
+	}
+}
+
+func parseConditionalDirectives() {
+	var regions []conditionalRegion
+	var active = true
+	targetDefinitions = make(map[string]string)
+	for i, line := range lines {
+		var directive = strings.TrimSpace(line)
+		switch {
+		case directive == "#if" || strings.HasPrefix(directive, "#if "):
+			var region = conditionalRegion{line: i, parentActive: active}
+			if active {
+				region.conditionMet = evaluateCondition(i, strings.TrimSpace(strings.TrimPrefix(directive, "#if")))
+			}
+			region.includeRegion = region.conditionMet
+			regions = append(regions, region)
+			active = region.parentActive && region.includeRegion
+		case directive == "#else":
+			if len(regions) == 0 {
+				directiveError(i, "#else without #if.")
+			}
+			var region = &regions[len(regions)-1]
+			if region.insideElse {
+				directiveError(i, "Multiple #else directives for #if.")
+			}
+			region.insideElse = true
+			region.includeRegion = !region.conditionMet
+			active = region.parentActive && region.includeRegion
+		case directive == "#endif":
+			if len(regions) == 0 {
+				directiveError(i, "#endif without #if.")
+			}
+			active = regions[len(regions)-1].parentActive
+			regions = regions[:len(regions)-1]
+		case active:
+			if matches := targetDefinitionRegex.FindStringSubmatch(line); matches != nil {
+				targetDefinitions[matches[1]] = matches[2]
+			}
+			continue
+		}
+
+		lines[i] = ""
+	}
+
+	if len(regions) != 0 {
+		directiveError(regions[len(regions)-1].line, "Expected #endif to close #if.")
+	}
+
+	resetParse()
+}
+
+// evaluateCondition evaluates the condition of an #if directive, conditions can be combined using && and ||.
+func evaluateCondition(line int, condition string) bool {
+	if condition == "" {
+		directiveError(line, "Expected condition for #if.")
+	}
+	for _, alternative := range strings.Split(condition, "||") {
+		var met = true
+		for _, term := range strings.Split(alternative, "&&") {
+			if !evaluateConditionTerm(line, strings.TrimSpace(term)) {
+				met = false
+				break
+			}
+		}
+		if met {
+			return true
+		}
+	}
+
+	return false
+}
+
+func evaluateConditionTerm(line int, term string) bool {
+	if negated, found := strings.CutPrefix(term, "!"); found {
+		return !evaluateConditionTerm(line, strings.TrimSpace(negated))
+	}
+
+	if matches := conditionPackageRegex.FindStringSubmatch(term); matches != nil {
+		return packagePresent(line, matches[1])
+	}
+
+	if matches := conditionComparisonRegex.FindStringSubmatch(term); matches != nil {
+		var identifier, operator, value = matches[1], matches[2], strings.Trim(strings.TrimSpace(matches[3]), "\"'")
+		if identifier == "version" {
+			return compareVersion(line, operator, value)
+		}
+
+		return compareConditionValue(line, operator, conditionValue(identifier), value)
+	}
+
+	switch term {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "mac":
+		return targetMac()
+	case "version":
+		directiveError(line, "Expected comparison for version condition (e.g. #if version >= 17).")
+	}
+
+	if !regexp.MustCompile(`^[A-Za-z_]\w*$`).MatchString(term) {
+		directiveError(line, fmt.Sprintf("Invalid condition '%s'.", term))
+	}
+
+	var value, defined = compileFlags[term]
+	return defined && value != "false" && value != "0"
+}
+
+func conditionValue(identifier string) string {
+	if identifier == "mac" {
+		return strconv.FormatBool(targetMac())
+	}
+
+	return compileFlags[identifier]
+}
+
+func compareConditionValue(line int, operator string, value string, compareValue string) bool {
+	switch operator {
+	case "==":
+		return value == compareValue
+	case "!=":
+		return value != compareValue
+	}
+
+	var number, numberErr = strconv.ParseFloat(value, 64)
+	var compareNumber, compareErr = strconv.ParseFloat(compareValue, 64)
+	if numberErr != nil || compareErr != nil {
+		directiveError(line, fmt.Sprintf("Cannot compare '%s' and '%s' using '%s', values must be numbers.", value, compareValue, operator))
+	}
+
+	return compareNumbers(operator, number, compareNumber)
+}
+
+func compareVersion(line int, operator string, version string) bool {
+	if _, found := versions[version]; !found {
+		var list = makeKeyList("Available versions:", versions, version)
+		directiveError(line, fmt.Sprintf("Invalid version '%s'\n\n%s", version, list))
+	}
+
+	var compareVersion, _ = strconv.ParseFloat(version, 64)
+
+	return compareNumbers(operator, targetVersion(), compareVersion)
+}
+
+func compareNumbers(operator string, number float64, compareNumber float64) bool {
+	switch operator {
+	case "==":
+		return number == compareNumber
+	case "!=":
+		return number != compareNumber
+	case ">=":
+		return number >= compareNumber
+	case "<=":
+		return number <= compareNumber
+	case ">":
+		return number > compareNumber
+	case "<":
+		return number < compareNumber
+	}
+
+	return false
+}
+
+// targetMac returns the value of the mac definition in the included lines before the current directive,
+// which has not yet been parsed at this stage.
+func targetMac() bool {
+	if currentVariant != nil && currentVariant.Mac != nil {
+		return *currentVariant.Mac
+	}
+
+	return targetDefinitions["mac"] == "true"
+}
+
+// targetVersion returns the value of the version definition in the included lines before the current directive,
+// which has not yet been parsed at this stage.
+func targetVersion() float64 {
+	if currentVariant != nil && currentVariant.Version != "" {
+		var version, _ = strconv.ParseFloat(currentVariant.Version, 64)
+		return version
+	}
+
+	var definedVersion, defined = targetDefinitions["version"]
+	if !defined {
+		return iosVersion
+	}
+
+	var version, parseErr = strconv.ParseFloat(definedVersion, 64)
+	if parseErr != nil {
+		return iosVersion
+	}
+
+	return version
+}
+
+func packagePresent(line int, signature string) bool {
+	var matches = pkgSignatureRegex.FindStringSubmatch(signature)
+	if matches == nil {
+		directiveError(line, fmt.Sprintf("Invalid package signature '%s', expected: @{author}/{package_name}", signature))
+	}
+
+	var pkg = cherriPackage{User: matches[3], Name: matches[4]}
+
+	return pkg.installed()
+}
+
+// definedCompileFlags collects flags passed using --define NAME=value, a flag without a value is defined as true.
+// Flags defined by the current build variant take precedence.
+func definedCompileFlags() map[string]string {
+	var flags = make(map[string]string)
+	for i := 1; i < len(os.Args); i++ {
+		var definition string
+		switch {
+		case os.Args[i] == "--define" && i+1 < len(os.Args):
+			i++
+			definition = os.Args[i]
+		case strings.HasPrefix(os.Args[i], "--define="):
+			definition = strings.TrimPrefix(os.Args[i], "--define=")
+		default:
+			continue
+		}
+
+		var name, value, hasValue = strings.Cut(definition, "=")
+		if !hasValue {
+			value = "true"
+		}
+		if slices.Contains(reservedCompileFlags, name) {
+			exit(fmt.Sprintf("Cannot define flag '%s', it is reserved.", name))
+		}
+
+		flags[name] = value
+	}
+	if currentVariant != nil {
+		maps.Copy(flags, currentVariant.Defines)
+	}
+
+	return flags
+}
+
+func directiveError(line int, message string) {
+	lineIdx = line
+	lineCharIdx = 0
+	parserError(message)
+}
+
+func printConditionalCompilationDebug() {
+	fmt.Println(ansi("### CONDITIONAL COMPILATION ###", bold))
+	fmt.Println("mac:", targetMac())
+	fmt.Println("version:", targetVersion())
+	for name, value := range compileFlags {
+		fmt.Printf("%s=%s\n", name, value)
+	}
+	fmt.Print("\n")
+}
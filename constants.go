@@ -0,0 +1,286 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Constant Folding
+
+Constants with a literal value, text built only from other constants and pure arithmetic are
+evaluated at compile time. References to them are replaced with their value in text, math
+and action arguments, and no action is generated for a constant if every reference was folded.
+Arithmetic is only evaluated at compile time when it is the value of a constant or one of its
+operands is a constant, other expressions are still calculated by the Shortcut.
+
+The names of constants that were folded completely are not in the Shortcut, so they can't be decompiled,
+but when a constant still has an action, the decompiler writes text literals equal to its value as references to it
+if the text is distinctive and no other constant has the same value.
+
+*/
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// constantValue is the value of a constant that was evaluated at compile time.
+type constantValue struct {
+	valueType tokenType
+	value     any
+	uses      int // uses is the number of references to the constant that could not be folded.
+}
+
+// constants is a map of the constants that were evaluated at compile time.
+var constants map[string]*constantValue
+
+var inlineConstantRegex = regexp.MustCompile(`\{@?([A-Za-z_]\w*)}`)
+
+// constantExpression is set when a constant operand is folded into the expression being collected.
+var constantExpression bool
+
+// declareConstant evaluates the value of a constant at compile time if it is a literal or can be folded into one.
+func declareConstant(identifier string, valueType *tokenType, value *any) {
+	switch *valueType {
+	case String:
+		var text = foldInlineConstants(fmt.Sprintf("%s", *value))
+		*value = text
+		if checkInlineVarRegex.MatchString(text) {
+			return
+		}
+	case Expression:
+		foldExpression(valueType, value)
+		if *valueType == Expression {
+			return
+		}
+	case RawString, Integer, Float:
+	default:
+		return
+	}
+
+	constants[identifier] = &constantValue{
+		valueType: *valueType,
+		value:     *value,
+	}
+}
+
+// useConstant counts a reference to a constant that has not been folded.
+func useConstant(identifier string) {
+	if constant, found := constants[identifier]; found {
+		constant.uses++
+	}
+}
+
+// foldedConstant checks if no action needs to be generated for the constant, as every reference to it was folded.
+func foldedConstant(identifier string) bool {
+	var constant, found = constants[identifier]
+	return found && constant.uses == 0
+}
+
+// foldConstantReference replaces a reference to a constant evaluated at compile time with its value,
+// if the value of the constant is one of the accepted types.
+func foldConstantReference(valueType *tokenType, value *any, acceptedTypes ...tokenType) bool {
+	if *valueType != Variable {
+		return false
+	}
+	var reference = (*value).(varValue)
+	if reference.getAs != "" || reference.coerce != "" {
+		return false
+	}
+	var constant, found = constants[reference.value.(string)]
+	if !found {
+		return false
+	}
+	if len(acceptedTypes) != 0 && !slices.Contains(acceptedTypes, constant.valueType) {
+		return false
+	}
+
+	constant.uses--
+	*valueType = constant.valueType
+	*value = constant.value
+
+	return true
+}
+
+// foldArgumentConstant replaces a reference to a constant with its value if it is a valid value for param.
+func foldArgumentConstant(param *parameterDefinition, argument *actionArgument) {
+	if param.ref || param.validType == Variable || argument.valueType != Variable {
+		return
+	}
+	var reference = argument.value.(varValue)
+	var constant, found = constants[reference.value.(string)]
+	if !found || !methodAcceptsType(param, constant.valueType, false) {
+		return
+	}
+
+	foldConstantReference(&argument.valueType, &argument.value)
+}
+
+// foldInlineConstants replaces inline references to constants evaluated at compile time with their value.
+func foldInlineConstants(text string) string {
+	if !strings.Contains(text, "{") {
+		return text
+	}
+
+	return inlineConstantRegex.ReplaceAllStringFunc(text, func(match string) string {
+		var identifier = inlineConstantRegex.FindStringSubmatch(match)[1]
+		if constant, found := constants[identifier]; found {
+			return constantText(constant)
+		}
+
+		return match
+	})
+}
+
+func constantText(constant *constantValue) string {
+	if float, ok := constant.value.(float64); ok {
+		return strconv.FormatFloat(float, 'f', -1, 64)
+	}
+	if constant.valueType == RawString {
+		return escapeBraces(fmt.Sprintf("%s", constant.value))
+	}
+
+	return fmt.Sprintf("%v", constant.value)
+}
+
+// constantOperand returns the value of a reference to a number constant to use as an operand of an expression.
+func constantOperand(reference varValue) (operand string, folded bool) {
+	var valueType tokenType = Variable
+	var value any = reference
+	if !foldConstantReference(&valueType, &value, Integer, Float) {
+		return "", false
+	}
+	constantExpression = true
+
+	return constantText(&constantValue{value: value}), true
+}
+
+// foldExpression evaluates an expression at compile time if all of its operands are numbers.
+// It is only used for the values of constants and expressions with a constant operand.
+func foldExpression(valueType *tokenType, value *any) {
+	var expression = fmt.Sprintf("%s", *value)
+	if strings.ContainsAny(expression, "{}") {
+		return
+	}
+
+	var evaluator = expressionEvaluator{chars: []rune(expression)}
+	var result, ok = evaluator.evaluate()
+	if !ok || math.IsInf(result, 0) || math.IsNaN(result) {
+		return
+	}
+
+	if result == math.Trunc(result) && math.Abs(result) < 1e15 {
+		*valueType = Integer
+		*value = int(result)
+		return
+	}
+
+	*valueType = Float
+	*value = result
+}
+
+// expressionEvaluator evaluates an arithmetic expression of numbers.
+type expressionEvaluator struct {
+	chars []rune
+	pos   int
+}
+
+func (e *expressionEvaluator) evaluate() (float64, bool) {
+	var result, ok = e.sum()
+	e.skipSpaces()
+	if !ok || e.pos != len(e.chars) {
+		return 0, false
+	}
+
+	return result, true
+}
+
+func (e *expressionEvaluator) sum() (float64, bool) {
+	var result, ok = e.product()
+	for ok {
+		e.skipSpaces()
+		if e.pos >= len(e.chars) || (e.chars[e.pos] != '+' && e.chars[e.pos] != '-') {
+			break
+		}
+		var operator = e.chars[e.pos]
+		e.pos++
+
+		var operand float64
+		operand, ok = e.product()
+		if operator == '+' {
+			result += operand
+		} else {
+			result -= operand
+		}
+	}
+
+	return result, ok
+}
+
+func (e *expressionEvaluator) product() (float64, bool) {
+	var result, ok = e.factor()
+	for ok {
+		e.skipSpaces()
+		if e.pos >= len(e.chars) || !strings.ContainsRune("*/%", e.chars[e.pos]) {
+			break
+		}
+		var operator = e.chars[e.pos]
+		e.pos++
+
+		var operand float64
+		operand, ok = e.factor()
+		switch operator {
+		case '*':
+			result *= operand
+		case '/':
+			result /= operand
+		case '%':
+			result = math.Mod(result, operand)
+		}
+	}
+
+	return result, ok
+}
+
+func (e *expressionEvaluator) factor() (float64, bool) {
+	e.skipSpaces()
+	if e.pos >= len(e.chars) {
+		return 0, false
+	}
+
+	switch e.chars[e.pos] {
+	case '-':
+		e.pos++
+		var result, ok = e.factor()
+		return -result, ok
+	case '(':
+		e.pos++
+		var result, ok = e.sum()
+		e.skipSpaces()
+		if !ok || e.pos >= len(e.chars) || e.chars[e.pos] != ')' {
+			return 0, false
+		}
+		e.pos++
+		return result, true
+	}
+
+	var start = e.pos
+	for e.pos < len(e.chars) && (unicode.IsDigit(e.chars[e.pos]) || e.chars[e.pos] == '.') {
+		e.pos++
+	}
+	var number, parseErr = strconv.ParseFloat(string(e.chars[start:e.pos]), 64)
+
+	return number, parseErr == nil
+}
+
+func (e *expressionEvaluator) skipSpaces() {
+	for e.pos < len(e.chars) && e.chars[e.pos] == ' ' {
+		e.pos++
+	}
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Decompile Coverage
+
+Using --coverage, every action identifier used by a Shortcut, or the Shortcuts in a directory, is matched against
+the standard actions, split actions and actions in the Shortcuts ToolKit database, the same way it would be when
+decompiled, and a report is printed of the action each matched, the match score of split actions and the parameters
+that are not defined by the action, so that definitions can be prioritised for the actions that would become raw actions.
+
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/electrikmilk/args-parser"
+)
+
+type coverageSource string
+
+const (
+	coverageRaw         coverageSource = "raw"
+	coverageUnsupported coverageSource = "unsupported"
+	coverageToolkit     coverageSource = "toolkit"
+	coverageSplit       coverageSource = "split"
+	coverageStandard    coverageSource = "standard"
+	coverageSyntax      coverageSource = "syntax"
+)
+
+// coverageSources are the sources of matches in the order they are reported in.
+var coverageSources = []coverageSource{coverageRaw, coverageUnsupported, coverageToolkit, coverageSplit, coverageStandard, coverageSyntax}
+
+// syntaxActions are the actions that are decompiled into Cherri syntax instead of an action call.
+var syntaxActions = map[string]string{
+	"is.workflow.actions.comment":             "comment",
+	"is.workflow.actions.gettext":             "text",
+	"is.workflow.actions.number":              "number",
+	"is.workflow.actions.dictionary":          "dictionary",
+	"is.workflow.actions.math":                "expression",
+	"is.workflow.actions.calculateexpression": "expression",
+	"is.workflow.actions.conditional":         "if",
+	"is.workflow.actions.repeat.count":        "repeat",
+	"is.workflow.actions.repeat.each":         "for",
+	"is.workflow.actions.choosefrommenu":      "menu",
+	SetVariableIdentifier:                     "variable",
+	AppendVariableIdentifier:                  "variable",
+}
+
+// coverageIgnoredParameters are parameters that do not need to be defined by an action.
+var coverageIgnoredParameters = []string{UUID, "CustomOutputName", "GroupingIdentifier", "WFControlFlowMode"}
+
+type actionCoverage struct {
+	identifier string
+	source     coverageSource
+	name       string
+	uses       int
+	params     uint
+	values     uint
+	unmatched  []string
+}
+
+// coverage prints a report of how the actions used by the Shortcut or directory of Shortcuts at path would be decompiled.
+func coverage(path string) {
+	var info, statErr = os.Stat(path)
+	if statErr != nil {
+		exit(fmt.Sprintf("coverage: %s", statErr))
+	}
+
+	var paths = []string{path}
+	if info.IsDir() {
+		paths = []string{}
+		for _, relativePath := range shortcutPaths(path) {
+			paths = append(paths, filepath.Join(path, relativePath))
+		}
+		if len(paths) == 0 {
+			exit(fmt.Sprintf("coverage: No Shortcut or property list files in '%s'.", path))
+		}
+	}
+
+	loadStandardActions()
+	mapSplitActions()
+
+	var coverages = make(map[string]*actionCoverage)
+	var shortcuts int
+	for _, shortcutPath := range paths {
+		var contents, readErr = readShortcut(shortcutPath)
+		if readErr != nil {
+			fmt.Println(ansi("Warning:", orange, bold), fmt.Sprintf("Unable to read %s: %s", shortcutPath, readErr))
+			continue
+		}
+		shortcuts++
+
+		for _, action := range contents.WFWorkflowActions {
+			var covered = actionCoverageOf(&action)
+			var key = covered.identifier + "\x00" + covered.name
+			if existing, found := coverages[key]; found {
+				existing.merge(covered)
+				continue
+			}
+			coverages[key] = &covered
+		}
+	}
+
+	printCoverage(coverages, shortcuts)
+}
+
+// actionCoverageOf matches action against the defined actions and returns how it matched.
+func actionCoverageOf(action *ShortcutAction) (covered actionCoverage) {
+	covered.identifier = action.WFWorkflowActionIdentifier
+	covered.uses = 1
+
+	if syntax, found := syntaxActions[action.WFWorkflowActionIdentifier]; found {
+		covered.source = coverageSyntax
+		covered.name = syntax
+		return
+	}
+	if actionIdentifierEnd(action.WFWorkflowActionIdentifier) == "getvariable" {
+		covered.source = coverageUnsupported
+		covered.unmatched = unmatchedParameters(action, nil)
+		return
+	}
+
+	var name, definition = matchAction(action)
+	covered.source = coverageStandard
+	if name == "" && !args.Using("no-toolkit") && matchToolkitAction(action) {
+		name, definition = matchAction(action)
+		covered.source = coverageToolkit
+	}
+	if name == "" {
+		covered.source = coverageRaw
+		covered.unmatched = unmatchedParameters(action, nil)
+		return
+	}
+
+	if _, split := identifierMap[splitActionIdentifier(name, &definition)]; split && covered.source == coverageStandard {
+		covered.source = coverageSplit
+		covered.params, covered.values = scoreActionMatch(actionValue{identifier: name, definition: &definition}, definition.parameters, action.WFWorkflowActionParameters)
+	}
+
+	covered.name = name
+	covered.unmatched = unmatchedParameters(action, &definition)
+
+	return
+}
+
+// matchToolkitAction imports the actions of the app that defines action from the ToolKit database if it has one.
+func matchToolkitAction(action *ShortcutAction) bool {
+	connectToolkitDB()
+
+	var identifier = toolkitIdentifier(action.WFWorkflowActionIdentifier)
+	if _, containerErr := getContainerIdByIdentifier(&identifier); containerErr != nil {
+		return false
+	}
+	if !slices.Contains(imported, identifier) {
+		importActions(identifier)
+	}
+
+	return true
+}
+
+// unmatchedParameters returns the parameters of action that are not defined by definition.
+// Parameters appended by definition based on the arguments of the action can't be known without arguments, so they are reported as unmatched.
+func unmatchedParameters(action *ShortcutAction, definition *actionDefinition) (unmatched []string) {
+	var defined = slices.Clone(coverageIgnoredParameters)
+	if definition != nil {
+		for _, param := range definition.parameters {
+			defined = append(defined, param.key)
+		}
+		for key := range definition.appendParams {
+			defined = append(defined, key)
+		}
+		if definition.appIntent.name != "" {
+			defined = append(defined, "AppIntentDescriptor")
+		}
+	}
+
+	for key := range action.WFWorkflowActionParameters {
+		if !slices.Contains(defined, key) {
+			unmatched = append(unmatched, key)
+		}
+	}
+	slices.Sort(unmatched)
+
+	return
+}
+
+// merge adds the uses of the same action matched by covered, keeping the best score and every unmatched parameter.
+func (existing *actionCoverage) merge(covered actionCoverage) {
+	existing.uses += covered.uses
+	if covered.params > existing.params || (covered.params == existing.params && covered.values > existing.values) {
+		existing.params = covered.params
+		existing.values = covered.values
+	}
+	for _, key := range covered.unmatched {
+		if !slices.Contains(existing.unmatched, key) {
+			existing.unmatched = append(existing.unmatched, key)
+		}
+	}
+	slices.Sort(existing.unmatched)
+}
+
+func printCoverage(coverages map[string]*actionCoverage, shortcuts int) {
+	var sorted []*actionCoverage
+	for _, covered := range coverages {
+		sorted = append(sorted, covered)
+	}
+	slices.SortFunc(sorted, func(a, b *actionCoverage) int {
+		if a.source != b.source {
+			return slices.Index(coverageSources, a.source) - slices.Index(coverageSources, b.source)
+		}
+		if a.uses != b.uses {
+			return b.uses - a.uses
+		}
+		return strings.Compare(a.identifier+a.name, b.identifier+b.name)
+	})
+
+	var table = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "Identifier\tUses\tSource\tMatched\tScore (Params/Values)\tUnmatched Parameters")
+
+	var uses, rawUses int
+	for _, covered := range sorted {
+		uses += covered.uses
+		var matched = covered.name
+		var score = "-"
+		switch covered.source {
+		case coverageRaw, coverageUnsupported:
+			rawUses += covered.uses
+			matched = "-"
+		case coverageSplit:
+			matched += "()"
+			score = fmt.Sprintf("%d/%d", covered.params, covered.values)
+		case coverageStandard, coverageToolkit:
+			matched += "()"
+		}
+
+		fmt.Fprintf(table, "%s\t%d\t%s\t%s\t%s\t%s\n", covered.identifier, covered.uses, covered.source, matched, score, strings.Join(covered.unmatched, ", "))
+	}
+
+	var flushErr = table.Flush()
+	handle(flushErr)
+
+	fmt.Println(ansi(fmt.Sprintf("\n%d of %d action uses in %d Shortcut(s) matched a definition, %d would be decompiled as raw actions or are unsupported.", uses-rawUses, uses, shortcuts, rawUses), green))
+}
@@ -15,6 +15,9 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
 
 	"github.com/electrikmilk/args-parser"
 	"howett.net/plist"
@@ -36,6 +39,10 @@ func decompile(b []byte) {
 	variables = make(map[string]varValue)
 	uuids = make(map[string]string)
 	controlFlowGroups = make(map[int]controlFlowGroup)
+	scopedVariables = make(map[string]string)
+	decompConstants = make(map[string]string)
+	inCommentSection = false
+	inMenuSection = false
 
 	basename = strings.ReplaceAll(basename, " ", "_")
 	outputPath = getOutputPath(basename + ".cherri")
@@ -49,13 +56,21 @@ func decompile(b []byte) {
 	resetParse()
 	firstChar()
 
+	mapFunctions()
 	mapVariables()
 	mapSplitActions()
+	mapRepeatedActions()
 	mapIdentifiers()
 	mapControlFlowOutputs()
+	mapLoopVariables()
+	mapReferences()
+	mapOutputActions()
 
 	defineName()
 	decompileIcon()
+	decompileDefinitions()
+	decompileImportQuestions()
+	decompileReferences()
 
 	decompileActions()
 
@@ -63,6 +78,11 @@ func decompile(b []byte) {
 		printDecompDebug()
 	}
 
+	if splittingImport() {
+		writeSplitImport(strings.TrimSuffix(outputPath, ".cherri"))
+		return
+	}
+
 	var writeErr = os.WriteFile(outputPath, []byte(code.String()), 0600)
 	handle(writeErr)
 }
@@ -85,38 +105,42 @@ func mapIdentifiers() {
 }
 
 func mapControlFlowOutputs() {
+	var groupNames = make(map[any]string)
 	for _, action := range shortcut.WFWorkflowActions {
-		switch action.WFWorkflowActionIdentifier {
-		case "is.workflow.actions.conditional":
-			fallthrough
-		case "is.workflow.actions.choosefrommenu":
-			fallthrough
-		case "is.workflow.actions.repeat.count":
-			fallthrough
-		case "is.workflow.actions.repeat.each":
-			var params = action.WFWorkflowActionParameters
-			if params["WFControlFlowMode"].(uint64) != endStatement {
-				continue
-			}
+		var params = action.WFWorkflowActionParameters
+		if !controlFlowAction(&action) || params["WFControlFlowMode"].(uint64) != endStatement || params["UUID"] == nil {
+			continue
+		}
 
-			var groupName string
-			if params["UUID"] != nil {
-				var endingUUID = params["UUID"].(string)
-				if uuids[endingUUID] != "" {
-					groupName = uuids[endingUUID]
-				}
-			}
+		groupNames[params["GroupingIdentifier"]] = uuids[params["UUID"].(string)]
+	}
 
-			controlFlowGroups[groupingIdx] = controlFlowGroup{
-				groupType:  Conditional,
-				identifier: groupName,
-			}
-			groupingIdx++
+	// Groups are numbered in the order they start, as that is the order they are decompiled in.
+	for _, action := range shortcut.WFWorkflowActions {
+		var params = action.WFWorkflowActionParameters
+		if !controlFlowAction(&action) || params["WFControlFlowMode"].(uint64) != startStatement {
+			continue
 		}
+
+		controlFlowGroups[groupingIdx] = controlFlowGroup{
+			groupType:  Conditional,
+			identifier: groupNames[params["GroupingIdentifier"]],
+		}
+		groupingIdx++
 	}
 	groupingIdx = 0
 }
 
+// controlFlowAction returns true if action is part of a conditional, menu or repeat.
+func controlFlowAction(action *ShortcutAction) bool {
+	switch action.WFWorkflowActionIdentifier {
+	case "is.workflow.actions.conditional", "is.workflow.actions.choosefrommenu", "is.workflow.actions.repeat.count", "is.workflow.actions.repeat.each":
+		return true
+	}
+
+	return false
+}
+
 // Map out variables in the Shortcut and their UUIDs for later checks.
 func mapVariables() {
 	for _, action := range shortcut.WFWorkflowActions {
@@ -132,7 +156,8 @@ func mapVariables() {
 			if action.WFWorkflowActionParameters["WFInput"] != nil {
 				var wfInput WFInput
 				mapToStruct(action.WFWorkflowActionParameters["WFInput"], &wfInput)
-				if _, found := uuids[wfInput.Value.OutputUUID]; !found {
+				// An output that is coerced or has a property taken is referenced by the variable, not its value.
+				if _, found := uuids[wfInput.Value.OutputUUID]; !found && len(wfInput.Value.Aggrandizements) == 0 {
 					varUUIDs = append(varUUIDs, wfInput.Value.OutputUUID)
 				}
 			}
@@ -265,6 +290,10 @@ func mapUUID(uuid string, varName string) {
 	if _, found := uuids[uuid]; !found {
 		outputName = varName
 		sanitizeIdentifier(&outputName)
+		if _, isGlobal := globals[outputName]; isGlobal {
+			// Outputs can't be named after a global, such as the output of currentDate().
+			outputName += "1"
+		}
 		uuids[uuid] = checkDuplicateOutputName(outputName)
 	}
 }
@@ -286,6 +315,17 @@ func sanitizeIdentifier(identifier *string) {
 	*identifier = strings.ReplaceAll(*identifier, "-", "_")
 }
 
+// scopedVariables maps variables renamed by a block-scoped declaration to the name they were declared with.
+var scopedVariables map[string]string
+
+// unscopeIdentifier replaces the name of a variable that was renamed by a block-scoped declaration with its declared name.
+// It must be used before sanitizeIdentifier, which removes the separator from the name.
+func unscopeIdentifier(identifier *string) {
+	if declaredAs, found := scopedVariables[*identifier]; found {
+		*identifier = declaredAs
+	}
+}
+
 type actionValue struct {
 	identifier string
 	definition *actionDefinition
@@ -294,18 +334,24 @@ type actionValue struct {
 var identifierMap map[string][]actionValue
 
 // mapSplitActions creates a map of actions that have been split into a few actions to reduce the number of arguments.
+// splitActionIdentifier returns the identifier that the actions which are the same action are mapped by.
+func splitActionIdentifier(name string, action *actionDefinition) string {
+	var identifier = action.identifier
+	if action.overrideIdentifier != "" {
+		identifier = action.overrideIdentifier
+	} else if action.identifier == "" {
+		identifier = name
+	}
+
+	return strings.ToLower(identifier)
+}
+
 func mapSplitActions() {
 	if identifierMap == nil {
 		identifierMap = make(map[string][]actionValue)
 	}
 	for identifier, action := range actions {
-		var ident = action.identifier
-		if action.identifier == "" {
-			ident = identifier
-		}
-
-		ident = strings.ToLower(ident)
-
+		var ident = splitActionIdentifier(identifier, action)
 		var splitActionValue = actionValue{
 			identifier: identifier,
 			definition: action,
@@ -379,10 +425,171 @@ func defineColors(icon ShortcutIcon, colors map[string]int) {
 	}
 }
 
+// decompileDefinitions reverses the inputs, outputs, workflow types, quick actions, no-input behavior and version of the Shortcut into definitions.
+func decompileDefinitions() {
+	var definitions []string
+	if len(shortcut.WFWorkflowInputContentItemClasses) != len(contentItems) {
+		definitions = appendTypeDefinition(definitions, "inputs", reversedContentItems(), shortcut.WFWorkflowInputContentItemClasses)
+	}
+	definitions = appendTypeDefinition(definitions, "outputs", reversedContentItems(), shortcut.WFWorkflowOutputContentItemClasses)
+	definitions = appendTypeDefinition(definitions, "from", reverseMap(workflowTypes), shortcut.WFWorkflowTypes)
+	definitions = appendTypeDefinition(definitions, "quickactions", reverseMap(quickActions), shortcut.WFQuickActionSurfaces)
+
+	if noInputDefinition := decompNoInput(); noInputDefinition != "" {
+		definitions = append(definitions, noInputDefinition)
+	}
+	if version := decompVersion(); version != "" {
+		definitions = append(definitions, "#define version "+version)
+	}
+
+	if len(definitions) == 0 {
+		return
+	}
+	for _, definition := range definitions {
+		newCodeLine(definition + "\n")
+	}
+	newCodeLine("\n")
+}
+
+func appendTypeDefinition(definitions []string, definition string, names map[string]string, values []string) []string {
+	var definedTypes []string
+	for _, value := range values {
+		var name, found = names[value]
+		if !found {
+			decompWarning(fmt.Sprintf("Unknown %s type '%s'.", definition, value))
+			continue
+		}
+		if !slices.Contains(definedTypes, name) {
+			definedTypes = append(definedTypes, name)
+		}
+	}
+	if len(definedTypes) == 0 {
+		return definitions
+	}
+
+	return append(definitions, fmt.Sprintf("#define %s %s", definition, strings.Join(definedTypes, ", ")))
+}
+
+func reverseMap(values map[string]string) map[string]string {
+	var reversed = make(map[string]string)
+	for key, value := range values {
+		reversed[value] = key
+	}
+
+	return reversed
+}
+
+func decompNoInput() string {
+	var parameters, _ = shortcut.WFWorkflowNoInputBehavior["Parameters"].(map[string]any)
+	switch shortcut.WFWorkflowNoInputBehavior["Name"] {
+	case "WFWorkflowNoInputBehaviorShowError":
+		return fmt.Sprintf("#define noinput %s \"%s\"", StopWith, escapeString(fmt.Sprintf("%v", parameters["Error"])))
+	case "WFWorkflowNoInputBehaviorAskForInput":
+		var itemClass = fmt.Sprintf("%v", parameters["ItemClass"])
+		if contentItem, found := reversedContentItems()[itemClass]; found {
+			return fmt.Sprintf("#define noinput %s %s", AskFor, contentItem)
+		}
+		decompWarning(fmt.Sprintf("Unknown content item type '%s' for no-input behavior.", itemClass))
+	case "WFWorkflowNoInputBehaviorGetClipboard":
+		return fmt.Sprintf("#define noinput %s", GetClipboard)
+	}
+
+	return ""
+}
+
+// decompVersion returns the iOS version of the minimum client version, or the client version of the Shortcut if it is not the default.
+func decompVersion() string {
+	var minimumVersion = shortcut.WFWorkflowMinimumClientVersionString
+	if minimumVersion == versions["16"] {
+		minimumVersion = ""
+	}
+	for _, version := range []string{minimumVersion, shortcut.WFWorkflowClientVersion} {
+		if version == "" || version == clientVersion {
+			continue
+		}
+
+		var matches []string
+		for iosVersion, client := range versions {
+			if client == version {
+				matches = append(matches, iosVersion)
+			}
+		}
+		if len(matches) != 0 {
+			slices.Sort(matches)
+			return matches[0]
+		}
+	}
+
+	return ""
+}
+
+// importQuestions maps the index of an action and a parameter key to the identifier of an import question.
+var importQuestions map[int]map[string]string
+
+// decompileImportQuestions reverses import questions into #question definitions.
+func decompileImportQuestions() {
+	importQuestions = make(map[int]map[string]string)
+	if shortcut.WFWorkflowImportQuestions == nil {
+		return
+	}
+
+	var wfQuestions []WFQuestion
+	mapToStruct(shortcut.WFWorkflowImportQuestions, &wfQuestions)
+	if len(wfQuestions) == 0 {
+		return
+	}
+
+	var identifiers []string
+	for _, q := range wfQuestions {
+		var identifier = questionIdentifier(q.Text, identifiers)
+		identifiers = append(identifiers, identifier)
+
+		if importQuestions[q.ActionIndex] == nil {
+			importQuestions[q.ActionIndex] = make(map[string]string)
+		}
+		importQuestions[q.ActionIndex][q.ParameterKey] = identifier
+
+		var defaultValue string
+		if q.DefaultValue != nil {
+			defaultValue = fmt.Sprintf("%v", q.DefaultValue)
+		}
+		newCodeLine(fmt.Sprintf("#question %s \"%s\" \"%s\"\n", identifier, escapeString(q.Text), escapeString(defaultValue)))
+	}
+	newCodeLine("\n")
+}
+
+// questionIdentifier makes an identifier for an import question from the first words of its text.
+func questionIdentifier(text string, identifiers []string) string {
+	var words = strings.Fields(text)
+	if len(words) > 4 {
+		words = words[:4]
+	}
+
+	var identifier = camelCase(strings.Join(words, " "))
+	sanitizeIdentifier(&identifier)
+	if identifier == "" || unicode.IsDigit([]rune(identifier)[0]) {
+		identifier = "question" + identifier
+	}
+
+	var unique = identifier
+	for i := 2; slices.Contains(identifiers, unique) || variables[unique].valueType != "" || globals[unique].variableType != ""; i++ {
+		unique = fmt.Sprintf("%s%d", identifier, i)
+	}
+
+	return unique
+}
+
 var currentVariableValue string
 
 func decompileActions() {
 	for _, action := range shortcut.WFWorkflowActions {
+		decompFunctionBoundaries()
+		decompCopyBoundaries()
+		if decompPasteAction() || decompFunctionCallAction(&action) || skippedActions[actionIndex] {
+			actionIndex++
+			continue
+		}
+
 		switch action.WFWorkflowActionIdentifier {
 		case "is.workflow.actions.comment":
 			decompComment(&action)
@@ -393,9 +600,17 @@ func decompileActions() {
 			if nonLiteral {
 				decompAction(&action)
 			}
+		case "is.workflow.actions.date":
+			if !decompDateValue(&action) {
+				decompAction(&action)
+			}
 		case "is.workflow.actions.dictionary":
 			decompDictionary(&action)
 		case "is.workflow.actions.math":
+			if action.WFWorkflowActionParameters["WFMathOperation"] == "…" {
+				decompAction(&action)
+				break
+			}
 			decompBasicExpression(&action)
 		case "is.workflow.actions.calculateexpression":
 			decompExpression(&action)
@@ -414,7 +629,7 @@ func decompileActions() {
 			if dictionaryKey != nil && action.WFWorkflowActionParameters[UUID] != nil &&
 				!slices.Contains(constUUIDs, action.WFWorkflowActionParameters[UUID].(string)) {
 				decompDictionaryGetValue(&action)
-				continue
+				break
 			}
 			fallthrough
 		default:
@@ -422,11 +637,24 @@ func decompileActions() {
 		}
 		actionIndex++
 	}
+	decompCopyBoundaries()
+	decompFunctionBoundaries()
 }
 
 var varUUIDs []string
 var constUUIDs []string
 
+// decompConstants are the names of constants with a text value declared outside any block, by their value.
+// Constants are folded into the references to them when compiling, so these literals are decompiled as references.
+// A value declared by more than one constant is ambiguous and has no name.
+var decompConstants map[string]string
+
+// distinctiveTextRegex matches text literals that are distinctive enough to be assumed to be a reference to a constant,
+// numbers and short text such as separators are common literals, so they are never decompiled as references.
+var distinctiveTextRegex = regexp.MustCompile(`^"[^"{}\\\n]*[A-Za-z][^"{}\\\n]*"$`)
+
+const distinctiveTextLength = 4
+
 // checkConstantLiteral determines if action should be written out on a new line as a constant and clear the current variable value.
 func checkConstantLiteral(action *ShortcutAction) {
 	if _, found := action.WFWorkflowActionParameters[UUID]; !found {
@@ -440,6 +668,7 @@ func checkConstantLiteral(action *ShortcutAction) {
 		newCodeLine(fmt.Sprintf("const %s = ", outputName))
 		code.WriteString(currentVariableValue)
 		code.WriteRune('\n')
+		declareDecompConstant(outputName, currentVariableValue)
 		currentVariableValue = ""
 	}
 }
@@ -453,12 +682,35 @@ func makeConstantLiteral(action *ShortcutAction) {
 		newCodeLine(fmt.Sprintf("const %s = ", outputName))
 		code.WriteString(currentVariableValue)
 		code.WriteRune('\n')
+		declareDecompConstant(outputName, currentVariableValue)
 		currentVariableValue = ""
 	}
 }
 
+func declareDecompConstant(name string, value string) {
+	if tabLevel != 0 || !distinctiveTextRegex.MatchString(value) || len([]rune(value))-2 < distinctiveTextLength {
+		return
+	}
+	if existing, found := decompConstants[value]; found && existing != name {
+		decompConstants[value] = ""
+		return
+	}
+	decompConstants[value] = name
+}
+
+// constantReference returns the name of the only constant with the literal value, if there is one.
+func constantReference(value string) string {
+	if name := decompConstants[value]; name != "" {
+		return name
+	}
+
+	return value
+}
+
 func decompComment(action *ShortcutAction) {
 	var commentText = action.WFWorkflowActionParameters["WFCommentActionText"].(string)
+	beginCommentSection(commentText)
+
 	if args.Using("comments") {
 		if strings.Contains(commentText, "\n") {
 			newCodeLine(fmt.Sprintf("comment('\n%s\n')\n\n", commentText))
@@ -482,16 +734,118 @@ var decompilingText = false
 
 func decompTextValue(action *ShortcutAction) {
 	decompilingText = true
-	currentVariableValue = decompValue(action.WFWorkflowActionParameters["WFTextActionText"])
+	var text = action.WFWorkflowActionParameters["WFTextActionText"]
+	currentVariableValue = decompValue(text)
 	if currentVariableValue == "" {
 		currentVariableValue = "\"\""
+	} else if plainText, ok := text.(string); ok {
+		currentVariableValue = multilineTextLiteral(escapeLiteralBraces(escapeString(plainText)))
 	} else {
-		currentVariableValue = fmt.Sprintf("\"%s\"", escapeString(strings.Trim(currentVariableValue, "\"")))
+		// Text with attachments is already escaped.
+		currentVariableValue = multilineTextLiteral(currentVariableValue)
 	}
 	checkConstantLiteral(action)
+	if _, found := action.WFWorkflowActionParameters[UUID]; !found {
+		// Text that is not referenced is the output of the block it is in.
+		code.WriteString(tabbedLine(fmt.Sprintf("text(%s)", currentVariableValue)))
+		code.WriteRune('\n')
+		currentVariableValue = ""
+	}
 	decompilingText = false
 }
 
+// multilineTextLiteral makes escaped text into a string literal, text containing line breaks becomes a multiline string.
+func multilineTextLiteral(escaped string) string {
+	var body, trailingBreak = strings.CutSuffix(escaped, `\n`)
+	if trailingBreak && strings.HasSuffix(body, `\`) {
+		body, trailingBreak = escaped, false
+	}
+
+	var textLines []string
+	var textLine strings.Builder
+	var keepEscapedQuotes = strings.Contains(escaped, `\"\"`) || strings.HasSuffix(escaped, `\"`)
+	var escapedChars = []rune(body)
+	for i := 0; i < len(escapedChars); i++ {
+		if escapedChars[i] != '\\' || i+1 == len(escapedChars) {
+			textLine.WriteRune(escapedChars[i])
+			continue
+		}
+
+		i++
+		switch {
+		case escapedChars[i] == 'n':
+			textLines = append(textLines, textLine.String())
+			textLine.Reset()
+		case escapedChars[i] == '"' && !keepEscapedQuotes:
+			textLine.WriteRune('"')
+		default:
+			textLine.WriteRune('\\')
+			textLine.WriteRune(escapedChars[i])
+		}
+	}
+	if len(textLines) == 0 {
+		return fmt.Sprintf("\"%s\"", escaped)
+	}
+	if trailingBreak {
+		textLine.WriteString(`\n`)
+	}
+	textLines = append(textLines, textLine.String())
+
+	var indent = strings.Repeat("\t", tabLevel+1)
+	var literal strings.Builder
+	literal.WriteString("\"\"\"\n")
+	for _, line := range textLines {
+		if line != "" {
+			literal.WriteString(indent + line)
+		}
+		literal.WriteRune('\n')
+	}
+	literal.WriteString(indent + "\"\"\"")
+
+	return literal.String()
+}
+
+// decompDateValue decompiles a date action with a specified date that is valid as a date literal.
+func decompDateValue(action *ShortcutAction) bool {
+	var date, _ = action.WFWorkflowActionParameters["WFDateActionDate"].(string)
+	if action.WFWorkflowActionParameters["WFDateActionMode"] != "Specified Date" {
+		return false
+	}
+	if _, valid := parseDateLiteral(date); !valid {
+		return false
+	}
+
+	currentVariableValue = fmt.Sprintf("d\"%s\"", date)
+	checkConstantLiteral(action)
+
+	return true
+}
+
+// dateLiteral returns a date literal for date in the local time zone, with only the parts of the time that are set.
+func dateLiteral(date time.Time) string {
+	var layout = dateLiteralLayouts[0]
+	date = date.Local()
+	switch {
+	case date.Second() != 0:
+		layout = dateLiteralLayouts[2]
+	case date.Hour() != 0 || date.Minute() != 0:
+		layout = dateLiteralLayouts[1]
+	}
+
+	return fmt.Sprintf("d\"%s\"", date.Format(layout))
+}
+
+// boolLiteral returns true if the number action is a bool, which the compiler makes a number action set to "0" or "1".
+func boolLiteral(action *ShortcutAction) bool {
+	var value = action.WFWorkflowActionParameters["WFNumberActionNumber"]
+	if value != "0" && value != "1" {
+		return false
+	}
+	var outputName, _ = action.WFWorkflowActionParameters["CustomOutputName"].(string)
+
+	return outputName == "Bool" || strings.HasPrefix(outputName, "Bool ")
+}
+
 func decompNumberValue(action *ShortcutAction) (nonLiteral bool) {
 	var value = action.WFWorkflowActionParameters["WFNumberActionNumber"]
 	if reflect.TypeOf(value).Kind() == reflect.Map {
@@ -511,6 +865,12 @@ func decompNumberValue(action *ShortcutAction) (nonLiteral bool) {
 		return
 	}
 
+	if boolLiteral(action) {
+		currentVariableValue = strconv.FormatBool(value == "1")
+		checkConstantLiteral(action)
+		return
+	}
+
 	var number any
 	var convErr error
 	if reflect.TypeOf(value).Kind() == reflect.String {
@@ -551,6 +911,11 @@ func decompBasicExpression(action *ShortcutAction) {
 			operation = action.WFWorkflowActionParameters["WFMathOperation"].(string)
 		}
 	}
+	if decompVariableModifier(action, operation) {
+		currentVariableValue = decompValue(operand)
+		return
+	}
+
 	var expression = strings.Trim(decompValue(input), "\"") + " " + strings.Trim(operation, "\"") + " " + strings.Trim(decompValue(operand), "\"")
 	var varRegex = regexp.MustCompile(`{(.*?)}`)
 	currentVariableValue = varRegex.ReplaceAllString(expression, "$1")
@@ -558,6 +923,55 @@ func decompBasicExpression(action *ShortcutAction) {
 	checkConstantLiteral(action)
 }
 
+// currentVariableModifier is the operator used to modify the variable set by the next action (e.g. +=).
+var currentVariableModifier tokenType
+
+// variableModifiers are the operators that modify a variable, by the operation of the math action the compiler adds for them.
+var variableModifiers = map[string]tokenType{
+	"+": AddTo,
+	"-": SubFrom,
+	"*": MultiplyBy,
+	"/": DivideBy,
+}
+
+// decompVariableModifier returns true if action is the math action the compiler adds to modify a variable by a number or variable,
+// which only sets the variable it is performed on, and sets the operator used to modify the variable.
+func decompVariableModifier(action *ShortcutAction, operation string) bool {
+	var actionUUID, _ = action.WFWorkflowActionParameters[UUID].(string)
+	if actionUUID == "" || !slices.Contains(varUUIDs, actionUUID) || slices.Contains(constUUIDs, actionUUID) || actionIndex+1 >= len(shortcut.WFWorkflowActions) {
+		return false
+	}
+	switch operand := action.WFWorkflowActionParameters["WFMathOperand"].(type) {
+	case uint64, int64, float64:
+	case map[string]interface{}:
+		var operandValue, _ = operand["Value"].(map[string]interface{})
+		if operand["WFSerializationType"] != "WFTextTokenAttachment" || operandValue["Type"] != "Variable" {
+			return false
+		}
+	default:
+		return false
+	}
+
+	var input, _ = action.WFWorkflowActionParameters["WFInput"].(map[string]interface{})
+	var inputValue, _ = input["Value"].(map[string]interface{})
+	if inputValue["Type"] != "Variable" || inputValue["Aggrandizements"] != nil {
+		return false
+	}
+
+	var nextAction = shortcut.WFWorkflowActions[actionIndex+1]
+	var nextInput, _ = nextAction.WFWorkflowActionParameters["WFInput"].(map[string]interface{})
+	var nextValue, _ = nextInput["Value"].(map[string]interface{})
+	if nextAction.WFWorkflowActionIdentifier != SetVariableIdentifier || nextValue["OutputUUID"] != actionUUID ||
+		nextAction.WFWorkflowActionParameters["WFVariableName"] != inputValue["VariableName"] {
+		return false
+	}
+
+	var modifier, found = variableModifiers[operation]
+	currentVariableModifier = modifier
+
+	return found
+}
+
 func decompExpression(action *ShortcutAction) {
 	var raw = action.WFWorkflowActionParameters["Input"]
 	var expression string
@@ -574,29 +988,142 @@ func decompExpression(action *ShortcutAction) {
 
 func decompVariable(action *ShortcutAction) {
 	var variableName = action.WFWorkflowActionParameters["WFVariableName"].(string)
-	sanitizeIdentifier(&variableName)
-	newCodeLine(fmt.Sprintf("@%s", variableName))
+	var declaration string
+	if _, found := scopedVariables[variableName]; found {
+		unscopeIdentifier(&variableName)
+		declaration = fmt.Sprintf("@%s", variableName)
+	} else if declaredAs, renamed := action.WFWorkflowActionParameters[scopedVariableParameter].(string); renamed && tabLevel > 0 && action.WFWorkflowActionIdentifier == SetVariableIdentifier {
+		sanitizeIdentifier(&declaredAs)
+		scopedVariables[variableName] = declaredAs
+		declaration = fmt.Sprintf("let %s", declaredAs)
+	} else {
+		sanitizeIdentifier(&variableName)
+		declaration = fmt.Sprintf("@%s", variableName)
+	}
+	var valueType = decompValueType(action.WFWorkflowActionParameters["WFInput"])
+	var emptyList = action.WFWorkflowActionIdentifier == SetVariableIdentifier && action.WFWorkflowActionParameters["WFInput"] == nil &&
+		appendedVariable(action.WFWorkflowActionParameters["WFVariableName"])
+	if emptyList {
+		valueType = Arr
+		if items, found := decompArrayLiteral(action.WFWorkflowActionParameters["WFVariableName"]); found {
+			currentVariableValue = items
+			emptyList = false
+		}
+	}
+	if decompBoolVariables[variableName] && (currentVariableValue == "0" || currentVariableValue == "1") {
+		currentVariableValue = strconv.FormatBool(currentVariableValue == "1")
+		valueType = Bool
+	}
+	if action.WFWorkflowActionIdentifier == AppendVariableIdentifier {
+		delete(decompVariableTypes, variableName)
+	} else {
+		decompVariableTypes[variableName] = valueType
+		if currentVariableValue == "" && valueType != "" {
+			declaration = fmt.Sprintf("%s: %s", declaration, valueType)
+		}
+	}
+	newCodeLine(declaration)
 
 	if currentVariableValue != "" {
 		code.WriteRune(' ')
 		if action.WFWorkflowActionIdentifier == AppendVariableIdentifier {
 			code.WriteString("+= ")
+		} else if currentVariableModifier != "" {
+			code.WriteString(fmt.Sprintf("%s ", currentVariableModifier))
 		} else {
 			code.WriteString("= ")
 		}
 
-		code.WriteString(currentVariableValue)
-	} else {
+		code.WriteString(constantReference(currentVariableValue))
+	} else if !emptyList {
 		var decompInput = decompValue(action.WFWorkflowActionParameters["WFInput"])
-		if decompInput != "" {
-			code.WriteString(fmt.Sprintf(" = %s", decompInput))
+		if decompInput != "" && action.WFWorkflowActionIdentifier == AppendVariableIdentifier {
+			code.WriteString(fmt.Sprintf(" += %s", constantReference(decompInput)))
+		} else if decompInput != "" {
+			code.WriteString(fmt.Sprintf(" = %s", constantReference(decompInput)))
 		}
 	}
 
 	currentVariableValue = ""
+	currentVariableModifier = ""
 	code.WriteRune('\n')
 }
 
+// appendedVariable returns true if the variable named variableName is appended to before it is set again,
+// as the compiler sets a variable to nothing before appending the items of a list to it.
+func appendedVariable(variableName any) bool {
+	for _, action := range shortcut.WFWorkflowActions[actionIndex+1:] {
+		if action.WFWorkflowActionParameters["WFVariableName"] != variableName {
+			continue
+		}
+
+		return action.WFWorkflowActionIdentifier == AppendVariableIdentifier
+	}
+
+	return false
+}
+
+// decompArrayLiteral returns an array literal of the text and number items the compiler appends to the
+// variable named variableName right after it is set, which are then skipped.
+func decompArrayLiteral(variableName any) (string, bool) {
+	var items []string
+	var i = actionIndex + 1
+	for ; i+1 < len(shortcut.WFWorkflowActions); i += 2 {
+		var item = shortcut.WFWorkflowActions[i]
+		var appended = shortcut.WFWorkflowActions[i+1]
+		if appended.WFWorkflowActionIdentifier != AppendVariableIdentifier ||
+			appended.WFWorkflowActionParameters["WFVariableName"] != variableName ||
+			appended.WFWorkflowActionParameters["WFSerializationType"] != nil {
+			break
+		}
+		var input, isInput = appended.WFWorkflowActionParameters["WFInput"].(map[string]interface{})
+		if !isInput {
+			break
+		}
+		var value, isValue = input["Value"].(map[string]interface{})
+		if !isValue || item.WFWorkflowActionParameters[UUID] == nil || value["OutputUUID"] != item.WFWorkflowActionParameters[UUID] {
+			break
+		}
+		var literal, isLiteral = arrayItemLiteral(&item)
+		if !isLiteral {
+			break
+		}
+		items = append(items, literal)
+	}
+	if len(items) == 0 {
+		return "", false
+	}
+	for j := actionIndex + 1; j < i; j++ {
+		skippedActions[j] = true
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(items, ", ")), true
+}
+
+// arrayItemLiteral returns the literal of a text or number item of an array literal.
+func arrayItemLiteral(item *ShortcutAction) (string, bool) {
+	switch item.WFWorkflowActionIdentifier {
+	case "is.workflow.actions.gettext":
+		var text, isText = item.WFWorkflowActionParameters["WFTextActionText"].(string)
+		if !isText || strings.ContainsAny(text, "\\\"{}\n") {
+			return "", false
+		}
+
+		return fmt.Sprintf("\"%s\"", text), true
+	case "is.workflow.actions.number":
+		switch number := item.WFWorkflowActionParameters["WFNumberActionNumber"].(type) {
+		case string:
+			if _, numberErr := strconv.ParseFloat(number, 64); numberErr == nil {
+				return number, true
+			}
+		case uint64, int64, float64:
+			return fmt.Sprint(number), true
+		}
+	}
+
+	return "", false
+}
+
 func decompDictionaryGetValue(action *ShortcutAction) {
 	var dictionaryValueRef strings.Builder
 	dictionaryValueRef.WriteString(decompValue(action.WFWorkflowActionParameters["WFInput"]))
@@ -617,24 +1144,19 @@ func decompDictionaryGetValue(action *ShortcutAction) {
 }
 
 func checkControlFlowOutput(action *ShortcutAction) bool {
-	switch action.WFWorkflowActionIdentifier {
-	case "is.workflow.actions.conditional":
-		fallthrough
-	case "is.workflow.actions.choosefrommenu":
-		fallthrough
-	case "is.workflow.actions.repeat.count":
-		fallthrough
-	case "is.workflow.actions.repeat.each":
-		if action.WFWorkflowActionParameters["WFControlFlowMode"].(uint64) == startStatement {
-			var group = controlFlowGroups[groupingIdx]
-			if group.identifier != "" {
-				newCodeLine(fmt.Sprintf("const %s = ", group.identifier))
-				groupingIdx++
-				return true
-			}
-		}
+	if !controlFlowAction(action) || action.WFWorkflowActionParameters["WFControlFlowMode"].(uint64) != startStatement {
+		return false
 	}
-	return false
+
+	var group = controlFlowGroups[groupingIdx]
+	groupingIdx++
+	if group.identifier == "" {
+		return false
+	}
+
+	newCodeLine(fmt.Sprintf("const %s = ", group.identifier))
+
+	return true
 }
 
 func beginStatement(t tokenType, action *ShortcutAction) {
@@ -670,32 +1192,346 @@ func decompMenu(action *ShortcutAction) {
 		tabLevel++
 	case statementPart:
 		tabLevel--
-		newCodeLine("item ")
+		var topLevelItem = tabLevel == 0 && splittingMenus()
+		if topLevelItem && inMenuSection {
+			endImportSection()
+		}
+
+		var itemTitle string
 		if _, found := action.WFWorkflowActionParameters["WFMenuItemAttributedTitle"]; found {
-			code.WriteString(decompValue(action.WFWorkflowActionParameters["WFMenuItemAttributedTitle"]))
+			itemTitle = decompValue(action.WFWorkflowActionParameters["WFMenuItemAttributedTitle"])
 		} else if menus[groupingUUID] != nil {
 			var menuItem = menus[groupingUUID][0]
-			code.WriteString(decompValue(menuItem.value))
+			itemTitle = decompValue(menuItem.value)
 			var menu = menus[groupingUUID]
 			menus[groupingUUID] = append(menu[:0], menu[1:]...)
 		}
-		code.WriteString(":\n")
+		newCodeLine(fmt.Sprintf("item %s:\n", itemTitle))
 		tabLevel++
+
+		if topLevelItem {
+			beginImportSection(strings.Trim(itemTitle, "\""))
+			inMenuSection = true
+		}
 	case endStatement:
 		tabLevel--
+		if tabLevel == 0 && inMenuSection {
+			endImportSection()
+			inMenuSection = false
+		}
 		newCodeLine("}\n")
 	}
 }
 
+// loopVariables are the identifiers of each loop, by the index of the action that starts the loop.
+var loopVariables map[int]string
+
+// skippedActions are the indexes of the actions decompiled as part of another, such as the variables set to the identifiers of a loop.
+var skippedActions map[int]bool
+
+// rangeLoops are the ranges repeated over, by the index of the action that starts the repeat.
+var rangeLoops map[int]string
+
+// mapLoopVariables maps the variables set to the repeat index and item at the start of each loop,
+// as the compiler sets a variable for each identifier of a loop, these are decompiled as the identifiers.
+func mapLoopVariables() {
+	loopVariables = make(map[int]string)
+	skippedActions = make(map[int]bool)
+	rangeLoops = make(map[int]string)
+
+	var ranges = make(map[int]rangeLoop)
+	var rangeActions = make(map[int]bool)
+	for i, action := range shortcut.WFWorkflowActions {
+		if action.WFWorkflowActionParameters["WFControlFlowMode"] != startStatement || actionIdentifierEnd(action.WFWorkflowActionIdentifier) != "repeat.count" {
+			continue
+		}
+		if loop, found := findRangeLoop(i); found {
+			ranges[i] = loop
+			for _, j := range loop.actions {
+				rangeActions[j] = true
+			}
+		}
+	}
+
+	var reassigned = reassignedVariables(rangeActions)
+	for i, action := range shortcut.WFWorkflowActions {
+		if action.WFWorkflowActionParameters["WFControlFlowMode"] != startStatement {
+			continue
+		}
+		switch actionIdentifierEnd(action.WFWorkflowActionIdentifier) {
+		case "repeat.count":
+			if index, found := loopVariable(i+1, "Repeat Index", reassigned); found {
+				loopVariables[i] = index
+				if loop, isRange := ranges[i]; isRange && skippedActions[i+1] {
+					rangeLoops[i] = loop.statement
+					for _, j := range loop.actions {
+						skippedActions[j] = true
+					}
+				}
+			}
+		case "repeat.each":
+			var item, found = loopVariable(i+1, "Repeat Item", reassigned)
+			if !found {
+				continue
+			}
+			loopVariables[i] = item
+			if skippedActions[i+1] {
+				if index, enumerated := loopVariable(i+2, "Repeat Index", reassigned); enumerated && skippedActions[i+2] {
+					loopVariables[i] = fmt.Sprintf("(%s, %s)", index, item)
+				}
+			}
+		}
+	}
+}
+
+// loopGlobalVariable returns the name of the repeat global the action at index i sets a variable to.
+func loopGlobalVariable(i int, global string) (string, bool) {
+	if i >= len(shortcut.WFWorkflowActions) || shortcut.WFWorkflowActions[i].WFWorkflowActionIdentifier != SetVariableIdentifier {
+		return "", false
+	}
+
+	var input, _ = shortcut.WFWorkflowActions[i].WFWorkflowActionParameters["WFInput"].(map[string]interface{})
+	var value, _ = input["Value"].(map[string]interface{})
+	var variableName, _ = value["VariableName"].(string)
+	if value["Type"] != "Variable" || value["Aggrandizements"] != nil || (variableName != global && !strings.HasPrefix(variableName, global+" ")) {
+		return "", false
+	}
+
+	return variableName, true
+}
+
+// reassignedVariables returns the names of the variables that are set by an action that doesn't set them to a repeat global at the start of a loop,
+// other than the actions that set them to the current value of a range.
+func reassignedVariables(rangeActions map[int]bool) map[string]bool {
+	var reassigned = make(map[string]bool)
+	var actions = shortcut.WFWorkflowActions
+	for i, action := range actions {
+		if action.WFWorkflowActionIdentifier != SetVariableIdentifier && action.WFWorkflowActionIdentifier != AppendVariableIdentifier || rangeActions[i] {
+			continue
+		}
+
+		var variableName, _ = action.WFWorkflowActionParameters["WFVariableName"].(string)
+		if _, isLoopVariable := loopGlobalVariable(i, "Repeat"); isLoopVariable && i > 0 &&
+			(actions[i-1].WFWorkflowActionParameters["WFControlFlowMode"] == startStatement ||
+				i > 1 && actions[i-2].WFWorkflowActionParameters["WFControlFlowMode"] == startStatement) {
+			continue
+		}
+
+		reassigned[variableName] = true
+	}
+
+	return reassigned
+}
+
+// loopVariable returns the identifier for the variable set to the repeat global by the action at index i.
+// A variable that is also set elsewhere can't be the identifier of a loop, so the identifier is the global it is set to.
+func loopVariable(i int, global string, reassigned map[string]bool) (identifier string, found bool) {
+	var variableName string
+	if variableName, found = loopGlobalVariable(i, global); !found {
+		return
+	}
+
+	identifier = shortcut.WFWorkflowActions[i].WFWorkflowActionParameters["WFVariableName"].(string)
+	if reassigned[identifier] {
+		if variableName == global {
+			return "_", true
+		}
+
+		identifier = variableName
+		sanitizeIdentifier(&identifier)
+
+		return identifier, true
+	}
+
+	sanitizeIdentifier(&identifier)
+	skippedActions[i] = true
+
+	return identifier, true
+}
+
+// rangeLoop is a range of integers the compiler lowers to a repeat with a count.
+type rangeLoop struct {
+	statement string
+	// actions are the indexes of the actions that set the count of the repeat and the identifier to the current value of the range.
+	actions []int
+}
+
+var rangeCountRegex = regexp.MustCompile(`^(\x{FFFC}|-?\d+) - (\x{FFFC}|-?\d+) \+ 1$`)
+var rangeCurrentRegex = regexp.MustCompile(`^\x{FFFC}(?: \* (-?\d+))?(?: ([+-]) (\d+))?$`)
+var rangeVariableCurrentRegex = regexp.MustCompile(`^(?:\x{FFFC} - 1|\(\x{FFFC} - 1\) \* (-1)) \+ \x{FFFC}$`)
+var rangeVariableRegex = regexp.MustCompile(`^[a-zA-Z_]\w*$`)
+
+// findRangeLoop returns the range the repeat at index i is lowered from, which sets the variable for its identifier
+// to the current value of the range by an expression, and repeats for the variable set to the length of the range by an expression if the range has a variable bound.
+func findRangeLoop(i int) (loop rangeLoop, found bool) {
+	if _, isLoopVariable := loopGlobalVariable(i+1, "Repeat Index"); !isLoopVariable {
+		return
+	}
+	var identifier = shortcut.WFWorkflowActions[i+1].WFWorkflowActionParameters["WFVariableName"].(string)
+	var current, currentVariables, isExpression = rangeExpression(i+2, identifier)
+	if !isExpression || currentVariables[0] != identifier || current == ObjectReplaceCharStr {
+		return
+	}
+	loop.actions = []int{i + 2, i + 3}
+
+	var start, end string
+	var step = 1
+	if matches := rangeCurrentRegex.FindStringSubmatch(current); matches != nil {
+		if matches[1] != "" {
+			step, _ = strconv.Atoi(matches[1])
+		}
+		var offset, _ = strconv.Atoi(matches[3])
+		if matches[2] == "-" {
+			offset = -offset
+		}
+		start = strconv.Itoa(offset + step)
+	} else if matches := rangeVariableCurrentRegex.FindStringSubmatch(current); matches != nil && rangeVariableRegex.MatchString(currentVariables[1]) {
+		if matches[1] != "" {
+			step = -1
+		}
+		start = "@" + currentVariables[1]
+	} else {
+		return
+	}
+
+	switch count := shortcut.WFWorkflowActions[i].WFWorkflowActionParameters["WFRepeatCount"].(type) {
+	case uint64, int64:
+		var startValue, _ = strconv.Atoi(start)
+		var countValue, _ = strconv.Atoi(fmt.Sprintf("%d", count))
+		if strings.HasPrefix(start, "@") || countValue < 1 {
+			return
+		}
+		end = strconv.Itoa(startValue + (countValue-1)*step)
+	case map[string]interface{}:
+		var countValue, _ = count["Value"].(map[string]interface{})
+		var countVariable, _ = countValue["VariableName"].(string)
+		if step != 1 && step != -1 || countValue["Type"] != "Variable" || !strings.HasPrefix(countVariable, "_range_cherri_count_") {
+			return
+		}
+		var length, lengthVariables, isLength = rangeExpression(i-2, countVariable)
+		var matches = rangeCountRegex.FindStringSubmatch(length)
+		if !isLength || matches == nil {
+			return
+		}
+
+		var bounds = matches[1:]
+		for b, bound := range bounds {
+			if bound != ObjectReplaceCharStr {
+				continue
+			}
+			if !rangeVariableRegex.MatchString(lengthVariables[0]) {
+				return
+			}
+			bounds[b] = "@" + lengthVariables[0]
+			lengthVariables = lengthVariables[1:]
+		}
+		if step == -1 {
+			slices.Reverse(bounds)
+		}
+		if bounds[1] != start {
+			return
+		}
+		end = bounds[0]
+		loop.actions = append(loop.actions, i-2, i-1)
+	default:
+		return
+	}
+
+	loop.statement = fmt.Sprintf("%s..%s", start, end)
+	if step != 1 {
+		loop.statement += fmt.Sprintf(" step %d", step)
+	}
+
+	return loop, true
+}
+
+// rangeExpression returns the expression of the calculate expression action, or the math action a basic expression is compiled to, at index i
+// if its output is set to the variable variableName by the next action, with each variable replaced by the object replacement character, and the names of those variables in order.
+func rangeExpression(i int, variableName string) (expression string, variableNames []string, found bool) {
+	var actions = shortcut.WFWorkflowActions
+	if i < 0 || i+1 >= len(actions) || actions[i+1].WFWorkflowActionIdentifier != SetVariableIdentifier || actions[i+1].WFWorkflowActionParameters["WFVariableName"] != variableName {
+		return
+	}
+
+	var inputKey = "Input"
+	switch actionIdentifierEnd(actions[i].WFWorkflowActionIdentifier) {
+	case "calculateexpression":
+	case "math":
+		inputKey = "WFInput"
+	default:
+		return
+	}
+
+	var actionUUID, _ = actions[i].WFWorkflowActionParameters[UUID].(string)
+	var setInput, _ = actions[i+1].WFWorkflowActionParameters["WFInput"].(map[string]interface{})
+	var setValue, _ = setInput["Value"].(map[string]interface{})
+	if actionUUID == "" || setValue["OutputUUID"] != actionUUID || setValue["Aggrandizements"] != nil {
+		return
+	}
+
+	var input, _ = actions[i].WFWorkflowActionParameters[inputKey].(map[string]interface{})
+	var inputValue, _ = input["Value"].(map[string]interface{})
+	var attachments, _ = inputValue["attachmentsByRange"].(map[string]interface{})
+	expression, _ = inputValue["string"].(string)
+	if inputKey == "WFInput" {
+		var operation, _ = actions[i].WFWorkflowActionParameters["WFMathOperation"].(string)
+		switch operand := actions[i].WFWorkflowActionParameters["WFMathOperand"].(type) {
+		case string, uint64, int64:
+			expression += fmt.Sprintf(" %s %v", strings.NewReplacer("×", "*", "÷", "/").Replace(operation), operand)
+		default:
+			return
+		}
+	}
+
+	var positions []int
+	var names = make(map[int]string)
+	for attachmentRange, attachment := range attachments {
+		var position, length int
+		if _, scanErr := fmt.Sscanf(attachmentRange, "{%d, %d}", &position, &length); scanErr != nil {
+			return
+		}
+		var attachmentValue, _ = attachment.(map[string]interface{})
+		var name, _ = attachmentValue["VariableName"].(string)
+		if attachmentValue["Type"] != "Variable" || attachmentValue["Aggrandizements"] != nil || name == "" {
+			return
+		}
+		positions = append(positions, position)
+		names[position] = name
+	}
+	if len(positions) == 0 || strings.Count(expression, ObjectReplaceCharStr) != len(positions) {
+		return
+	}
+
+	sort.Ints(positions)
+	for _, position := range positions {
+		variableNames = append(variableNames, names[position])
+	}
+
+	return expression, variableNames, true
+}
+
+// loopIdentifier returns the identifiers of the loop started by the current action.
+func loopIdentifier() string {
+	if identifier, found := loopVariables[actionIndex]; found {
+		return identifier
+	}
+
+	return "_"
+}
+
 func decompRepeat(action *ShortcutAction) {
 	var controlFlowMode = action.WFWorkflowActionParameters["WFControlFlowMode"].(uint64)
 	switch controlFlowMode {
 	case startStatement:
 		beginStatement(Repeat, action)
 
-		code.WriteString("_ for ")
+		code.WriteString(fmt.Sprintf("%s for ", loopIdentifier()))
 
-		code.WriteString(decompValue(action.WFWorkflowActionParameters["WFRepeatCount"]))
+		if statement, isRange := rangeLoops[actionIndex]; isRange {
+			code.WriteString(statement)
+		} else {
+			code.WriteString(decompValue(action.WFWorkflowActionParameters["WFRepeatCount"]))
+		}
 
 		code.WriteString(" {\n")
 		tabLevel++
@@ -711,7 +1547,7 @@ func decompFor(action *ShortcutAction) {
 	case startStatement:
 		beginStatement(RepeatWithEach, action)
 
-		code.WriteString("_ in ")
+		code.WriteString(fmt.Sprintf("%s in ", loopIdentifier()))
 
 		code.WriteString(decompValue(action.WFWorkflowActionParameters["WFInput"]))
 
@@ -769,9 +1605,22 @@ func matchConditionOperator(number int) tokenType {
 	return ""
 }
 
+// quantityConditions are the conditions used to compare a date to a quantity of time, by the condition they are compiled from.
+var quantityConditions = map[int]tokenType{
+	1000: GreaterThan,
+	1001: LessThan,
+}
+
+// conditionValueKeys are the parameters of a condition containing the values compared to its input, in order.
+var conditionValueKeys = []string{"WFNumberValue", "WFAnotherNumber", "WFDate", "WFAnotherDate", "WFDuration"}
+
 func decompCondition(condition map[string]interface{}, action *ShortcutAction) {
-	var conditionInt = condition["WFCondition"].(uint64)
+	// The condition is 0 (is less than) if it is missing, as it was left out of multiple conditions by earlier versions.
+	var conditionInt, _ = condition["WFCondition"].(uint64)
 	var conditionalOperator = matchConditionOperator(int(conditionInt))
+	if quantityCondition, found := quantityConditions[int(conditionInt)]; found {
+		conditionalOperator = quantityCondition
+	}
 	if conditionalOperator == "" {
 		decompError(fmt.Sprintf("Invalid conditional %v", conditionInt), action)
 	}
@@ -781,23 +1630,39 @@ func decompCondition(condition map[string]interface{}, action *ShortcutAction) {
 
 	code.WriteString(decompValue(condition["WFInput"]))
 
-	if conditionalOperator == Any || conditionalOperator == Empty {
+	switch conditionalOperator {
+	case Any, Empty:
+		return
+	case IsToday:
+		code.WriteString(fmt.Sprintf(" %s", IsToday))
 		return
 	}
 
 	code.WriteString(fmt.Sprintf(" %s ", conditionalOperator))
 
-	if condition["WFNumberValue"] != nil && condition["WFNumberValue"] != "" {
-		if reflect.TypeOf(condition["WFNumberValue"]).Kind() == reflect.String {
-			var numberValue, convErr = strconv.Atoi(condition["WFNumberValue"].(string))
-			handle(convErr)
-			code.WriteString(decompValue(numberValue))
-		} else {
-			code.WriteString(decompValue(condition["WFNumberValue"]))
+	var values []string
+	for _, key := range conditionValueKeys {
+		var value = condition[key]
+		if value == nil || value == "" {
+			continue
+		}
+		if number, isString := value.(string); isString && (key == "WFNumberValue" || key == "WFAnotherNumber") {
+			values = append(values, number)
+			continue
+		}
+		if date, isDate := value.(time.Time); isDate {
+			values = append(values, dateLiteral(date))
+			continue
+		}
+		values = append(values, decompValue(value))
+	}
+	if len(values) == 0 {
+		if _, foundStr := condition["WFConditionalActionString"]; foundStr {
+			values = append(values, decompValue(condition["WFConditionalActionString"]))
 		}
-	} else if _, foundStr := condition["WFConditionalActionString"]; foundStr {
-		code.WriteString(decompValue(condition["WFConditionalActionString"]))
 	}
+
+	code.WriteString(strings.Join(values, " "))
 }
 
 type DictionaryActionParameters struct {
@@ -881,7 +1746,8 @@ func decompDictionaryItem(item WFDictionaryFieldValueItem) any {
 	case itemTypeText:
 		itemValue = strings.Trim(itemStringValue, "\"")
 	case itemTypeArray:
-		itemValue = decompArray(itemValueMap["Value"].([]interface{}))
+		var arrayItems, _ = itemValueMap["Value"].([]interface{})
+		itemValue = decompArray(arrayItems)
 	case itemTypeDict:
 		var dictionaryItems []WFDictionaryFieldValueItem
 		var value = itemValueMap["Value"].(map[string]interface{})
@@ -895,6 +1761,7 @@ func decompDictionaryItem(item WFDictionaryFieldValueItem) any {
 }
 
 func decompArray(items []interface{}) (array []interface{}) {
+	array = make([]interface{}, 0, len(items))
 	for _, item := range items {
 		if reflect.TypeOf(item).Kind() == reflect.Map {
 			var fieldValueItem WFDictionaryFieldValueItem
@@ -918,33 +1785,45 @@ func decompValue(value any) string {
 	case reflect.Map:
 		return decompValueObject(value.(map[string]interface{}))
 	case reflect.String:
-		return fmt.Sprintf("\"%s\"", escapeString(value.(string)))
+		return fmt.Sprintf("\"%s\"", escapeLiteralBraces(escapeString(value.(string))))
 	default:
 		return fmt.Sprintf("%v", value)
 	}
 }
 
+// stringEscaper escapes the characters of a string literal, backslashes are escaped so they are not read as escapes.
+var stringEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`, "\r", `\r`, `"`, `\"`)
+
 func escapeString(value string) string {
-	var escapes = map[string]string{
-		"\n": "\\n",
-		"\t": "\\t",
-		"\r": "\\r",
-		"\"": `\"`,
-	}
-	for chr, e := range escapes {
-		value = strings.ReplaceAll(value, chr, e)
-	}
+	return stringEscaper.Replace(value)
+}
 
-	return value
+var literalBraceEscaper = strings.NewReplacer("{", `\{`, "}", `\}`)
+
+// escapeLiteralBraces escapes braces in text so they are not parsed as inline variable references.
+func escapeLiteralBraces(value string) string {
+	return literalBraceEscaper.Replace(value)
 }
 
 func decompValueObject(value map[string]interface{}) string {
+	if len(value) == 0 {
+		// The compiler makes nil an empty value.
+		return "nil"
+	}
 	if v, found := value["Value"]; found {
 		if reflect.TypeOf(v).Kind() == reflect.Map {
 			value = v.(map[string]interface{})
 		}
 	}
 
+	if value["Magnitude"] != nil && value["Unit"] != nil {
+		return decompQuantity(value)
+	}
+
+	if value["WFColorRepresentationType"] != nil {
+		return decompColor(value)
+	}
+
 	if value["WFDictionaryFieldValueItems"] != nil {
 		var items []WFDictionaryFieldValueItem
 		mapToStruct(value["WFDictionaryFieldValueItems"], &items)
@@ -956,9 +1835,13 @@ func decompValueObject(value map[string]interface{}) string {
 	case "Variable":
 		if _, found := value["VariableName"]; found {
 			var variableName = value["VariableName"].(string)
+			if global, isGlobal := variableGlobal(variableName); isGlobal {
+				return decompReferenceAggrandizements(global, value)
+			}
+			unscopeIdentifier(&variableName)
 			sanitizeIdentifier(&variableName)
 
-			return fmt.Sprintf("@%s", variableName)
+			return decompReferenceAggrandizements(fmt.Sprintf("@%s", variableName), value)
 		}
 
 		var variableValue = value["Variable"].(map[string]interface{})
@@ -980,12 +1863,86 @@ func decompValueObject(value map[string]interface{}) string {
 
 		return fmt.Sprintf("Ask: \"%s\"", value["Prompt"])
 	case globals[ShortcutInput].variableType:
-		return ShortcutInput
+		return decompReferenceAggrandizements(ShortcutInput, value)
+	default:
+		if global, isGlobal := typeGlobal(value["Type"]); isGlobal {
+			return decompReferenceAggrandizements(global, value)
+		}
 	}
 
 	return decompObjectValue(value)
 }
 
+// decompQuantity decompiles a quantity as a duration literal if it is a number of hours, minutes or seconds.
+func decompQuantity(quantity map[string]interface{}) string {
+	var magnitude, literalMagnitude = quantity["Magnitude"].(string)
+	if unit, isString := quantity["Unit"].(string); isString && literalMagnitude {
+		if _, isDuration := durationUnits[unit]; isDuration && durationLiteralRegex.MatchString(magnitude+unit) {
+			return magnitude + unit
+		}
+	}
+
+	return fmt.Sprintf("qty(%s, %s)", strings.Trim(decompValue(quantity["Magnitude"]), "\""), decompValue(quantity["Unit"]))
+}
+
+// decompColor decompiles a color, components that are not set are 0.
+func decompColor(color map[string]interface{}) string {
+	var components []string
+	for _, component := range []string{"redComponent", "greenComponent", "blueComponent", "alphaComponent"} {
+		var value float64
+		switch number := color[component].(type) {
+		case float64:
+			value = number
+		case uint64:
+			value = float64(number)
+		case int64:
+			value = float64(number)
+		}
+		var literal = strconv.FormatFloat(value, 'f', -1, 64)
+		if !strings.Contains(literal, ".") {
+			literal += ".0"
+		}
+		components = append(components, literal)
+	}
+
+	return fmt.Sprintf("color(%s)", strings.Join(components, ", "))
+}
+
+// variableGlobal returns the global that references the variable named variableName (e.g. Repeat Index → RepeatIndex).
+func variableGlobal(variableName string) (string, bool) {
+	for name, global := range globals {
+		if global.variableType == "Variable" && global.value == variableName {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// typeGlobal returns the name of the global that is referenced by the variable type valueType, such as the clipboard.
+func typeGlobal(valueType any) (string, bool) {
+	for name, global := range globals {
+		if global.variableType != "Variable" && global.variableType == valueType {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// decompReferenceAggrandizements adds the dictionary key, property and coercion of value to reference.
+func decompReferenceAggrandizements(reference string, value map[string]interface{}) string {
+	if value["Aggrandizements"] == nil {
+		return reference
+	}
+
+	var aggrandizements []Aggrandizement
+	mapToStruct(value["Aggrandizements"], &aggrandizements)
+	decompAggrandizements(&reference, aggrandizements)
+
+	return reference
+}
+
 func decompObjectValue(valueObj any) string {
 	var valueType = reflect.TypeOf(valueObj).Kind()
 	if valueType != reflect.Map {
@@ -1024,12 +1981,23 @@ func decompObjectValue(valueObj any) string {
 func decompAttachmentString(attachmentString *string, attachments map[string]interface{}) {
 	var originalString = *attachmentString
 	var attachmentChars = strings.Split(*attachmentString, "")
+	var attachedType tokenType
+
+	// Attachment positions are in UTF-16 code units, characters outside the BMP take up two.
+	var charPositions = make(map[int]int, len(attachmentChars))
+	var utf16Position int
+	for i, chr := range attachmentChars {
+		charPositions[utf16Position] = i
+		utf16Position += len(utf16.Encode([]rune(chr)))
+		attachmentChars[i] = escapeLiteralBraces(escapeString(chr))
+	}
 
 	for attachmentRange, a := range attachments {
 		var attachmentRanges = strings.Split(attachmentRange, ",")
 		var attachmentPosition = strings.TrimPrefix(attachmentRanges[0], "{")
-		var position, convErr = strconv.Atoi(attachmentPosition)
+		var utf16Offset, convErr = strconv.Atoi(attachmentPosition)
 		handle(convErr)
+		var position = charPositions[utf16Offset]
 
 		var attachment Value
 		mapToStruct(a, &attachment)
@@ -1038,17 +2006,26 @@ func decompAttachmentString(attachmentString *string, attachments map[string]int
 		if _, uuid := uuids[attachment.OutputUUID]; uuid {
 			variableName = uuids[attachment.OutputUUID]
 		}
+		unscopeIdentifier(&variableName)
 		sanitizeIdentifier(&variableName)
 		if variableName == "" && attachment.Type == globals[ShortcutInput].variableType {
 			variableName = ShortcutInput
 		}
 		if attachment.Type != "Variable" {
+			attachedType = decompLiteralOutputType(attachment.OutputUUID)
+			// The output of a control flow statement can only be referenced in text.
+			if index, found := decompOutputActions[attachment.OutputUUID]; found && controlFlowAction(&shortcut.WFWorkflowActions[index]) {
+				attachedType = Variable
+			}
 			for name, global := range globals {
 				if global.variableType == attachment.Type {
 					variableName = name
 				}
 			}
+		} else if global, isGlobal := variableGlobal(attachment.VariableName); isGlobal {
+			variableName = global
 		} else {
+			attachedType = decompVariableTypes[variableName]
 			variableName = fmt.Sprintf("@%s", variableName)
 		}
 
@@ -1059,10 +2036,10 @@ func decompAttachmentString(attachmentString *string, attachments map[string]int
 		attachmentChars[position] = fmt.Sprintf("{%s}", variableName)
 	}
 
-	*attachmentString = escapeString(strings.Join(attachmentChars, ""))
+	*attachmentString = strings.Join(attachmentChars, "")
 
 	if !decompilingDictionary && !decompilingText {
-		if originalString == ObjectReplaceCharStr {
+		if originalString == ObjectReplaceCharStr && !typedAttachment(attachedType) {
 			*attachmentString = strings.Trim(*attachmentString, "{}")
 		} else if !strings.Contains("\"", *attachmentString) {
 			*attachmentString = fmt.Sprintf("\"%s\"", *attachmentString)
@@ -1070,6 +2047,11 @@ func decompAttachmentString(attachmentString *string, attachments map[string]int
 	}
 }
 
+// typedAttachment returns true if a variable of valueType needs to stay in text to be used as text.
+func typedAttachment(valueType tokenType) bool {
+	return valueType != "" && valueType != String
+}
+
 func decompAggrandizements(reference *string, aggrs []Aggrandizement) {
 	var index string
 	var coerce string
@@ -1078,7 +2060,7 @@ func decompAggrandizements(reference *string, aggrs []Aggrandizement) {
 		switch aggr.Type {
 		case "WFCoercionVariableAggrandizement":
 			if _, found := revContentItems[aggr.CoercionItemClass]; found {
-				coerce = revContentItems[coerce]
+				coerce = revContentItems[aggr.CoercionItemClass]
 			}
 		case "WFDictionaryValueVariableAggrandizement":
 			index = aggr.DictionaryKey
@@ -1090,7 +2072,7 @@ func decompAggrandizements(reference *string, aggrs []Aggrandizement) {
 	if index != "" {
 		*reference = fmt.Sprintf("%s['%s']", *reference, index)
 	}
-	if index != "" && coerce != "" {
+	if coerce != "" {
 		*reference = fmt.Sprintf("%s.%s", *reference, coerce)
 	}
 }
@@ -1111,7 +2093,11 @@ func decompAction(action *ShortcutAction) {
 	}
 
 	currentVariableValue = makeActionCallCode(action)
+	decompActionOutput(action)
+}
 
+// decompActionOutput writes the current variable value as a constant or on its own line, unless it is assigned to a variable.
+func decompActionOutput(action *ShortcutAction) {
 	var isConstant, isVariableValue = checkOutputType(action)
 	if isConstant && isVariableValue {
 		makeConstantLiteral(action)
@@ -1136,6 +2122,17 @@ func makeActionCallCode(action *ShortcutAction) string {
 			return actionCallCode.String()
 		}
 	}
+	if matchedAction.decompMatch != nil && !matchedAction.decompMatch(action.WFWorkflowActionParameters) {
+		if !includeSplitActions(action.WFWorkflowActionIdentifier) {
+			actionCallCode.WriteString(makeRawAction(action))
+			return actionCallCode.String()
+		}
+		matchedIdentifier, matchedAction = matchAction(action)
+	}
+	if undefinedParameters(action, &matchedAction) {
+		actionCallCode.WriteString(makeRawAction(action))
+		return actionCallCode.String()
+	}
 
 	if (matchedAction.macOnly || matchedAction.nonMacOnly) && !setMacDefinition {
 		macDefinition = matchedAction.macOnly && !matchedAction.nonMacOnly
@@ -1159,6 +2156,23 @@ func makeActionCallCode(action *ShortcutAction) string {
 	return actionCallCode.String()
 }
 
+// undefinedParameters returns true if none of the parameters of action are defined by definition,
+// so it is another action with the same identifier, such as an action defined by the Shortcut's source.
+func undefinedParameters(action *ShortcutAction, definition *actionDefinition) bool {
+	if definition.makeParams != nil || definition.decomp != nil || definition.appendParamsFunc != nil {
+		return false
+	}
+	var parameters int
+	for key := range action.WFWorkflowActionParameters {
+		if !slices.Contains(coverageIgnoredParameters, key) {
+			parameters++
+		}
+	}
+	var unmatched = unmatchedParameters(action, definition)
+
+	return parameters != 0 && len(unmatched) == parameters
+}
+
 // checkOutputType determines if action output is a constant or a variable.
 // If it is a constant we will write a constant statement on a new line to prepend the action.
 func checkOutputType(action *ShortcutAction) (isConstant bool, isVariableValue bool) {
@@ -1188,9 +2202,9 @@ func skipDecompAction(action *ShortcutAction) bool {
 		return true
 	}
 
-	if identifier == "nothing" {
+	var controlflowActionIdentifiers = []string{"conditional", "repeat.each", "repeat.count", "choosefrommenu"}
+	if identifier == "nothing" && actionIndex+1 < len(shortcut.WFWorkflowActions) {
 		var nextAction = peekActions(1)
-		var controlflowActionIdentifiers = []string{"conditional", "repeat.each", "repeat.count", "choosefrommenu"}
 		var nextActionIdentifier = actionIdentifierEnd(nextAction.WFWorkflowActionIdentifier)
 		if slices.Contains(controlflowActionIdentifiers, nextActionIdentifier) {
 			var controlFlowMode = nextAction.WFWorkflowActionParameters["WFControlFlowMode"]
@@ -1200,6 +2214,23 @@ func skipDecompAction(action *ShortcutAction) bool {
 		}
 	}
 
+	// The compiler adds nothing before setting a variable to nothing.
+	if identifier == "nothing" && actionIndex+1 < len(shortcut.WFWorkflowActions) {
+		var nextAction = peekActions(1)
+		if nextAction.WFWorkflowActionIdentifier == SetVariableIdentifier && nextAction.WFWorkflowActionParameters["WFInput"] == nil {
+			return true
+		}
+	}
+
+	// The compiler adds nothing after the end of every statement.
+	if identifier == "nothing" && actionIndex > 0 {
+		var previousAction = peekActions(-1)
+		var previousActionIdentifier = actionIdentifierEnd(previousAction.WFWorkflowActionIdentifier)
+		if slices.Contains(controlflowActionIdentifiers, previousActionIdentifier) && previousAction.WFWorkflowActionParameters["WFControlFlowMode"] == endStatement {
+			return true
+		}
+	}
+
 	return false
 }
 
@@ -1208,16 +2239,26 @@ func actionIdentifierEnd(identifier string) string {
 }
 
 func decompActionArguments(actionCallCode *strings.Builder, matchedAction *actionDefinition, action *ShortcutAction) {
+	// Optional arguments that are not set are only given as nil if an argument after them is set.
+	var unsetArguments []int
 	for i, param := range matchedAction.parameters {
 		if param.key == "" {
 			continue
 		}
 
 		var argValue string
-		if value, found := action.WFWorkflowActionParameters[param.key]; found {
+		if identifier, found := importQuestions[actionIndex][param.key]; found {
+			argValue = identifier
+		} else if identifier, found := decompReferences[actionIndex][param.key]; found {
+			argValue = identifier
+		} else if value, found := action.WFWorkflowActionParameters[param.key]; found {
 			argValue = decompValue(value)
-		} else if !param.optional {
-			argValue = makeDefaultValue(param)
+			if !param.ref && param.validType != Variable {
+				argValue = constantReference(argValue)
+			}
+		} else if !param.optional && param.defaultValue == nil {
+			// A required argument that is not set is given as nil, which the compiler leaves unset.
+			argValue = "nil"
 		}
 
 		switch param.validType {
@@ -1228,39 +2269,27 @@ func decompActionArguments(actionCallCode *strings.Builder, matchedAction *actio
 			argValue = strings.Trim(argValue, "\"")
 		}
 
-		if argValue != "" {
-			if i == 0 {
-				actionCallCode.WriteString(argValue)
-			} else {
-				actionCallCode.WriteString(fmt.Sprintf(", %s", argValue))
+		if argValue == "" {
+			if param.optional || param.defaultValue != nil {
+				unsetArguments = append(unsetArguments, i)
 			}
+			continue
 		}
-	}
-}
-
-func makeDefaultValue(param parameterDefinition) string {
-	if param.defaultValue != nil {
-		if reflect.TypeOf(param.defaultValue).Kind() == reflect.String {
-			return fmt.Sprintf("\"%s\"", param.defaultValue)
+		for _, unset := range unsetArguments {
+			writeActionArgument(actionCallCode, unset, "nil")
 		}
-
-		return fmt.Sprintf("%v", param.defaultValue)
+		unsetArguments = nil
+		writeActionArgument(actionCallCode, i, argValue)
 	}
+}
 
-	switch param.validType {
-	case Integer:
-		return "0"
-	case String:
-		return "\"\""
-	case Arr:
-		return "[]"
-	case Dict:
-		return "{}"
-	case Bool:
-		return "false"
+// writeActionArgument writes the argument for the parameter at index i of an action call.
+func writeActionArgument(actionCallCode *strings.Builder, i int, argValue string) {
+	if i == 0 {
+		actionCallCode.WriteString(argValue)
+	} else {
+		actionCallCode.WriteString(fmt.Sprintf(", %s", argValue))
 	}
-
-	return "nil"
 }
 
 func makeRawAction(action *ShortcutAction) string {
@@ -1322,12 +2351,12 @@ func matchAction(action *ShortcutAction) (name string, definition actionDefiniti
 		definition = *def
 		name = call
 
-		if splitActions, found := identifierMap[identifier]; found {
+		if splitActions, found := identifierMap[splitActionIdentifier(call, def)]; found {
 			matchSplitAction(&splitActions, action.WFWorkflowActionParameters, &name, &definition)
 			if name != "run" && name != "runSelf" {
 				return
 			}
-			var workflow = action.WFWorkflowActionParameters["WFWorkflow"].(map[string]interface{})
+			var workflow, _ = action.WFWorkflowActionParameters["WFWorkflow"].(map[string]interface{})
 			if _, isSelf := workflow["isSelf"]; !isSelf {
 				return
 			}
@@ -1345,9 +2374,10 @@ func matchAction(action *ShortcutAction) (name string, definition actionDefiniti
 }
 
 type actionMatch struct {
-	params uint
-	values uint
-	action actionValue
+	params    uint
+	values    uint
+	unmatched uint
+	action    actionValue
 }
 
 func matchSplitAction(splitActions *[]actionValue, parameters map[string]any, identifier *string, definition *actionDefinition) {
@@ -1372,19 +2402,25 @@ func matchSplitAction(splitActions *[]actionValue, parameters map[string]any, id
 	}
 
 	sort.SliceStable(matches, func(i, j int) bool {
-		return matches[i].params > matches[j].params || matches[i].values > matches[j].values
+		if matches[i].params != matches[j].params {
+			return matches[i].params > matches[j].params
+		}
+		if matches[i].values != matches[j].values {
+			return matches[i].values > matches[j].values
+		}
+		return matches[i].unmatched < matches[j].unmatched
 	})
 
 	if args.Using("debug") {
 		for _, match := range matches[0:] {
 			fmt.Printf("%s()\n", match.action.identifier)
-			fmt.Println("params:", match.params, " values:", match.values)
+			fmt.Println("params:", match.params, " values:", match.values, " unmatched:", match.unmatched)
 			fmt.Println("---")
 		}
 		fmt.Print("\n")
 	}
 
-	if !competingMatches(matches) {
+	if hasDefaultAction && !competingMatches(matches) && !outmatchedDefault(matches, defaultAction.identifier) {
 		if args.Using("debug") {
 			fmt.Println("matches are not competing! using default")
 		}
@@ -1392,26 +2428,48 @@ func matchSplitAction(splitActions *[]actionValue, parameters map[string]any, id
 	}
 
 	var matchedAction = matches[0]
+	// The default action is used if it matches as well as the best match.
+	for _, match := range matches {
+		if hasDefaultAction && match.action.identifier == defaultAction.identifier &&
+			match.params == matchedAction.params && match.values == matchedAction.values {
+			matchedAction = match
+		}
+	}
 	*identifier = matchedAction.action.identifier
 	*definition = *matchedAction.action.definition
 }
 
 func getSplitActionMatches(splitActions *[]actionValue, parameters map[string]any) (matches []actionMatch) {
 	for _, splitAction := range *splitActions {
+		if splitAction.definition.decompMatch != nil && !splitAction.definition.decompMatch(parameters) {
+			continue
+		}
 		var matchedParams, matchedValues = scoreActionMatch(splitAction, splitAction.definition.parameters, parameters)
 		if matchedParams == 0 {
 			continue
 		}
 
 		matches = append(matches, actionMatch{
-			params: matchedParams,
-			values: matchedValues,
-			action: splitAction,
+			params:    matchedParams,
+			values:    matchedValues,
+			unmatched: unmatchedAppendParams(splitAction, parameters),
+			action:    splitAction,
 		})
 	}
 	return
 }
 
+// outmatchedDefault determines if the best of the sorted matches matches better than the default action,
+// or matches a value when the default action matches no parameters.
+func outmatchedDefault(matches []actionMatch, defaultIdentifier string) bool {
+	for _, match := range matches {
+		if match.action.identifier == defaultIdentifier {
+			return match.params < matches[0].params || match.values < matches[0].values
+		}
+	}
+	return matches[0].values > 0
+}
+
 // competingMatches determines if the matches for this identifier have more values than 1 matching this action.
 func competingMatches(matches []actionMatch) bool {
 	var hasCompetingValues bool
@@ -1438,13 +2496,11 @@ func scoreActionMatch(splitAction actionValue, splitActionParams []parameterDefi
 	matchedValues += valueMatches
 
 	var splitActionAddParams []parameterDefinition
-	if splitAction.definition.appendParamsFunc != nil {
-		for key, value := range splitAction.definition.appendParamsFunc([]actionArgument{}) {
-			splitActionAddParams = append(splitActionAddParams, parameterDefinition{
-				key:          key,
-				defaultValue: value,
-			})
-		}
+	for key, value := range actionAppendParams(splitAction) {
+		splitActionAddParams = append(splitActionAddParams, parameterDefinition{
+			key:          key,
+			defaultValue: value,
+		})
 	}
 
 	var addParamMatches, addValueMatches = scoreActionAddParams(&splitActionAddParams, parameters)
@@ -1454,6 +2510,29 @@ func scoreActionMatch(splitAction actionValue, splitActionParams []parameterDefi
 	return
 }
 
+// actionAppendParams returns the parameters the compiler always adds for splitAction.
+func actionAppendParams(splitAction actionValue) map[string]any {
+	var appendParams = maps.Clone(splitAction.definition.appendParams)
+	if splitAction.definition.appendParamsFunc != nil {
+		if appendParams == nil {
+			appendParams = make(map[string]any)
+		}
+		maps.Copy(appendParams, splitAction.definition.appendParamsFunc([]actionArgument{}))
+	}
+
+	return appendParams
+}
+
+// unmatchedAppendParams returns how many of the parameters the compiler always adds for splitAction are not in parameters.
+func unmatchedAppendParams(splitAction actionValue, parameters map[string]any) (unmatched uint) {
+	for key := range actionAppendParams(splitAction) {
+		if _, found := parameters[key]; !found {
+			unmatched++
+		}
+	}
+	return
+}
+
 func scoreActionParams(splitActionParams *[]parameterDefinition, parameters map[string]any) (matchedParams uint, matchedValues uint) {
 	for _, param := range *splitActionParams {
 		if param.key == "" {
@@ -0,0 +1,481 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Decompiling Functions
+
+Shortcuts compiled with functions begin with a header that runs the function named in the
+dictionary given as input. The body of each function is moved out of the header and its
+parameters are collected from the actions that assign its arguments to variables.
+
+Calls are a dictionary of the arguments given as input to a Run Shortcut action and an
+action to coerce its output to the output type of the function, these are replaced by the call.
+
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type decompFunction struct {
+	name       string
+	parameters []decompParameter
+	outputType string
+	start      int
+	end        int
+}
+
+type decompParameter struct {
+	name         string
+	valueType    string
+	defaultValue string
+}
+
+type decompFunctionCall struct {
+	function  *decompFunction
+	arguments ShortcutAction
+	// values are the arguments of a call to a function made from repeated actions.
+	values []string
+}
+
+var decompFunctions []*decompFunction
+
+// decompFunctionCalls are the calls to functions by the index of the action that outputs their result.
+var decompFunctionCalls map[int]decompFunctionCall
+
+// functionCallActions are the indexes of the actions that are replaced by a function call.
+var functionCallActions map[int]bool
+
+// decompBoolVariables are the variables given as bool arguments to functions.
+var decompBoolVariables map[string]bool
+
+var functionCallRegex = regexp.MustCompile(`^_(\w+)_cherri_call_\d+$`)
+
+const functionNameOutput = "_cherri_function_name"
+const functionArgumentCondition = 101
+
+// mapFunctions moves the bodies of functions out of the functions header and maps calls to them.
+func mapFunctions() {
+	decompFunctions = []*decompFunction{}
+	decompFunctionCalls = make(map[int]decompFunctionCall)
+	functionCallActions = make(map[int]bool)
+	decompBoolVariables = make(map[string]bool)
+
+	var headerEnd = functionsHeaderEnd()
+	if headerEnd == -1 {
+		return
+	}
+
+	var header = shortcut.WFWorkflowActions[:headerEnd+1]
+	var actions []ShortcutAction
+	for i := 0; i < len(header); i++ {
+		var name, isFunction = header[i].WFWorkflowActionParameters["WFConditionalActionString"].(string)
+		if !isFunction || !isStartStatement(&header[i]) || !referencesOutput(header[i].WFWorkflowActionParameters["WFInput"], functionNameOutput) {
+			continue
+		}
+
+		var end = controlFlowEnd(header, i)
+		var function = &decompFunction{name: name}
+		var body = mapFunctionParameters(function, header[i+1:end])
+
+		function.start = len(actions)
+		actions = append(actions, trimFunctionBody(body)...)
+		function.end = len(actions)
+
+		decompFunctions = append(decompFunctions, function)
+		i = end
+	}
+
+	shortcut.WFWorkflowActions = append(actions, shortcut.WFWorkflowActions[headerEnd+1:]...)
+
+	mapFunctionCalls()
+}
+
+// functionsHeaderEnd returns the index of the last action of the functions header, or -1 if there is no functions header.
+func functionsHeaderEnd() int {
+	var actions = shortcut.WFWorkflowActions
+	if len(actions) == 0 || actionIdentifierEnd(actions[0].WFWorkflowActionIdentifier) != "conditional" || !isStartStatement(&actions[0]) {
+		return -1
+	}
+	if decompValue(actions[0].WFWorkflowActionParameters["WFInput"]) != ShortcutInput {
+		return -1
+	}
+
+	var end = controlFlowEnd(actions, 0)
+	for _, action := range actions[:end] {
+		if action.WFWorkflowActionParameters["CustomOutputName"] == functionNameOutput {
+			if end+1 < len(actions) && actionIdentifierEnd(actions[end+1].WFWorkflowActionIdentifier) == "nothing" {
+				end++
+			}
+
+			return end
+		}
+	}
+
+	return -1
+}
+
+// mapFunctionParameters collects the parameters of function from the actions at the beginning of body and returns the rest of body.
+func mapFunctionParameters(function *decompFunction, body []ShortcutAction) []ShortcutAction {
+	var pos int
+	for pos < len(body) {
+		var argumentPrefix = fmt.Sprintf("_cherri_%s_arg_%d_", function.name, len(function.parameters)+1)
+		var argumentReference, _ = body[pos].WFWorkflowActionParameters["CustomOutputName"].(string)
+		if actionIdentifierEnd(body[pos].WFWorkflowActionIdentifier) != "getitemfromlist" || !strings.HasPrefix(argumentReference, argumentPrefix) || pos+3 >= len(body) {
+			break
+		}
+
+		var param = decompParameter{name: strings.TrimPrefix(argumentReference, argumentPrefix)}
+		var declaration = body[pos+1]
+		pos += 3
+
+		switch actionIdentifierEnd(declaration.WFWorkflowActionIdentifier) {
+		case "gettext":
+			param.valueType = "text"
+			pos += 2
+		case "number":
+			var outputName, _ = declaration.WFWorkflowActionParameters["CustomOutputName"].(string)
+			switch {
+			case strings.HasPrefix(outputName, "Float"):
+				param.valueType = "float"
+			case strings.HasPrefix(outputName, "Bool"):
+				param.valueType = "bool"
+			default:
+				param.valueType = "number"
+			}
+			pos += 2
+		case "dictionary":
+			param.valueType = "dictionary"
+			pos += 2
+		default:
+			if body[pos].WFWorkflowActionParameters["CustomOutputName"] == argumentReference+"_array_dictionary" {
+				param.valueType = "array"
+				pos = skipNothing(body, controlFlowEnd(body, pos+2)+1)
+			} else {
+				param.valueType = "variable"
+				pos++
+			}
+		}
+
+		if pos+1 < len(body) && isStartStatement(&body[pos]) &&
+			body[pos].WFWorkflowActionParameters["WFCondition"] == uint64(functionArgumentCondition) &&
+			referencesOutput(body[pos].WFWorkflowActionParameters["WFInput"], argumentReference) {
+			param.defaultValue = decompDefaultArgument(&body[pos+1], param.valueType)
+			pos = skipNothing(body, controlFlowEnd(body, pos)+1)
+		}
+
+		function.parameters = append(function.parameters, param)
+	}
+
+	if pos > len(body) {
+		pos = len(body)
+	}
+
+	return body[pos:]
+}
+
+func decompDefaultArgument(action *ShortcutAction, valueType string) string {
+	var params = action.WFWorkflowActionParameters
+	if actionIdentifierEnd(action.WFWorkflowActionIdentifier) == "gettext" {
+		return decompValue(params["WFTextActionText"])
+	}
+
+	var number = fmt.Sprintf("%v", params["WFNumberActionNumber"])
+	if valueType == "bool" {
+		return strconv.FormatBool(number == "1")
+	}
+
+	return number
+}
+
+// trimFunctionBody removes the actions added to the end of the body of a function when it was compiled.
+func trimFunctionBody(body []ShortcutAction) []ShortcutAction {
+	if len(body) != 0 && actionIdentifierEnd(body[len(body)-1].WFWorkflowActionIdentifier) == "nothing" {
+		body = body[:len(body)-1]
+	}
+	if len(body) == 0 {
+		return body
+	}
+
+	var last = body[len(body)-1]
+	if actionIdentifierEnd(last.WFWorkflowActionIdentifier) != "output" || last.WFWorkflowActionParameters["WFOutput"] != nil {
+		return body
+	}
+	for _, action := range body[:len(body)-1] {
+		if actionIdentifierEnd(action.WFWorkflowActionIdentifier) == "output" {
+			return body
+		}
+	}
+
+	return body[:len(body)-1]
+}
+
+// mapFunctionCalls maps the actions of each function call and the action that outputs its result.
+func mapFunctionCalls() {
+	var actions = shortcut.WFWorkflowActions
+	for i, action := range actions {
+		if actionIdentifierEnd(action.WFWorkflowActionIdentifier) != "dictionary" {
+			continue
+		}
+		var callName, _ = action.WFWorkflowActionParameters["CustomOutputName"].(string)
+		var matches = functionCallRegex.FindStringSubmatch(callName)
+		if matches == nil {
+			continue
+		}
+		var function = findDecompFunction(matches[1])
+		if function == nil {
+			continue
+		}
+
+		var result = i + 1
+		var outputName = callName + "_output"
+		var hasOutput = result < len(actions) && actions[result].WFWorkflowActionParameters["CustomOutputName"] == outputName
+		if hasOutput {
+			result++
+		}
+		if result >= len(actions) {
+			continue
+		}
+
+		var resultIdentifier = actionIdentifierEnd(actions[result].WFWorkflowActionIdentifier)
+		var resultParams = actions[result].WFWorkflowActionParameters
+		switch {
+		case resultIdentifier == "runworkflow" && referencesOutput(resultParams["WFInput"], callName):
+			if hasOutput && function.outputType == "" {
+				function.outputType = "variable"
+			}
+		case hasOutput && referencesOutput(resultParams, outputName):
+			switch resultIdentifier {
+			case "gettext":
+				function.outputType = "text"
+			case "number":
+				function.outputType = "number"
+			case "detect.dictionary":
+				function.outputType = "dictionary"
+			}
+		default:
+			continue
+		}
+
+		for callAction := i; callAction < result; callAction++ {
+			functionCallActions[callAction] = true
+		}
+		decompFunctionCalls[result] = decompFunctionCall{
+			function:  function,
+			arguments: action,
+		}
+		mapBoolArguments(function, &action)
+	}
+}
+
+// mapBoolArguments maps the variables given as bool arguments in the call to function,
+// as bools are set to variables using number actions and would be decompiled as numbers.
+func mapBoolArguments(function *decompFunction, call *ShortcutAction) {
+	var items, _ = call.WFWorkflowActionParameters["WFItems"].(map[string]interface{})
+	var itemsValue, _ = items["Value"].(map[string]interface{})
+	var fieldItems, _ = itemsValue["WFDictionaryFieldValueItems"].([]interface{})
+	for _, fieldItem := range fieldItems {
+		var item, _ = fieldItem.(map[string]interface{})
+		if decompValue(item["WFKey"]) != "arguments" {
+			continue
+		}
+		var argumentsValue, _ = item["WFValue"].(map[string]interface{})
+		var arguments, _ = argumentsValue["Value"].([]interface{})
+		for i, argument := range arguments {
+			if i >= len(function.parameters) || function.parameters[i].valueType != "bool" {
+				continue
+			}
+			var argumentItem, _ = argument.(map[string]interface{})
+			var argumentValue, _ = argumentItem["WFValue"].(map[string]interface{})
+			var text, _ = argumentValue["Value"].(map[string]interface{})
+			var attachments, _ = text["attachmentsByRange"].(map[string]interface{})
+			if text["string"] != ObjectReplaceCharStr || len(attachments) != 1 {
+				continue
+			}
+			for _, attachment := range attachments {
+				var variable, _ = attachment.(map[string]interface{})
+				var variableName, isVariable = variable["VariableName"].(string)
+				if variable["Type"] == "Variable" && isVariable {
+					sanitizeIdentifier(&variableName)
+					decompBoolVariables[variableName] = true
+				}
+			}
+		}
+	}
+}
+
+func findDecompFunction(name string) *decompFunction {
+	for _, function := range decompFunctions {
+		if function.name == name {
+			return function
+		}
+	}
+
+	return nil
+}
+
+// decompFunctionBoundaries writes the declaration of each function whose body starts at the current action
+// and closes each function whose body ends at the current action.
+func decompFunctionBoundaries() {
+	for _, function := range decompFunctions {
+		if function.start == actionIndex {
+			newCodeLine(fmt.Sprintf("function %s(%s)", function.name, decompFunctionParameters(function)))
+			if function.outputType != "" {
+				code.WriteString(fmt.Sprintf(": %s", function.outputType))
+			}
+			code.WriteString(" {\n")
+			tabLevel++
+
+			for _, param := range function.parameters {
+				decompVariableTypes[param.name] = tokenType(param.valueType)
+			}
+		}
+		if function.end == actionIndex {
+			if tabLevel > 0 {
+				tabLevel--
+			}
+			newCodeLine("}\n\n")
+		}
+	}
+}
+
+func decompFunctionParameters(function *decompFunction) string {
+	var params []string
+	for _, param := range function.parameters {
+		var definition = fmt.Sprintf("%s %s", param.valueType, param.name)
+		if param.defaultValue != "" {
+			definition += fmt.Sprintf(" = %s", param.defaultValue)
+		}
+		params = append(params, definition)
+	}
+
+	return strings.Join(params, ", ")
+}
+
+// decompFunctionCallAction writes the function call for the action that outputs its result,
+// returns true if action is part of a function call.
+func decompFunctionCallAction(action *ShortcutAction) bool {
+	if functionCallActions[actionIndex] {
+		return true
+	}
+	var call, found = decompFunctionCalls[actionIndex]
+	if !found {
+		return false
+	}
+
+	if call.values != nil {
+		currentVariableValue = fmt.Sprintf("%s(%s)", call.function.name, strings.Join(call.values, ", "))
+		decompActionOutput(action)
+		return true
+	}
+
+	var params DictionaryActionParameters
+	mapToStruct(call.arguments.WFWorkflowActionParameters, &params)
+
+	decompilingDictionary = true
+	var arguments, _ = decompDictionaryItems(params.WFItems.Value.WFDictionaryFieldValueItems)["arguments"].([]interface{})
+	decompilingDictionary = false
+
+	var argumentsCode []string
+	for i, argument := range arguments {
+		var valueType string
+		if i < len(call.function.parameters) {
+			valueType = call.function.parameters[i].valueType
+		}
+		argumentsCode = append(argumentsCode, decompFunctionArgument(argument, valueType))
+	}
+
+	currentVariableValue = fmt.Sprintf("%s(%s)", call.function.name, strings.Join(argumentsCode, ", "))
+	decompActionOutput(action)
+
+	return true
+}
+
+func decompFunctionArgument(argument any, valueType string) string {
+	if arrayArgument, isMap := argument.(map[string]interface{}); isMap && len(arrayArgument) == 1 && arrayArgument["array"] != nil {
+		argument = arrayArgument["array"]
+	}
+
+	switch value := argument.(type) {
+	case string:
+		if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") && !strings.ContainsAny(value[1:len(value)-1], "{}") {
+			return value[1 : len(value)-1]
+		}
+		if valueType == "number" || valueType == "float" {
+			if _, numberErr := strconv.ParseFloat(value, 64); numberErr == nil {
+				return value
+			}
+		}
+
+		return fmt.Sprintf("\"%s\"", value)
+	case bool, int64:
+		return fmt.Sprintf("%v", value)
+	default:
+		var jsonBytes, jsonErr = json.Marshal(value)
+		handle(jsonErr)
+
+		return string(jsonBytes)
+	}
+}
+
+// controlFlowEnd returns the index of the action that ends the control flow statement started at start.
+// Statements are paired by their depth, as grouping identifiers derived using --derive-uuids can be the same.
+func controlFlowEnd(actions []ShortcutAction, start int) int {
+	var depth int
+	for i := start + 1; i < len(actions); i++ {
+		switch actions[i].WFWorkflowActionParameters["WFControlFlowMode"] {
+		case startStatement:
+			depth++
+		case endStatement:
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+
+	return len(actions) - 1
+}
+
+func isStartStatement(action *ShortcutAction) bool {
+	return action.WFWorkflowActionParameters["WFControlFlowMode"] == startStatement
+}
+
+func skipNothing(actions []ShortcutAction, pos int) int {
+	if pos < len(actions) && actionIdentifierEnd(actions[pos].WFWorkflowActionIdentifier) == "nothing" {
+		return pos + 1
+	}
+
+	return pos
+}
+
+// referencesOutput returns true if value contains a reference to the output named outputName.
+func referencesOutput(value any, outputName string) bool {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if value["OutputName"] == outputName {
+			return true
+		}
+		for _, item := range value {
+			if referencesOutput(item, outputName) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if referencesOutput(item, outputName) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
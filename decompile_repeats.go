@@ -0,0 +1,712 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Repeated Actions
+
+Sequences of actions that are repeated in the Shortcut are found by comparing the actions with their UUIDs,
+output names, variable names and input values removed.
+
+Repeated sequences that are the same are written once as a copy block and pasted at each occurrence.
+Repeated sequences that only differ in their input values and do not depend on anything outside of them
+are made into a function with the input values as arguments, which is called at each occurrence.
+
+Repeated sequences are reported with the number of actions that would be removed, and only replaced using --import-dedupe.
+
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/electrikmilk/args-parser"
+)
+
+const minRepeatedActions = 3
+
+type repeatKind int
+
+const (
+	repeatSuggestion repeatKind = iota
+	repeatCopy
+	repeatFunction
+)
+
+type repeatedActions struct {
+	starts []int
+	length int
+	name   string
+	kind   repeatKind
+	reason string
+	params []repeatParameter
+}
+
+// repeatParameter is an input value that differs between repeated actions, by the offset of its action and its parameter key.
+type repeatParameter struct {
+	action    int
+	key       string
+	valueType string
+}
+
+type decompCopyBlock struct {
+	name  string
+	start int
+	end   int
+}
+
+var decompCopyBlocks []decompCopyBlock
+
+// pasteActions are the copy blocks pasted by the index of the action that replaced the repeated actions.
+var pasteActions map[int]string
+
+var repeatVariables = []string{"Repeat Item", "Repeat Index"}
+
+// mapRepeatedActions reports repeated sequences of actions after the function bodies and replaces them using --import-dedupe.
+func mapRepeatedActions() {
+	decompCopyBlocks = []decompCopyBlock{}
+	pasteActions = make(map[int]string)
+
+	var mainStart int
+	for _, function := range decompFunctions {
+		mainStart = max(mainStart, function.end)
+	}
+
+	var repeats = findRepeatedActions(shortcut.WFWorkflowActions, mainStart)
+	if len(repeats) == 0 {
+		return
+	}
+
+	var refactor = args.Using("import-dedupe")
+	printRepeatedActions(repeats, refactor)
+	if refactor {
+		replaceRepeatedActions(repeats, mainStart)
+	}
+}
+
+// findRepeatedActions finds the repeated sequences of actions after start that remove the most actions.
+func findRepeatedActions(actions []ShortcutAction, start int) (repeats []*repeatedActions) {
+	var shapes = actionShapes(actions[start:])
+	for i := range shapes {
+		if _, isCall := decompFunctionCalls[start+i]; isCall || functionCallActions[start+i] {
+			shapes[i] = -(i + 1)
+		}
+	}
+	var groups = make(map[string]*repeatedActions)
+	var size = len(shapes)
+
+	// Lengths of the longest common sequences starting at each pair of actions, from the previous row.
+	var prefixes = make([]int, size+1)
+	for i := size - 1; i >= 0; i-- {
+		var row = make([]int, size+1)
+		for j := size - 1; j > i; j-- {
+			if shapes[i] != shapes[j] {
+				continue
+			}
+			row[j] = prefixes[j+1] + 1
+			if row[j] < minRepeatedActions || (i > 0 && shapes[i-1] == shapes[j-1]) {
+				continue
+			}
+
+			var length = balancedActionsLength(actions[start+i:], min(row[j], j-i))
+			if length < minRepeatedActions {
+				continue
+			}
+
+			var key = fmt.Sprint(shapes[i : i+length])
+			if groups[key] == nil {
+				groups[key] = &repeatedActions{length: length}
+			}
+			groups[key].starts = append(groups[key].starts, start+i, start+j)
+		}
+		prefixes = row
+	}
+
+	var candidates []*repeatedActions
+	for _, group := range groups {
+		group.starts = nonOverlappingStarts(group.starts, group.length, nil)
+		if len(group.starts) < 2 {
+			continue
+		}
+		classifyRepeatedActions(actions, group)
+		candidates = append(candidates, group)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		var a, b = candidates[i], candidates[j]
+		if (a.kind == repeatSuggestion) != (b.kind == repeatSuggestion) {
+			return a.kind != repeatSuggestion
+		}
+		if a.removedActions() != b.removedActions() {
+			return a.removedActions() > b.removedActions()
+		}
+		return a.starts[0] < b.starts[0]
+	})
+
+	var used = make([]bool, len(actions))
+	for _, candidate := range candidates {
+		candidate.starts = nonOverlappingStarts(candidate.starts, candidate.length, used)
+		if len(candidate.starts) < 2 {
+			continue
+		}
+		classifyRepeatedActions(actions, candidate)
+		for _, occurrence := range candidate.starts {
+			for i := occurrence; i < occurrence+candidate.length; i++ {
+				used[i] = true
+			}
+		}
+		repeats = append(repeats, candidate)
+	}
+
+	sort.Slice(repeats, func(i, j int) bool {
+		return repeats[i].starts[0] < repeats[j].starts[0]
+	})
+	nameRepeatedActions(repeats)
+
+	return
+}
+
+func (repeat *repeatedActions) removedActions() int {
+	return (len(repeat.starts) - 1) * repeat.length
+}
+
+// actionShapes returns an identifier for each action that is the same for actions that only differ in
+// their UUIDs, output names, variable names and input values.
+func actionShapes(actions []ShortcutAction) []int {
+	var shapeIDs = make(map[string]int)
+	var shapes = make([]int, len(actions))
+	for i, action := range actions {
+		var params = make(map[string]any)
+		for key, value := range action.WFWorkflowActionParameters {
+			switch value.(type) {
+			case string, int64, uint64, float64, bool:
+				if key != "WFControlFlowMode" {
+					value = nil
+				}
+			}
+			params[key] = value
+		}
+
+		var shape, shapeErr = json.Marshal([]any{action.WFWorkflowActionIdentifier, actionShape(params)})
+		handle(shapeErr)
+
+		var id, found = shapeIDs[string(shape)]
+		if !found {
+			id = len(shapeIDs)
+			shapeIDs[string(shape)] = id
+		}
+		shapes[i] = id
+	}
+
+	return shapes
+}
+
+func actionShape(value any) any {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		var shape = make(map[string]any, len(value))
+		for key, item := range value {
+			switch key {
+			case UUID, "CustomOutputName", "GroupingIdentifier", "OutputUUID", "OutputName":
+				continue
+			case "VariableName", "WFVariableName":
+				shape[key] = ""
+			default:
+				shape[key] = actionShape(item)
+			}
+		}
+		return shape
+	case []interface{}:
+		var shape = make([]any, len(value))
+		for i, item := range value {
+			shape[i] = actionShape(item)
+		}
+		return shape
+	}
+
+	return value
+}
+
+// balancedActionsLength returns the length of the longest sequence of at most length actions that does not
+// start or end in the middle of a control flow statement.
+func balancedActionsLength(actions []ShortcutAction, length int) (balanced int) {
+	var depth int
+	for i, action := range actions[:length] {
+		switch action.WFWorkflowActionParameters["WFControlFlowMode"] {
+		case startStatement:
+			depth++
+		case statementPart:
+			if depth == 0 {
+				return
+			}
+		case endStatement:
+			depth--
+			if depth < 0 {
+				return
+			}
+		}
+		if depth == 0 {
+			balanced = i + 1
+		}
+	}
+
+	for balanced > 0 && actionIdentifierEnd(actions[balanced-1].WFWorkflowActionIdentifier) == "nothing" {
+		balanced--
+	}
+
+	return
+}
+
+// nonOverlappingStarts returns the sorted starts of sequences of length actions that do not overlap each other or the used actions.
+func nonOverlappingStarts(starts []int, length int, used []bool) (nonOverlapping []int) {
+	slices.Sort(starts)
+	starts = slices.Compact(starts)
+
+	var end = -1
+	for _, start := range starts {
+		if start < end || (used != nil && slices.Contains(used[start:start+length], true)) {
+			continue
+		}
+		nonOverlapping = append(nonOverlapping, start)
+		end = start + length
+	}
+
+	return
+}
+
+// classifyRepeatedActions determines if the repeated actions can be replaced by a copy block or a function.
+func classifyRepeatedActions(actions []ShortcutAction, repeat *repeatedActions) {
+	repeat.kind = repeatSuggestion
+	repeat.params = nil
+
+	var references = outputReferences(actions)
+	var first = repeat.starts[0]
+	var firstActions = canonicalActions(actions, first, repeat.length)
+	var differences = make(map[repeatParameter]bool)
+	var outputsUsed, usedAfter, usesOutside bool
+	for _, start := range repeat.starts {
+		var blockActions = canonicalActions(actions, start, repeat.length)
+		for i := range repeat.length {
+			if !compareRepeatedAction(firstActions[i], blockActions[i], i, differences) {
+				repeat.reason = "the actions differ in more than their input values"
+				return
+			}
+		}
+
+		for _, action := range actions[start : start+repeat.length] {
+			var uuid, _ = action.WFWorkflowActionParameters[UUID].(string)
+			for _, reference := range references[uuid] {
+				outputsUsed = true
+				if reference < start || reference >= start+repeat.length {
+					usedAfter = true
+				}
+			}
+		}
+		usesOutside = usesOutside || dependsOnOutside(actions[start:start+repeat.length])
+	}
+
+	if len(differences) == 0 && !outputsUsed {
+		repeat.kind = repeatCopy
+		return
+	}
+
+	switch {
+	case usedAfter:
+		repeat.reason = "outputs of the actions are used after them"
+	case usesOutside:
+		repeat.reason = "the actions use variables or outputs from outside of them"
+	case len(differences) == 0:
+		repeat.kind = repeatFunction
+	default:
+		for difference := range differences {
+			var action = actions[first+difference.action]
+			difference.valueType = inputValueType(&action, difference.key)
+			if difference.valueType == "" {
+				repeat.reason = "the actions differ in options that are not input values"
+				repeat.params = nil
+				return
+			}
+			repeat.params = append(repeat.params, difference)
+		}
+		sort.Slice(repeat.params, func(i, j int) bool {
+			var a, b = repeat.params[i], repeat.params[j]
+			if a.action != b.action {
+				return a.action < b.action
+			}
+			return a.key < b.key
+		})
+		repeat.kind = repeatFunction
+	}
+}
+
+// canonicalActions returns the actions of a sequence with their UUIDs replaced by their position in the sequence.
+func canonicalActions(actions []ShortcutAction, start int, length int) (canonical []ShortcutAction) {
+	var positions = make(map[string]string)
+	var groupings = make(map[string]string)
+	for i, action := range actions[start : start+length] {
+		if uuid, ok := action.WFWorkflowActionParameters[UUID].(string); ok {
+			positions[uuid] = fmt.Sprintf("#%d", i)
+		}
+		if grouping, ok := action.WFWorkflowActionParameters["GroupingIdentifier"].(string); ok && groupings[grouping] == "" {
+			groupings[grouping] = fmt.Sprintf("#%d", i)
+		}
+	}
+
+	for _, action := range actions[start : start+length] {
+		var params = canonicalValue(action.WFWorkflowActionParameters, positions).(map[string]any)
+		delete(params, UUID)
+		delete(params, "CustomOutputName")
+		if grouping, ok := action.WFWorkflowActionParameters["GroupingIdentifier"].(string); ok {
+			params["GroupingIdentifier"] = groupings[grouping]
+		}
+		canonical = append(canonical, ShortcutAction{
+			WFWorkflowActionIdentifier: action.WFWorkflowActionIdentifier,
+			WFWorkflowActionParameters: params,
+		})
+	}
+
+	return
+}
+
+func canonicalValue(value any, positions map[string]string) any {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		var canonical = make(map[string]any, len(value))
+		for key, item := range value {
+			if key == "OutputName" {
+				continue
+			}
+			canonical[key] = canonicalValue(item, positions)
+		}
+		return canonical
+	case []interface{}:
+		var canonical = make([]any, len(value))
+		for i, item := range value {
+			canonical[i] = canonicalValue(item, positions)
+		}
+		return canonical
+	case string:
+		if position, found := positions[value]; found {
+			return position
+		}
+	}
+
+	return value
+}
+
+// compareRepeatedAction returns true if the actions only differ in input values, which are added to differences.
+func compareRepeatedAction(a ShortcutAction, b ShortcutAction, offset int, differences map[repeatParameter]bool) bool {
+	if a.WFWorkflowActionIdentifier != b.WFWorkflowActionIdentifier || len(a.WFWorkflowActionParameters) != len(b.WFWorkflowActionParameters) {
+		return false
+	}
+	for key, value := range a.WFWorkflowActionParameters {
+		var otherValue, found = b.WFWorkflowActionParameters[key]
+		if !found {
+			return false
+		}
+		if reflect.DeepEqual(value, otherValue) {
+			continue
+		}
+		if !isInputValue(value) || !isInputValue(otherValue) {
+			return false
+		}
+		differences[repeatParameter{action: offset, key: key}] = true
+	}
+
+	return true
+}
+
+func isInputValue(value any) bool {
+	switch value.(type) {
+	case string, int64, uint64, float64:
+		return true
+	}
+
+	return false
+}
+
+// inputValueType returns the type of the parameter of action with key if it is a text or number input, otherwise an empty string.
+func inputValueType(action *ShortcutAction, key string) string {
+	var identifier, definition = matchAction(action)
+	if identifier == "" {
+		checkMissingStandardInclude(&action.WFWorkflowActionIdentifier, false)
+		identifier, definition = matchAction(action)
+	}
+
+	for _, param := range definition.parameters {
+		if param.key != key || param.enum != "" {
+			continue
+		}
+		switch param.validType {
+		case String:
+			return "text"
+		case Integer:
+			return "number"
+		case Float:
+			return "float"
+		}
+	}
+
+	return ""
+}
+
+// dependsOnOutside returns true if actions set variables or use variables, the Shortcut input or outputs of other actions.
+func dependsOnOutside(actions []ShortcutAction) bool {
+	var outputs []string
+	var hasRepeat bool
+	for _, action := range actions {
+		switch actionIdentifierEnd(action.WFWorkflowActionIdentifier) {
+		case "setvariable", "appendvariable", "output", "exit":
+			return true
+		case "repeat.each", "repeat.count":
+			hasRepeat = true
+		}
+		if uuid, ok := action.WFWorkflowActionParameters[UUID].(string); ok {
+			outputs = append(outputs, uuid)
+		}
+	}
+
+	var dependsOnOutside bool
+	for _, action := range actions {
+		walkValues(action.WFWorkflowActionParameters, func(value map[string]interface{}) {
+			if uuid, ok := value["OutputUUID"].(string); ok && !slices.Contains(outputs, uuid) {
+				dependsOnOutside = true
+			}
+			switch value["Type"] {
+			case "Variable":
+				var name, _ = value["VariableName"].(string)
+				if name != "" && (!hasRepeat || !slices.Contains(repeatVariables, name)) {
+					dependsOnOutside = true
+				}
+			case "ExtensionInput":
+				dependsOnOutside = true
+			}
+		})
+	}
+
+	return dependsOnOutside
+}
+
+// outputReferences returns the indexes of the actions that reference each action output UUID.
+func outputReferences(actions []ShortcutAction) map[string][]int {
+	var references = make(map[string][]int)
+	for i, action := range actions {
+		walkValues(action.WFWorkflowActionParameters, func(value map[string]interface{}) {
+			if uuid, ok := value["OutputUUID"].(string); ok {
+				references[uuid] = append(references[uuid], i)
+			}
+		})
+	}
+
+	return references
+}
+
+func walkValues(value any, visit func(value map[string]interface{})) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		visit(value)
+		for _, item := range value {
+			walkValues(item, visit)
+		}
+	case []interface{}:
+		for _, item := range value {
+			walkValues(item, visit)
+		}
+	}
+}
+
+func nameRepeatedActions(repeats []*repeatedActions) {
+	var blockIdx int
+	for _, repeat := range repeats {
+		if repeat.kind == repeatSuggestion {
+			continue
+		}
+		for {
+			blockIdx++
+			repeat.name = fmt.Sprintf("block%d", blockIdx)
+			if findDecompFunction(repeat.name) == nil {
+				break
+			}
+		}
+	}
+}
+
+func printRepeatedActions(repeats []*repeatedActions, refactored bool) {
+	var removed int
+	fmt.Println(ansi("Repeated actions:", bold))
+	for _, repeat := range repeats {
+		var result string
+		switch repeat.kind {
+		case repeatCopy:
+			result = fmt.Sprintf("copy %s", repeat.name)
+		case repeatFunction:
+			result = fmt.Sprintf("function %s(%s)", repeat.name, strings.Join(repeatFunctionParameters(repeat), ", "))
+		default:
+			result = fmt.Sprintf("not replaced, %s", repeat.reason)
+		}
+		if repeat.kind != repeatSuggestion {
+			removed += repeat.removedActions()
+		}
+		fmt.Printf("- %d actions repeated %d times: %s\n", repeat.length, len(repeat.starts), result)
+	}
+
+	if refactored {
+		fmt.Printf("Removed %d of %d actions.\n\n", removed, len(shortcut.WFWorkflowActions))
+		return
+	}
+	fmt.Printf("Replacing them would remove %d of %d actions, use --import-dedupe to replace them.\n\n", removed, len(shortcut.WFWorkflowActions))
+}
+
+func repeatFunctionParameters(repeat *repeatedActions) (params []string) {
+	for i, param := range repeat.params {
+		params = append(params, fmt.Sprintf("%s value%d", param.valueType, i+1))
+	}
+
+	return
+}
+
+// replaceRepeatedActions replaces repeated actions with pastes of a copy block or calls to a function,
+// the bodies of the functions are added after the bodies of the existing functions at start.
+func replaceRepeatedActions(repeats []*repeatedActions, start int) {
+	var actions = shortcut.WFWorkflowActions
+	var replaced = slices.Clone(actions[:start])
+	var occurrences = make(map[int]*repeatedActions)
+	var functions = make(map[*repeatedActions]*decompFunction)
+
+	for _, repeat := range repeats {
+		switch repeat.kind {
+		case repeatCopy:
+			for _, occurrence := range repeat.starts {
+				occurrences[occurrence] = repeat
+			}
+		case repeatFunction:
+			for _, occurrence := range repeat.starts {
+				occurrences[occurrence] = repeat
+			}
+
+			var function = &decompFunction{name: repeat.name, start: len(replaced)}
+			for i, param := range repeat.params {
+				function.parameters = append(function.parameters, decompParameter{
+					name:      fmt.Sprintf("value%d", i+1),
+					valueType: param.valueType,
+				})
+			}
+			replaced = append(replaced, repeatFunctionBody(actions[repeat.starts[0]:repeat.starts[0]+repeat.length], repeat)...)
+			function.end = len(replaced)
+
+			decompFunctions = append(decompFunctions, function)
+			functions[repeat] = function
+		}
+	}
+
+	var calls = make(map[int]decompFunctionCall)
+	for i := start; i < len(actions); i++ {
+		var repeat, found = occurrences[i]
+		if !found {
+			replaced = append(replaced, actions[i])
+			continue
+		}
+
+		switch {
+		case repeat.kind == repeatCopy && i == repeat.starts[0]:
+			var copyBlock = decompCopyBlock{name: repeat.name, start: len(replaced)}
+			replaced = append(replaced, actions[i:i+repeat.length]...)
+			copyBlock.end = len(replaced)
+			decompCopyBlocks = append(decompCopyBlocks, copyBlock)
+		case repeat.kind == repeatCopy:
+			pasteActions[len(replaced)] = repeat.name
+			replaced = append(replaced, ShortcutAction{WFWorkflowActionIdentifier: "is.workflow.actions.nothing"})
+		default:
+			calls[len(replaced)] = decompFunctionCall{
+				function: functions[repeat],
+				values:   repeatFunctionArguments(actions[i:i+repeat.length], repeat),
+			}
+			replaced = append(replaced, ShortcutAction{WFWorkflowActionIdentifier: "is.workflow.actions.nothing"})
+		}
+		i += repeat.length - 1
+	}
+
+	shortcut.WFWorkflowActions = replaced
+
+	decompFunctionCalls = make(map[int]decompFunctionCall)
+	functionCallActions = make(map[int]bool)
+	mapFunctionCalls()
+	maps.Copy(decompFunctionCalls, calls)
+}
+
+// repeatFunctionBody returns actions with their differing input values replaced by the parameters of the function.
+func repeatFunctionBody(actions []ShortcutAction, repeat *repeatedActions) []ShortcutAction {
+	var body = slices.Clone(actions)
+	for i, param := range repeat.params {
+		var variable = map[string]any{
+			"Type":         "Variable",
+			"VariableName": fmt.Sprintf("value%d", i+1),
+		}
+		var value = map[string]any{
+			"Value":               variable,
+			"WFSerializationType": "WFTextTokenAttachment",
+		}
+		if param.valueType == "text" {
+			value = map[string]any{
+				"Value": map[string]any{
+					"string":             ObjectReplaceCharStr,
+					"attachmentsByRange": map[string]any{"{0, 1}": variable},
+				},
+				"WFSerializationType": "WFTextTokenString",
+			}
+		}
+
+		var action = body[param.action]
+		action.WFWorkflowActionParameters = maps.Clone(action.WFWorkflowActionParameters)
+		action.WFWorkflowActionParameters[param.key] = value
+		body[param.action] = action
+	}
+
+	return body
+}
+
+func repeatFunctionArguments(actions []ShortcutAction, repeat *repeatedActions) (arguments []string) {
+	for _, param := range repeat.params {
+		var value = actions[param.action].WFWorkflowActionParameters[param.key]
+		if param.valueType == "text" {
+			arguments = append(arguments, fmt.Sprintf("\"%s\"", escapeString(fmt.Sprintf("%v", value))))
+			continue
+		}
+		arguments = append(arguments, fmt.Sprintf("%v", value))
+	}
+
+	return
+}
+
+// decompCopyBoundaries writes the copy block whose actions start at the current action and pastes it where they end.
+// Copy and paste statements are not indented as they are only recognized at the start of a line.
+func decompCopyBoundaries() {
+	for _, copyBlock := range decompCopyBlocks {
+		if copyBlock.end == actionIndex {
+			tabLevel--
+			newCodeLine("}\n")
+			code.WriteString(fmt.Sprintf("%s %s\n", Paste, copyBlock.name))
+		}
+		if copyBlock.start == actionIndex {
+			code.WriteString(fmt.Sprintf("%s %s {\n", Copy, copyBlock.name))
+			tabLevel++
+		}
+	}
+}
+
+// decompPasteAction writes the paste of a copy block for the action that replaced its repeated actions.
+func decompPasteAction() bool {
+	var name, found = pasteActions[actionIndex]
+	if found {
+		code.WriteString(fmt.Sprintf("%s %s\n", Paste, name))
+	}
+
+	return found
+}
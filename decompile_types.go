@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Decompiling Variable Types
+
+The types of values set to variables are inferred from the output types of actions, coercions to a
+content item type and the types of other variables, so that variables set to references are declared
+with their type (e.g. @x: number = @y) and are type checked as that type when compiled again.
+
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// decompOutputActions are the indexes of actions by their UUID.
+var decompOutputActions map[string]int
+
+// decompVariableTypes are the types of the values last set to variables.
+var decompVariableTypes map[string]tokenType
+
+var literalActionTypes = map[string]tokenType{
+	"gettext":             String,
+	"dictionary":          Dict,
+	"list":                Arr,
+	"math":                Integer,
+	"calculateexpression": Integer,
+}
+
+func mapOutputActions() {
+	decompOutputActions = make(map[string]int)
+	decompVariableTypes = make(map[string]tokenType)
+	for i, action := range shortcut.WFWorkflowActions {
+		if uuid, ok := action.WFWorkflowActionParameters[UUID].(string); ok {
+			decompOutputActions[uuid] = i
+		}
+	}
+}
+
+// decompOutputType returns the type of the output of the action with uuid if it is known.
+func decompOutputType(uuid string) tokenType {
+	if valueType := decompLiteralOutputType(uuid); valueType != "" {
+		return valueType
+	}
+	var index, found = decompOutputActions[uuid]
+	if !found {
+		return ""
+	}
+	var action = shortcut.WFWorkflowActions[index]
+
+	var name, definition = matchAction(&action)
+	if name == "" {
+		return ""
+	}
+	if _, typed := coercedType(string(definition.outputType)); typed {
+		return definition.outputType
+	}
+
+	return ""
+}
+
+// decompLiteralOutputType returns the type of the output of the action with uuid if it is decompiled as a literal or expression.
+func decompLiteralOutputType(uuid string) tokenType {
+	var index, found = decompOutputActions[uuid]
+	if !found {
+		return ""
+	}
+	var action = shortcut.WFWorkflowActions[index]
+
+	var identifier = actionIdentifierEnd(action.WFWorkflowActionIdentifier)
+	if identifier == "number" {
+		var number = fmt.Sprintf("%v", action.WFWorkflowActionParameters["WFNumberActionNumber"])
+		if strings.Contains(number, ".") {
+			return Float
+		}
+		return Integer
+	}
+
+	return literalActionTypes[identifier]
+}
+
+// decompValueType returns the type of a reference value of an action parameter if it is known.
+func decompValueType(value any) tokenType {
+	var valueMap, isMap = value.(map[string]interface{})
+	if !isMap {
+		return ""
+	}
+	if inner, found := valueMap["Value"].(map[string]interface{}); found {
+		valueMap = inner
+	}
+	if attachments, found := valueMap["attachmentsByRange"].(map[string]interface{}); found {
+		if valueMap["string"] != ObjectReplaceCharStr || len(attachments) != 1 {
+			return String
+		}
+		for _, attachment := range attachments {
+			valueMap, _ = attachment.(map[string]interface{})
+		}
+	}
+
+	if aggrandizements, found := valueMap["Aggrandizements"].([]interface{}); found && len(aggrandizements) != 0 {
+		for _, aggrandizement := range aggrandizements {
+			var aggr, _ = aggrandizement.(map[string]interface{})
+			if aggr["Type"] != "WFCoercionVariableAggrandizement" {
+				continue
+			}
+			var itemClass, _ = aggr["CoercionItemClass"].(string)
+			if valueType, coerced := coercedType(reversedContentItems()[itemClass]); coerced {
+				return valueType
+			}
+		}
+
+		return ""
+	}
+
+	switch valueMap["Type"] {
+	case "ActionOutput":
+		var uuid, _ = valueMap["OutputUUID"].(string)
+		return decompOutputType(uuid)
+	case "Variable":
+		var variableName, _ = valueMap["VariableName"].(string)
+		sanitizeIdentifier(&variableName)
+		return decompVariableTypes[variableName]
+	}
+
+	return ""
+}
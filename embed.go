@@ -0,0 +1,331 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Embedded Data Files
+
+#embed 'file' collects the contents of a JSON, plist, YAML or CSV file at compile time
+as a dictionary or array value, so that the data is made into a single Dictionary or List action
+rather than decoded at runtime. Paths are resolved the same way as #include.
+
+#embed 'file' as text collects the contents of any file (e.g. a shell script or JavaScript) as text.
+Braces in the file are literal, only inline variable references (e.g. {@name}) become attachments.
+#embed 'file.js' as minified text also removes comments and indentation from JavaScript.
+
+*/
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/electrikmilk/args-parser"
+	"gopkg.in/yaml.v3"
+	"howett.net/plist"
+)
+
+// embeddedArray is an array collected from an embedded file, which is made into a single List action.
+type embeddedArray []interface{}
+
+func collectEmbedValue(valueType *tokenType, value *any) {
+	skipInlineWhitespace()
+	if char == '"' {
+		parserError("Use raw string (') for embed file paths")
+	}
+	if char != '\'' {
+		parserError("Expected file path")
+	}
+	advance()
+
+	var embedPath = collectIncludePath()
+	advance()
+	handlePackageIncludePath(&embedPath)
+	resolveIncludePath(&embedPath)
+
+	var fileBytes, readErr = os.ReadFile(embedPath)
+	if readErr != nil {
+		if os.IsNotExist(readErr) {
+			parserError(fmt.Sprintf("File '%s' does not exist!", embedPath))
+		}
+		parserError(fmt.Sprintf("Unable to read embedded file '%s': %s", embedPath, readErr))
+	}
+
+	if embedAs := collectEmbedAs(); embedAs != "" {
+		*valueType = String
+		*value = embeddedText(embedPath, string(fileBytes), embedAs == "minified text")
+		if args.Using("debug") {
+			printEmbedDebug(embedPath, len(fileBytes), *value)
+		}
+		return
+	}
+
+	var data = decodeEmbeddedFile(embedPath, fileBytes)
+	switch data := data.(type) {
+	case map[string]interface{}:
+		*valueType = Dict
+		*value = data
+	case []interface{}:
+		*valueType = Arr
+		*value = embeddedArray(data)
+	default:
+		parserError(fmt.Sprintf("Embedded file '%s' must contain a dictionary or array, got: %T", embedPath, data))
+	}
+
+	if args.Using("debug") {
+		printEmbedDebug(embedPath, len(fileBytes), data)
+	}
+}
+
+var embedAsRegex = regexp.MustCompile(`^as\s+(minified\s+)?text\b`)
+
+// collectEmbedAs collects the type a file is embedded as (e.g. as text), returns an empty string if there is none.
+func collectEmbedAs() string {
+	skipInlineWhitespace()
+	var ahead = lookAheadUntil('\n')
+	if !strings.HasPrefix(ahead, "as ") {
+		return ""
+	}
+
+	var match = embedAsRegex.FindString(ahead)
+	if match == "" {
+		parserError(fmt.Sprintf("Expected 'as text' or 'as minified text', got: %s", ahead))
+	}
+	advanceTimes(len(match))
+
+	return strings.Join(strings.Fields(match)[1:], " ")
+}
+
+// embeddedText escapes the braces of text that are not inline variable references, so that they remain literal.
+func embeddedText(path string, text string, minify bool) string {
+	text = strings.TrimPrefix(strings.ReplaceAll(text, "\r\n", "\n"), "\uFEFF")
+	if minify {
+		if extension := strings.ToLower(filepath.Ext(path)); extension != ".js" && extension != ".mjs" {
+			parserError(fmt.Sprintf("Only JavaScript files can be minified, got: %s", path))
+		}
+		text = minifyJS(text)
+	}
+
+	var escaped strings.Builder
+	var lastIdx int
+	for _, placeholder := range scriptPlaceholderRegex.FindAllStringIndex(text, -1) {
+		escaped.WriteString(escapeBraces(text[lastIdx:placeholder[0]]))
+		escaped.WriteString(text[placeholder[0]:placeholder[1]])
+		lastIdx = placeholder[1]
+	}
+	escaped.WriteString(escapeBraces(text[lastIdx:]))
+
+	var embedded = escaped.String()
+	checkInlineVars(&embedded)
+
+	return embedded
+}
+
+var scriptPlaceholderRegex = regexp.MustCompile(`\{@[A-Za-z_]\w*(?:\['[^'{}]*'])?(?:\.\w+)?}`)
+
+// Literal braces are replaced with private use characters until the text is made into a WFTextTokenString,
+// as braces are otherwise parsed as inline variable references.
+const (
+	literalOpenBrace  = "\uE07B"
+	literalCloseBrace = "\uE07D"
+)
+
+var braceEscaper = strings.NewReplacer("{", literalOpenBrace, "}", literalCloseBrace)
+var braceUnescaper = strings.NewReplacer(literalOpenBrace, "{", literalCloseBrace, "}")
+
+func escapeBraces(text string) string {
+	return braceEscaper.Replace(text)
+}
+
+func unescapeBraces(text string) string {
+	if !strings.Contains(text, literalOpenBrace) && !strings.Contains(text, literalCloseBrace) {
+		return text
+	}
+
+	return braceUnescaper.Replace(text)
+}
+
+// minifyJS removes comments, indentation and empty lines from JavaScript.
+// Line breaks are kept so that automatic semicolon insertion is not affected.
+func minifyJS(script string) string {
+	var minified strings.Builder
+	var runes = []rune(script)
+	var quote rune
+	var lastSignificant rune
+	for i := 0; i < len(runes); i++ {
+		var char = runes[i]
+		if quote != 0 {
+			minified.WriteRune(char)
+			switch char {
+			case '\\':
+				if i+1 < len(runes) {
+					i++
+					minified.WriteRune(runes[i])
+				}
+			case quote:
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case char == '"' || char == '\'' || char == '`':
+			quote = char
+		case char == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			i--
+			continue
+		case char == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i+1 < len(runes) && (runes[i] != '*' || runes[i+1] != '/') {
+				i++
+			}
+			i++
+			continue
+		case char == '/' && (lastSignificant == 0 || strings.ContainsRune("(,=:[!&|?{};", lastSignificant)):
+			// Regular expression literal
+			quote = '/'
+		}
+
+		minified.WriteRune(char)
+		if !unicode.IsSpace(char) {
+			lastSignificant = char
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(minified.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// decodeEmbeddedFile decodes the contents of an embedded file based on its extension.
+func decodeEmbeddedFile(path string, contents []byte) (data any) {
+	var extension = strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	switch extension {
+	case "json":
+		if err := json.Unmarshal(contents, &data); err != nil {
+			parserError(fmt.Sprintf("Invalid JSON in embedded file '%s': %s", path, err))
+		}
+	case "plist":
+		if _, err := plist.Unmarshal(contents, &data); err != nil {
+			parserError(fmt.Sprintf("Invalid plist in embedded file '%s': %s", path, err))
+		}
+	case "yaml", "yml":
+		if err := yaml.Unmarshal(contents, &data); err != nil {
+			parserError(fmt.Sprintf("Invalid YAML in embedded file '%s': %s", path, err))
+		}
+	case "csv":
+		data = decodeCSV(path, contents)
+	default:
+		parserError(fmt.Sprintf("Unsupported embedded file type '%s', expected: json, plist, yaml or csv.\n\nUse #embed '%s' as text to embed the file as text.", extension, path))
+	}
+
+	return normalizeEmbeddedValue(data)
+}
+
+// decodeCSV decodes the rows of a CSV file into an array of dictionaries keyed by the header row.
+func decodeCSV(path string, contents []byte) any {
+	var rows, csvErr = csv.NewReader(strings.NewReader(string(contents))).ReadAll()
+	if csvErr != nil {
+		parserError(fmt.Sprintf("Invalid CSV in embedded file '%s': %s", path, csvErr))
+	}
+	if len(rows) == 0 {
+		return []interface{}{}
+	}
+
+	var header = rows[0]
+	var records = make([]interface{}, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		var record = make(map[string]interface{}, len(header))
+		for i, column := range header {
+			record[column] = row[i]
+		}
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// normalizeEmbeddedValue converts decoded values to the types used for dictionary and array values.
+func normalizeEmbeddedValue(value any) any {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeEmbeddedValue(item)
+		}
+	case map[interface{}]interface{}:
+		var dictionary = make(map[string]interface{}, len(v))
+		for key, item := range v {
+			dictionary[fmt.Sprint(key)] = normalizeEmbeddedValue(item)
+		}
+		return dictionary
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeEmbeddedValue(item)
+		}
+	case string:
+		return escapeBraces(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	}
+
+	return value
+}
+
+// makeEmbeddedList makes the items of an embedded array into a List action.
+func makeEmbeddedList(reference *WFActionReference, items embeddedArray) {
+	var listItems = make([]WFDictionaryFieldValueItem, 0, len(items))
+	for _, item := range items {
+		listItems = append(listItems, makeDictionaryItem("", item))
+	}
+
+	addStdAction("list", attachReferenceToParams(map[string]any{
+		"WFItems": makeArrayValue(listItems).Value,
+	}, reference))
+}
+
+func isEmbeddedArray(value any) bool {
+	var _, embedded = value.(embeddedArray)
+	return embedded
+}
+
+func printEmbedDebug(path string, size int, data any) {
+	fmt.Println(ansi("\n### EMBEDDED FILE ###", bold))
+	fmt.Printf("%s (%d bytes)\n", path, size)
+	switch data := data.(type) {
+	case map[string]interface{}:
+		fmt.Printf("dictionary with %d keys\n", len(data))
+	case []interface{}:
+		fmt.Printf("array with %d items\n", len(data))
+	case string:
+		fmt.Printf("text with %d characters\n", len([]rune(unescapeBraces(data))))
+	}
+	fmt.Print("\n")
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Environment Variables
+
+#env NAME and env("NAME", "default") are replaced with the value of the environment variable as text
+at compile time. Values are read from the environment of the compiler, then from a .env file next to the
+file being compiled. #env secret NAME and secretEnv("NAME", "default") mark the value as a secret, which
+is masked in debug output using --redact and causes a warning if it is included in a Shortcut shared with anyone.
+
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/electrikmilk/args-parser"
+	"howett.net/plist"
+)
+
+// envSecrets are the values of environment variables marked as secrets, by name.
+var envSecrets map[string]string
+
+// envFile contains the variables defined in the .env file next to the file being compiled.
+var envFile map[string]string
+
+var envDirectiveRegex = regexp.MustCompile(`^#env\s+(secret\s+)?([A-Za-z_]\w*)`)
+var envFunctionRegex = regexp.MustCompile(`^(env|secretEnv)\(\s*"([A-Za-z_]\w*)"\s*(?:,\s*"((?:[^"\\]|\\.)*)"\s*)?\)`)
+
+const redactedSecret = "********"
+
+// sourceReplacement is a reference in the source code to be replaced with a value.
+type sourceReplacement struct {
+	line   int
+	column int
+	length int
+	value  string
+}
+
+func handleEnvironment() {
+	envSecrets = make(map[string]string)
+	if !strings.Contains(contents, "#env") && !strings.Contains(contents, "nv(") {
+		return
+	}
+
+	parseEnvironment()
+
+	if args.Using("debug") {
+		printEnvironmentDebug()
+	}
+}
+
+func parseEnvironment() {
+	var replacements []sourceReplacement
+	for char != -1 {
+		switch {
+		case char == '"':
+			advance()
+			collectString()
+			continue
+		case char == '\'':
+			advance()
+			collectRawString()
+			continue
+		case commentAhead():
+			collectComment()
+		case char == '#' || ((char == 'e' || char == 's') && !isIdentifierChar(prev(1))):
+			if replacement, found := collectEnvReference(); found {
+				replacements = append(replacements, replacement)
+				continue
+			}
+		}
+		advance()
+	}
+
+	// Replace from the end so that the columns of earlier references on the same line are unchanged.
+	for _, replacement := range slices.Backward(replacements) {
+		var line = []rune(lines[replacement.line])
+		lines[replacement.line] = string(line[:replacement.column]) + replacement.value + string(line[replacement.column+replacement.length:])
+	}
+
+	resetParse()
+}
+
+// collectEnvReference collects a reference to an environment variable and resolves its value as a string literal.
+func collectEnvReference() (replacement sourceReplacement, found bool) {
+	var ahead = restOfLine()
+	var name, defaultValue, reference string
+	var secret, hasDefault bool
+	if matches := envDirectiveRegex.FindStringSubmatch(ahead); matches != nil {
+		reference, secret, name = matches[0], matches[1] != "", matches[2]
+	} else if matches := envFunctionRegex.FindStringSubmatch(ahead); matches != nil {
+		reference, secret, name = matches[0], matches[1] == "secretEnv", matches[2]
+		hasDefault = strings.Contains(matches[0], ",")
+		defaultValue = unescapeStringLiteral(matches[3])
+	} else {
+		return
+	}
+
+	var value, defined = lookupEnv(name)
+	if !defined {
+		if !hasDefault {
+			parserError(fmt.Sprintf("Environment variable '%s' is not set and has no default value.", name))
+		}
+		value = defaultValue
+	}
+	if secret && value != "" {
+		envSecrets[name] = value
+	}
+
+	var length = len([]rune(reference))
+	replacement = sourceReplacement{line: lineIdx, column: lineCharIdx, length: length, value: envStringLiteral(value)}
+	advanceTimes(length)
+
+	return replacement, true
+}
+
+// lookupEnv gets the value of an environment variable from the environment, then the .env file.
+func lookupEnv(name string) (string, bool) {
+	if value, found := os.LookupEnv(name); found {
+		return value, true
+	}
+	if envFile == nil {
+		envFile = loadEnvFile(relativePath + ".env")
+	}
+
+	var value, found = envFile[name]
+	return value, found
+}
+
+// loadEnvFile parses the NAME=value lines of a .env file.
+func loadEnvFile(path string) map[string]string {
+	var variables = make(map[string]string)
+	var file, openErr = os.Open(path)
+	if openErr != nil {
+		return variables
+	}
+	defer file.Close()
+
+	var scanner = bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line = strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		var name, value, hasValue = strings.Cut(line, "=")
+		if !hasValue {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			value = unescapeStringLiteral(value[1 : len(value)-1])
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			if commentIdx := strings.Index(value, " #"); commentIdx != -1 {
+				value = strings.TrimSpace(value[:commentIdx])
+			}
+		}
+
+		variables[strings.TrimSpace(name)] = value
+	}
+	handle(scanner.Err())
+
+	return variables
+}
+
+func unescapeStringLiteral(value string) string {
+	return strings.NewReplacer(`\"`, `"`, `\n`, "\n", `\t`, "\t", `\\`, `\`).Replace(value)
+}
+
+// envStringLiteral makes value into a string literal whose braces are not parsed as inline variable references.
+func envStringLiteral(value string) string {
+	return stringLiteral(escapeBraces(value))
+}
+
+func restOfLine() string {
+	var end = idx
+	for end < len(chars) && chars[end] != '\n' {
+		end++
+	}
+
+	return string(chars[idx:end])
+}
+
+func isIdentifierChar(char rune) bool {
+	return char == '_' || char == '@' || char == '.' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+}
+
+// redactSecrets masks the values of secret environment variables in text when using --redact.
+func redactSecrets(text string) string {
+	if !args.Using("redact") || len(envSecrets) == 0 {
+		return text
+	}
+
+	for _, value := range envSecrets {
+		for _, form := range secretForms(value) {
+			text = strings.ReplaceAll(text, form, redactedSecret)
+		}
+	}
+
+	return text
+}
+
+// secretForms returns the ways a secret value may be written in source code or a plist.
+func secretForms(value string) (forms []string) {
+	var literal = envStringLiteral(value)
+	forms = append(forms, literal[1:len(literal)-1], value)
+
+	var escaped bytes.Buffer
+	handle(xml.EscapeText(&escaped, []byte(value)))
+	if escaped.String() != value {
+		forms = append(forms, escaped.String())
+	}
+
+	return
+}
+
+// checkSecretLeaks warns about secret environment variables included in a Shortcut that is shared with anyone.
+func checkSecretLeaks() {
+	if len(envSecrets) == 0 || args.Value("share") != "anyone" {
+		return
+	}
+
+	var encoded, encodeErr = plist.Marshal(shortcut, plist.XMLFormat)
+	handle(encodeErr)
+
+	var names = make([]string, 0, len(envSecrets))
+	for name := range envSecrets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		for _, form := range secretForms(envSecrets[name]) {
+			if bytes.Contains(encoded, []byte(form)) {
+				fmt.Println(ansi("Warning:", yellow, bold), fmt.Sprintf("The value of secret environment variable '%s' is included in this Shortcut, which can be shared with anyone (--share=anyone).\n", name))
+				break
+			}
+		}
+	}
+}
+
+func printEnvironmentDebug() {
+	fmt.Println(ansi("### ENVIRONMENT ###", bold))
+	for name := range envSecrets {
+		fmt.Printf("secret %s=%s\n", name, redactSecrets(envSecrets[name]))
+	}
+	fmt.Print("\n")
+}
@@ -21,8 +21,10 @@ package main
 
 import (
 	"fmt"
+	"maps"
 	"reflect"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/electrikmilk/args-parser"
@@ -36,6 +38,7 @@ type function struct {
 	body       string
 	used       bool
 	callCount  int // incremented each call to produce unique _cherri_call variable names
+	index      int // position of the declaration in the file
 }
 
 // functions is a map of all the functions that have been defined.
@@ -59,6 +62,9 @@ func handleFunctions() {
 	if usingFunctions {
 		var functionsHeader = generateFunctionsHeader()
 		lines = append([]string{functionsHeader}, lines...)
+		if sourceLines != nil {
+			sourceLines = append([]int{0}, sourceLines...)
+		}
 
 		resetParse()
 	}
@@ -97,7 +103,7 @@ func isUsingFunctions() bool {
 
 func collectFunctionDefinition() {
 	var lineRef = newLineReference()
-	var identifier, arguments, outputType = collectActionDefinition('{')
+	var identifier, arguments, outputType, outputRecord = collectActionDefinition('{')
 
 	advanceUntilExpect('{', 3)
 	advance()
@@ -108,13 +114,22 @@ func collectFunctionDefinition() {
 
 	functions[identifier] = &function{
 		definition: actionDefinition{
-			parameters: arguments,
-			outputType: outputType,
+			parameters:   arguments,
+			outputType:   outputType,
+			outputRecord: outputRecord,
 		},
-		body: body,
+		body:  body,
+		index: len(functions),
 	}
 }
 
+// declaredFunctions returns the identifiers of the functions in the order they were declared.
+func declaredFunctions() []string {
+	return slices.SortedFunc(maps.Keys(functions), func(a string, b string) int {
+		return functions[a].index - functions[b].index
+	})
+}
+
 var actionUsageRegex = regexp.MustCompile(`([a-zA-Z0-9]+)\(`)
 
 func checkFunctionUsage(content string) {
@@ -157,7 +172,8 @@ func generateFunctionsHeader() string {
 
 func generateFunctions(functionsHeader *strings.Builder) {
 	var outputActionRegex = regexp.MustCompile(`(?:must)?[o|O]utput(?:OrClipboard)?\((.*?)\)`)
-	for identifier, function := range functions {
+	for _, identifier := range declaredFunctions() {
+		var function = functions[identifier]
 		if !function.used {
 			continue
 		}
@@ -194,7 +210,11 @@ func handleFunctionArguments(functionsHeader *strings.Builder, identifier string
 		var argumentReference = fmt.Sprintf("_cherri_%s_arg_%d_%s", identifier, idx, param.name)
 
 		functionsHeader.WriteString(fmt.Sprintf("                const %s = getListItem(_cherri_function_args, %d)\n", argumentReference, idx))
-		functionsHeader.WriteString(fmt.Sprintf("                @%s: %s\n                ", param.name, param.validType))
+		var paramType = string(param.validType)
+		if param.record != nil {
+			paramType = param.record.name
+		}
+		functionsHeader.WriteString(fmt.Sprintf("                @%s: %s\n                ", param.name, paramType))
 
 		switch param.validType {
 		case String:
@@ -261,6 +281,11 @@ func makeFunctionRef(identifier *string) any {
 	if function.definition.outputType != "" {
 		var outputIdentifier = fmt.Sprintf("_%s_cherri_call_%d_output", *identifier, function.callCount)
 		insertReference(outputIdentifier, Action, runSelfAction, true)
+		if function.definition.outputRecord != nil {
+			var output = variables[outputIdentifier]
+			output.record = function.definition.outputRecord
+			variables[outputIdentifier] = output
+		}
 
 		return coerceOutputValue(outputIdentifier, function.definition.outputType, runSelfAction)
 	}
@@ -336,14 +361,15 @@ func makeFunctionArgValue(arg actionArgument, paramType tokenType) any {
 
 func printFunctionsDebug() {
 	fmt.Println(ansi("### FUNCTIONS ###", bold) + "\n")
-	for identifier, function := range functions {
+	for _, identifier := range declaredFunctions() {
+		var function = functions[identifier]
 		fmt.Println("identifier:", identifier+"()")
 		fmt.Println("used:", function.used)
 		fmt.Println("output type:", function.definition.outputType)
 		fmt.Println("parameters:")
-		fmt.Println(function.definition.parameters)
+		fmt.Println(redactSecrets(fmt.Sprint(function.definition.parameters)))
 		fmt.Println("body:")
-		fmt.Println(function.body)
+		fmt.Println(redactSecrets(function.body))
 		fmt.Println("(end)")
 		fmt.Print("\n")
 	}
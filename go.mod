@@ -9,6 +9,7 @@ require github.com/electrikmilk/args-parser v1.1.3
 require (
 	github.com/glebarez/go-sqlite v1.22.0
 	github.com/go-git/go-git/v5 v5.16.3
+	gopkg.in/yaml.v3 v3.0.1
 	howett.net/plist v1.0.1
 )
 
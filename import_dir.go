@@ -0,0 +1,251 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Directory Imports
+
+Using --import-dir, every Shortcut or property list file in a directory is imported into a mirrored directory
+of Cherri files, set using --output, and a summary is printed of the actions in each Shortcut, the actions
+that were decompiled as raw actions, the decompile warnings and if the Cherri file compiles to the same actions.
+
+The decompiler and compiler rely on globals, so each file is imported and compiled by a separate run of the compiler.
+
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/electrikmilk/args-parser"
+	"howett.net/plist"
+)
+
+// importDirArgs are the arguments passed on to the import of each file.
+var importDirArgs = []string{"comments", "no-toolkit", "toolkit", "toolkit-locale", "import-dedupe"}
+
+type importDirResult struct {
+	path       string
+	actions    int
+	rawActions int
+	warnings   int
+	recompiles string
+	err        error
+}
+
+// importDir imports each Shortcut in dir into a mirrored directory and prints a summary.
+func importDir(dir string) {
+	var outputDir = strings.TrimSuffix(filepath.Clean(dir), string(filepath.Separator)) + "_cherri"
+	if args.Using("output") && args.Value("output") != "" {
+		outputDir = args.Value("output")
+	}
+
+	var paths = shortcutPaths(dir)
+	if len(paths) == 0 {
+		exit(fmt.Sprintf("import: No Shortcut or property list files in '%s'.", dir))
+	}
+
+	var results []importDirResult
+	for i, path := range paths {
+		fmt.Println(ansi(fmt.Sprintf("[%d/%d] Importing %s...", i+1, len(paths), path), bold))
+		results = append(results, importDirFile(dir, path, outputDir))
+	}
+
+	printImportDirSummary(results, outputDir)
+}
+
+// shortcutPaths returns the paths of the Shortcut and property list files in dir relative to dir.
+func shortcutPaths(dir string) (paths []string) {
+	var walkErr = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		var extension = filepath.Ext(path)
+		if entry.IsDir() || (extension != ".shortcut" && extension != ".plist") {
+			return nil
+		}
+
+		var relativePath, relErr = filepath.Rel(dir, path)
+		if relErr != nil {
+			return relErr
+		}
+		paths = append(paths, relativePath)
+
+		return nil
+	})
+	handle(walkErr)
+
+	slices.Sort(paths)
+
+	return
+}
+
+func importDirFile(dir string, path string, outputDir string) (result importDirResult) {
+	result.path = path
+	result.recompiles = "no"
+
+	var original, readErr = readShortcutActions(filepath.Join(dir, path))
+	if readErr != nil {
+		result.err = readErr
+		return
+	}
+	result.actions = len(original)
+
+	var cherriPath = filepath.Join(outputDir, strings.TrimSuffix(path, filepath.Ext(path))+".cherri")
+	var mkdirErr = os.MkdirAll(filepath.Dir(cherriPath), 0755)
+	handle(mkdirErr)
+
+	var importArgs = []string{"--import=" + filepath.Join(dir, path), "--output=" + cherriPath, "--no-ansi"}
+	for _, name := range importDirArgs {
+		if !args.Using(name) {
+			continue
+		}
+		if value := args.Value(name); value != "" {
+			importArgs = append(importArgs, fmt.Sprintf("--%s=%s", name, value))
+			continue
+		}
+		importArgs = append(importArgs, "--"+name)
+	}
+
+	var importOutput, importErr = runCompilerOutput("", importArgs...)
+	if importErr != nil {
+		result.err = errors.New(lastOutputLine(importOutput))
+		return
+	}
+	result.warnings = strings.Count(importOutput, "Warning:")
+
+	var decompiled, decompiledErr = os.ReadFile(cherriPath)
+	handle(decompiledErr)
+	result.rawActions = strings.Count(string(decompiled), "rawAction(")
+
+	var recompiled, recompileErr = recompileActions(decompiled)
+	switch {
+	case recompileErr != nil:
+		result.recompiles = "fails"
+	case actionsDifference(original, recompiled) == "":
+		result.recompiles = "yes"
+	}
+
+	return
+}
+
+// readShortcutActions returns the actions of the Shortcut or property list file at path.
+func readShortcutActions(path string) ([]ShortcutAction, error) {
+	var contents, readErr = readShortcut(path)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return contents.WFWorkflowActions, nil
+}
+
+// readShortcut returns the contents of the Shortcut or property list file at path.
+func readShortcut(path string) (contents Shortcut, err error) {
+	var b, readErr = os.ReadFile(path)
+	if readErr != nil {
+		return contents, readErr
+	}
+	if len(b) < 8 {
+		return contents, errors.New("File is not a Shortcut or is in an unknown format.")
+	}
+	if hasSignedBytes(b) {
+		var signedErr error
+		b, _, signedErr = signedShortcutContents(b)
+		if signedErr != nil {
+			return contents, signedErr
+		}
+	}
+
+	_, err = plist.Unmarshal(b, &contents)
+
+	return
+}
+
+// recompileActions compiles the decompiled Cherri code in a temporary directory and returns the actions of the Shortcut.
+func recompileActions(decompiled []byte) ([]ShortcutAction, error) {
+	var tempDir, tempErr = os.MkdirTemp("", "cherri-import")
+	handle(tempErr)
+	defer os.RemoveAll(tempDir)
+
+	var writeErr = os.WriteFile(filepath.Join(tempDir, "import.cherri"), decompiled, 0600)
+	handle(writeErr)
+
+	var compileOutput, compileErr = runCompilerOutput(tempDir, "import.cherri", "--skip-sign", "--no-ansi")
+	if compileErr != nil {
+		return nil, errors.New(lastOutputLine(compileOutput))
+	}
+
+	var compiled, _ = filepath.Glob(filepath.Join(tempDir, "*"+unsignedEnd))
+	if len(compiled) == 0 {
+		return nil, errors.New("no Shortcut was compiled")
+	}
+
+	return readShortcutActions(compiled[0])
+}
+
+// runCompilerOutput runs the compiler with arguments in dir and returns its combined output.
+func runCompilerOutput(dir string, arguments ...string) (string, error) {
+	var executable, executableErr = os.Executable()
+	handle(executableErr)
+
+	var compiler = exec.Command(executable, arguments...)
+	compiler.Dir = dir
+
+	var output, runErr = compiler.CombinedOutput()
+
+	return string(output), runErr
+}
+
+func lastOutputLine(output string) string {
+	var outputLines = strings.Split(strings.TrimSpace(output), "\n")
+	for i := len(outputLines) - 1; i >= 0; i-- {
+		if strings.HasPrefix(outputLines[i], "Error:") {
+			return strings.TrimSpace(strings.TrimPrefix(outputLines[i], "Error:"))
+		}
+		if strings.HasPrefix(outputLines[i], "panic: ") {
+			return outputLines[i]
+		}
+	}
+
+	return outputLines[len(outputLines)-1]
+}
+
+func printImportDirSummary(results []importDirResult, outputDir string) {
+	fmt.Print("\n")
+
+	var table = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "Shortcut\tActions\tRaw Actions\tWarnings\tRecompiles")
+
+	var imported, equivalent, actions, rawActions, warnings int
+	for _, result := range results {
+		if result.err != nil {
+			fmt.Fprintf(table, "%s\t\t\t\tfailed: %s\n", result.path, result.err)
+			continue
+		}
+		imported++
+		actions += result.actions
+		rawActions += result.rawActions
+		warnings += result.warnings
+		if result.recompiles == "yes" {
+			equivalent++
+		}
+
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%s\n", result.path, result.actions, result.rawActions, result.warnings, result.recompiles)
+	}
+	fmt.Fprintf(table, "Total\t%d\t%d\t%d\t%d/%d\n", actions, rawActions, warnings, equivalent, len(results))
+
+	var flushErr = table.Flush()
+	handle(flushErr)
+
+	fmt.Println(ansi(fmt.Sprintf("\nImported %d of %d Shortcuts into %s.", imported, len(results), outputDir), green))
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Split Imports
+
+Using --import-split, an imported Shortcut is written to a package directory instead of a single file.
+Each top-level comment begins a section that is written to its own file and included in main.cherri,
+using --import-split=menus the actions of each item of a top-level menu are also written to their own file.
+
+Sections are marked in the decompiled code as it is written, then moved into their files once it is complete.
+
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/electrikmilk/args-parser"
+)
+
+const importSectionMarker = "\x00section "
+const importSectionEndMarker = "\x00end"
+
+const maxSectionFilenameLength = 40
+
+var sectionFilenameRegex = regexp.MustCompile(`[^a-z0-9]+`)
+var packageNameRegex = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// inCommentSection is true when the decompiled code is in a section started by a top-level comment.
+var inCommentSection bool
+
+// inMenuSection is true when the decompiled code is in a section for the item of a top-level menu.
+var inMenuSection bool
+
+type importSection struct {
+	filename string
+	indent   string
+	lines    []string
+}
+
+func splittingImport() bool {
+	return args.Using("import-split")
+}
+
+func splittingMenus() bool {
+	return splittingImport() && args.Value("import-split") == "menus"
+}
+
+// beginCommentSection begins a section for a top-level comment, ending the section of the previous comment.
+func beginCommentSection(commentText string) {
+	if !splittingImport() || tabLevel != 0 {
+		return
+	}
+	if inCommentSection {
+		endImportSection()
+	}
+
+	beginImportSection(commentText)
+	inCommentSection = true
+}
+
+func beginImportSection(title string) {
+	newCodeLine(fmt.Sprintf("%s%s\n", importSectionMarker, strings.ReplaceAll(title, "\n", " ")))
+}
+
+func endImportSection() {
+	newCodeLine(importSectionEndMarker + "\n")
+}
+
+// writeSplitImport writes the sections of the decompiled code to files included by main.cherri in the package directory dir.
+func writeSplitImport(dir string) {
+	if _, statErr := os.Stat(dir); !os.IsNotExist(statErr) {
+		exit(fmt.Sprintf("import: '%s' already exists.", dir))
+	}
+	var mkdirErr = os.MkdirAll(dir, 0755)
+	handle(mkdirErr)
+
+	var sections = splitImportSections(code.String())
+	for _, section := range sections[1:] {
+		var writeErr = os.WriteFile(filepath.Join(dir, section.filename), []byte(strings.Join(section.lines, "\n")+"\n"), 0600)
+		handle(writeErr)
+	}
+
+	var writeErr = os.WriteFile(filepath.Join(dir, "main.cherri"), []byte(strings.Join(sections[0].lines, "\n")), 0600)
+	handle(writeErr)
+
+	var pkgSig = args.Value("init")
+	if pkgSig == "" {
+		pkgSig = fmt.Sprintf("@%s/%s", packageUser(), packageNameRegex.ReplaceAllString(filepath.Base(dir), "-"))
+	}
+	createPackage(dir, pkgSig)
+
+	fmt.Println(ansi(fmt.Sprintf("Imported into %s with %d included files.", dir, len(sections)-1), green))
+}
+
+// splitImportSections moves the lines of each marked section in decompiled into its own section,
+// the first section returned is main.cherri.
+func splitImportSections(decompiled string) []importSection {
+	var sections = []importSection{{filename: "main.cherri"}}
+	var open = []int{0}
+	var filenames = map[string]int{}
+
+	for _, line := range strings.Split(decompiled, "\n") {
+		var trimmedLine = strings.TrimLeft(line, "\t")
+		var indent = line[:len(line)-len(trimmedLine)]
+		var current = &sections[open[len(open)-1]]
+
+		switch {
+		case strings.HasPrefix(trimmedLine, importSectionMarker):
+			var filename = sectionFilename(strings.TrimPrefix(trimmedLine, importSectionMarker), filenames)
+			current.lines = append(current.lines, fmt.Sprintf("%s%s '%s'", strings.TrimPrefix(indent, current.indent), Include, filename))
+			sections = append(sections, importSection{filename: filename, indent: indent})
+			open = append(open, len(sections)-1)
+		case trimmedLine == importSectionEndMarker:
+			if len(open) > 1 {
+				open = open[:len(open)-1]
+			}
+		default:
+			current.lines = append(current.lines, strings.TrimPrefix(line, current.indent))
+		}
+	}
+
+	for i := range sections[1:] {
+		var section = &sections[i+1]
+		for len(section.lines) != 0 && strings.TrimSpace(section.lines[len(section.lines)-1]) == "" {
+			section.lines = section.lines[:len(section.lines)-1]
+		}
+	}
+
+	return sections
+}
+
+// sectionFilename makes a unique filename for a section from its title.
+func sectionFilename(title string, filenames map[string]int) string {
+	var name = strings.Trim(sectionFilenameRegex.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(name) > maxSectionFilenameLength {
+		name = strings.TrimRight(name[:maxSectionFilenameLength], "-")
+	}
+	if name == "" || name == "main" {
+		name = "section"
+	}
+
+	filenames[name]++
+	if filenames[name] > 1 {
+		name = fmt.Sprintf("%s-%d", name, filenames[name])
+	}
+
+	return name + ".cherri"
+}
+
+// packageUser returns the author used for the signature of an imported package.
+func packageUser() string {
+	var user = sectionFilenameRegex.ReplaceAllString(strings.ToLower(os.Getenv("USER")), "")
+	if user == "" {
+		return "cherri"
+	}
+
+	return user
+}
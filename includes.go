@@ -63,6 +63,8 @@ func parseIncludes() {
 	resetParse()
 
 	if includedFile {
+		handleMultilineStrings()
+		handleConditionalCompilation()
 		parseIncludes()
 	}
 }
@@ -109,9 +111,7 @@ func parseInclude() {
 	} else if includePath == "stdlib" {
 		includeFileBytes, includeReadErr = stdLib.ReadFile("stdlib.cherri")
 	} else {
-		if !strings.Contains(includePath, "..") {
-			includePath = relativePath + includePath
-		}
+		resolveIncludePath(&includePath)
 		checkFile(includePath)
 		includeFileBytes, includeReadErr = os.ReadFile(includePath)
 	}
@@ -135,6 +135,13 @@ func parseInclude() {
 	included = append(included, includePath)
 }
 
+// resolveIncludePath resolves includePath relative to the file being compiled.
+func resolveIncludePath(includePath *string) {
+	if !strings.Contains(*includePath, "..") {
+		*includePath = relativePath + *includePath
+	}
+}
+
 var packageIncludeRegex = regexp.MustCompile("packages/@(.*?)/(.*?)/")
 
 // handlePackageIncludePath resolves internal package includes.
@@ -162,14 +169,14 @@ func updateIncludesMap(line int, includeLines int) {
 
 // delinquentFile determines what file the current cursor exists within in relation to any included files.
 func delinquentFile() (errorFilename string, errorLine int, errorCol int) {
+	var line, currentLine = sourceLine(lineIdx)
 	errorFilename = workflowName + ".cherri"
-	errorLine = lineIdx + 1
+	errorLine = line + 1
 	errorCol = lineCharIdx + 1
 	if len(includes) == 0 {
 		return
 	}
 
-	var currentLine = lines[lineIdx]
 	var found bool
 	for _, inc := range includes {
 		if errorLine <= inc.start || errorLine >= inc.end {
@@ -187,15 +194,15 @@ func delinquentFile() (errorFilename string, errorLine int, errorCol int) {
 	}
 
 	if !found {
-		findOriginalLine(&errorLine)
+		findOriginalLine(&errorLine, currentLine)
 	}
 
 	return
 }
 
-func findOriginalLine(errorLine *int) {
+func findOriginalLine(errorLine *int, currentLine string) {
 	for l, line := range strings.Split(originalContents, "\n") {
-		if line == lines[lineIdx] {
+		if line == currentLine {
 			*errorLine = l
 		}
 	}
@@ -0,0 +1,278 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var lambdaHelperRegex = regexp.MustCompile(`\b(map|filter|reduce)\(`)
+var lambdaAssignmentRegex = regexp.MustCompile(`^\s*@([a-zA-Z_]\w*)\s*=\s*$`)
+var lambdaRegex = regexp.MustCompile(`(?s)^\(?\s*([a-zA-Z_]\w*(?:\s*,\s*[a-zA-Z_]\w*)*)\s*\)?\s*=>\s*(.+)$`)
+
+// lambdaHelpers are the list helpers that accept a lambda and the number of parameters their lambda takes.
+var lambdaHelpers = map[string]int{
+	"map":    1,
+	"filter": 1,
+	"reduce": 2,
+}
+
+// lambdaResults contains the variables that hold the result of a lowered reduce() call,
+// their type is inferred from the value of the lambda.
+var lambdaResults map[string]bool
+
+var lambdaIdx int
+
+// handleLambdas lowers calls to the list helpers map(), filter() and reduce() that are given a lambda into repeat each loops.
+func handleLambdas() {
+	lambdaResults = make(map[string]bool)
+	lambdaIdx = 0
+	for lambdaHelperRegex.MatchString(contents) {
+		if parseLambdas() == 0 {
+			break
+		}
+	}
+}
+
+func parseLambdas() (lowered int) {
+	for char != -1 {
+		switch {
+		case char == '"':
+			advance()
+			collectString()
+		case char == '\'':
+			advance()
+			collectRawString()
+		case commentAhead():
+			collectComment()
+		case lambdaHelperAhead():
+			if lowerLambdaHelper() {
+				lowered++
+				advanceUntil('\n')
+			}
+		}
+		advance()
+	}
+
+	resetParse()
+
+	return
+}
+
+func lambdaHelperAhead() bool {
+	var previous = prev(1)
+	if !unicode.IsLetter(char) || unicode.IsLetter(previous) || unicode.IsDigit(previous) || previous == '_' || previous == '@' {
+		return false
+	}
+
+	var match = lambdaHelperRegex.FindStringIndex(lookAheadUntil('\n'))
+	return match != nil && match[0] == 0
+}
+
+// lowerLambdaHelper replaces the current line with a repeat each loop that collects the result of the
+// lambda helper call into a variable, followed by the line with the call replaced by that variable.
+// The lines it is lowered into are mapped to the current line so errors are reported on the line of the call.
+func lowerLambdaHelper() bool {
+	var line = []rune(lines[lineIdx])
+	var callStart = lineCharIdx
+	var identifier = collectIdentifier()
+	var arguments, callEnd = splitLambdaArguments(line, lineCharIdx)
+	if len(arguments) < 2 || !strings.Contains(arguments[1], "=>") {
+		return false
+	}
+
+	var lambda = lambdaRegex.FindStringSubmatch(strings.TrimSpace(arguments[1]))
+	if lambda == nil {
+		parserError(fmt.Sprintf("Invalid lambda for %s(), expected: (item) => value", identifier))
+	}
+
+	var params = strings.Split(lambda[1], ",")
+	for i, param := range params {
+		params[i] = strings.TrimSpace(param)
+	}
+	if len(params) != lambdaHelpers[identifier] {
+		parserError(fmt.Sprintf("Lambda for %s() must take %d parameter(s), got %d.", identifier, lambdaHelpers[identifier], len(params)))
+	}
+
+	var expectedArguments = 2
+	if identifier == "reduce" {
+		expectedArguments = 3
+	}
+	if len(arguments) != expectedArguments {
+		parserError(fmt.Sprintf("%s() expects %d arguments, got %d.", identifier, expectedArguments, len(arguments)))
+	}
+
+	// Results assigned directly to a variable are collected into that variable.
+	lambdaIdx++
+	var result string
+	var assignment = lambdaAssignmentRegex.FindStringSubmatch(string(line[:callStart]))
+	var remaining = strings.TrimSpace(string(line[callEnd:]))
+	if assignment != nil && remaining == "" && !strings.Contains(strings.Join(arguments, ","), "@"+assignment[1]) {
+		result = assignment[1]
+	} else {
+		result = fmt.Sprintf("_%s_cherri_result_%d", identifier, lambdaIdx)
+	}
+
+	// The item is repeated with a unique name so that it does not overwrite a variable with the same name as the parameter.
+	var itemParam = params[len(params)-1]
+	var item = fmt.Sprintf("_%s_cherri_%s_%d", identifier, itemParam, lambdaIdx)
+	var bindings = map[string]string{itemParam: item}
+	if identifier == "reduce" {
+		bindings[params[0]] = result
+		lambdaResults[result] = true
+	}
+	var body = bindLambdaParameters(strings.TrimSpace(lambda[2]), bindings)
+
+	var indent = string(line[:len(line)-len([]rune(strings.TrimLeft(string(line), " \t")))])
+	var lowered strings.Builder
+	switch identifier {
+	case "map", "filter":
+		lowered.WriteString(fmt.Sprintf("%s@%s: array\n", indent, result))
+	case "reduce":
+		lowered.WriteString(fmt.Sprintf("%s@%s = %s\n", indent, result, strings.TrimSpace(arguments[2])))
+	}
+	lowered.WriteString(fmt.Sprintf("%sfor %s in %s {\n", indent, item, strings.TrimSpace(arguments[0])))
+	switch identifier {
+	case "map":
+		lowered.WriteString(fmt.Sprintf("%s\t@%s += %s\n", indent, result, body))
+	case "filter":
+		lowered.WriteString(fmt.Sprintf("%s\tif %s {\n", indent, body))
+		lowered.WriteString(fmt.Sprintf("%s\t\t@%s += @%s\n", indent, result, item))
+		lowered.WriteString(fmt.Sprintf("%s\t}\n", indent))
+	case "reduce":
+		lowered.WriteString(fmt.Sprintf("%s\t@%s = %s\n", indent, result, body))
+	}
+	lowered.WriteString(fmt.Sprintf("%s}", indent))
+	if assignment == nil || result != assignment[1] {
+		lowered.WriteString("\n" + string(line[:callStart]) + "@" + result + string(line[callEnd:]))
+	}
+
+	lines[lineIdx] = lowered.String()
+
+	return true
+}
+
+// splitLambdaArguments splits the arguments of a call starting at the opening parenthesis at start,
+// and returns the index after the closing parenthesis.
+func splitLambdaArguments(line []rune, start int) (arguments []string, end int) {
+	var depth = 0
+	var argument strings.Builder
+	var quote rune
+	for end = start; end < len(line); end++ {
+		var ch = line[end]
+		if quote != 0 {
+			argument.WriteRune(ch)
+			if ch == '\\' && end+1 < len(line) {
+				end++
+				argument.WriteRune(line[end])
+				continue
+			}
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch ch {
+		case '"', '\'':
+			quote = ch
+		case '(', '[', '{':
+			depth++
+			if depth == 1 && ch == '(' {
+				continue
+			}
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				arguments = append(arguments, argument.String())
+				return arguments, end + 1
+			}
+		case ',':
+			if depth == 1 {
+				arguments = append(arguments, argument.String())
+				argument.Reset()
+				continue
+			}
+		}
+		argument.WriteRune(ch)
+	}
+
+	parserError("Expected closing parenthesis")
+	return
+}
+
+// bindLambdaParameters replaces references to lambda parameters in body with references to the variables they are bound to.
+func bindLambdaParameters(body string, bindings map[string]string) string {
+	var chars = []rune(body)
+	var bound strings.Builder
+	var quote rune
+	for i := 0; i < len(chars); i++ {
+		var ch = chars[i]
+		if quote == 0 && (ch == '"' || ch == '\'') {
+			quote = ch
+			bound.WriteRune(ch)
+			continue
+		}
+		if quote != 0 {
+			switch {
+			case ch == '\\' && i+1 < len(chars):
+				bound.WriteRune(ch)
+				i++
+				bound.WriteRune(chars[i])
+				continue
+			case ch == quote:
+				quote = 0
+			case ch == '{' && quote == '"':
+				var start = i + 1
+				if start < len(chars) && chars[start] == '@' {
+					start++
+				}
+				var identifier = lambdaIdentifierAt(chars, start)
+				var after = start + len([]rune(identifier))
+				if variable, found := bindings[identifier]; found && after < len(chars) && strings.ContainsRune("}[.", chars[after]) {
+					bound.WriteString("{@" + variable)
+					i = after - 1
+					continue
+				}
+			}
+			bound.WriteRune(ch)
+			continue
+		}
+
+		if unicode.IsLetter(ch) || ch == '_' {
+			var identifier = lambdaIdentifierAt(chars, i)
+			var after = i + len([]rune(identifier))
+			var previous rune
+			if i > 0 {
+				previous = chars[i-1]
+			}
+			if variable, found := bindings[identifier]; found && (after >= len(chars) || chars[after] != '(') {
+				if previous != '@' {
+					bound.WriteRune('@')
+				}
+				bound.WriteString(variable)
+			} else {
+				bound.WriteString(identifier)
+			}
+			i = after - 1
+			continue
+		}
+
+		bound.WriteRune(ch)
+	}
+
+	return bound.String()
+}
+
+func lambdaIdentifierAt(chars []rune, start int) string {
+	var end = start
+	for end < len(chars) && (unicode.IsLetter(chars[end]) || unicode.IsDigit(chars[end]) || chars[end] == '_') {
+		end++
+	}
+
+	return string(chars[start:end])
+}
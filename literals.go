@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Literals
+
+Date literals (d"2026-10-17 09:00"), duration literals (5min, 2h, 30s) and regular expression
+literals (/pattern/flags) are validated at compile time. Duration literals are quantities of a unit
+of the timeDuration enum. Flags of regular expression literals are added to the pattern as inline flags,
+the pattern is checked against the ICU regular expression syntax used by Shortcuts.
+
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dateLiteralLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+	"15:04",
+	"15:04:05",
+}
+
+var durationLiteralRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)(hr|h|min|sec|s)\b`)
+
+var durationUnits = map[string]string{
+	"h":   "hr",
+	"hr":  "hr",
+	"min": "min",
+	"s":   "sec",
+	"sec": "sec",
+}
+
+const regexFlags = "imsx"
+
+// icuOnlySyntax matches ICU regular expression syntax that is not supported by Go, with the syntax it is checked as.
+var icuOnlySyntax = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`\(\?(?:=|!|<=|<!|>)`), "(?:"},
+	{regexp.MustCompile(`([*+?}])\+`), "$1"},
+	{regexp.MustCompile(`\\(?:[1-9]|k<\w+>)`), "x"},
+	{regexp.MustCompile(`\\u([0-9A-Fa-f]{4})`), `\x{$1}`},
+	{regexp.MustCompile(`\\[hHRXVeG]`), "."},
+	{regexp.MustCompile(`\\Z`), `\z`},
+	{regexp.MustCompile(`\\N\{[^}]*}`), "."},
+}
+
+func collectDateLiteral(valueType *tokenType, value *any) {
+	advanceTimes(2)
+	var date = collectString()
+	if _, valid := parseDateLiteral(date); !valid {
+		parserError(fmt.Sprintf("Invalid date '%s', expected a date (YYYY-MM-DD), a time (HH:MM) or a date and time (YYYY-MM-DD HH:MM).", date))
+	}
+
+	*valueType = Date
+	*value = date
+}
+
+func parseDateLiteral(date string) (time.Time, bool) {
+	for _, layout := range dateLiteralLayouts {
+		if parsed, parseErr := time.ParseInLocation(layout, date, time.Local); parseErr == nil {
+			return parsed, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func durationLiteralAhead() bool {
+	return durationLiteralRegex.MatchString(restOfLine())
+}
+
+// collectDurationLiteral collects a duration literal as a quantity of a unit of the timeDuration enum.
+func collectDurationLiteral(valueType *tokenType, value *any) {
+	var matches = durationLiteralRegex.FindStringSubmatch(restOfLine())
+	advanceTimes(len(matches[0]))
+
+	var magnitude = actionArgument{valueType: Integer}
+	if strings.Contains(matches[1], ".") {
+		var float, floatErr = strconv.ParseFloat(matches[1], 64)
+		handle(floatErr)
+		magnitude.valueType = Float
+		magnitude.value = float
+	} else {
+		var integer, convErr = strconv.Atoi(matches[1])
+		handle(convErr)
+		magnitude.value = integer
+	}
+
+	*valueType = Quantity
+	*value = []actionArgument{
+		magnitude,
+		{valueType: String, value: durationUnits[matches[2]]},
+	}
+}
+
+func regexLiteralAhead() bool {
+	return char == '/' && next(1) != '/' && next(1) != '*'
+}
+
+// collectRegexLiteral collects a regular expression literal, its flags are added to the pattern as inline flags.
+func collectRegexLiteral(valueType *tokenType, value *any) {
+	advance()
+	var pattern strings.Builder
+	var inClass bool
+	for char != '/' || inClass {
+		switch char {
+		case -1, '\n':
+			parserError("Regular expression is not terminated, expected closing /")
+		case '\\':
+			pattern.WriteRune(char)
+			advance()
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		}
+		pattern.WriteRune(char)
+		advance()
+	}
+	advance()
+
+	var flags strings.Builder
+	for isIdentifierChar(char) && char != '.' && char != '@' {
+		if !strings.ContainsRune(regexFlags, char) {
+			parserError(fmt.Sprintf("Invalid regular expression flag '%c', available flags: %s", char, strings.Join(strings.Split(regexFlags, ""), ", ")))
+		}
+		if !strings.ContainsRune(flags.String(), char) {
+			flags.WriteRune(char)
+		}
+		advance()
+	}
+
+	var expression = pattern.String()
+	if flags.Len() != 0 {
+		expression = fmt.Sprintf("(?%s)%s", flags.String(), expression)
+	}
+	checkRegex(expression)
+
+	*valueType = Regex
+	*value = expression
+}
+
+// checkRegex checks that pattern is a valid ICU regular expression.
+func checkRegex(pattern string) {
+	if pattern == "" {
+		parserError("Empty regular expression.")
+	}
+
+	var goPattern = pattern
+	for _, icuSyntax := range icuOnlySyntax {
+		goPattern = icuSyntax.pattern.ReplaceAllString(goPattern, icuSyntax.replacement)
+	}
+	if _, parseErr := syntax.Parse(goPattern, syntax.Perl); parseErr != nil {
+		var syntaxErr *syntax.Error
+		var message = parseErr.Error()
+		if errors.As(parseErr, &syntaxErr) {
+			message = fmt.Sprintf("%s: %s", syntaxErr.Code, syntaxErr.Expr)
+		}
+		parserError(fmt.Sprintf("Invalid regular expression '%s': %s", pattern, message))
+	}
+}
+
+// checkRegexArgument checks a text pattern given for a regular expression argument, if it does not contain inline variables.
+func checkRegexArgument(argument *actionArgument) {
+	switch argument.valueType {
+	case RawString:
+		checkRegex(argument.value.(string))
+	case String:
+		var pattern = argument.value.(string)
+		if !strings.ContainsAny(pattern, "{}") {
+			checkRegex(pattern)
+		}
+	}
+}
+
+// checkQuantityUnit checks that the unit of a quantity is a value of the enum of param.
+func checkQuantityUnit(param *parameterDefinition, argument *actionArgument) {
+	var quantity = argument.value.([]actionArgument)
+	if len(quantity) < 2 || quantity[1].valueType != String {
+		return
+	}
+
+	var unit = quantity[1].value.(string)
+	if enumerations[param.enum] != nil && !slices.Contains(enumerations[param.enum], unit) {
+		parserError(
+			fmt.Sprintf(
+				"Invalid unit '%s' for argument '%s'.\n\n%s",
+				unit,
+				param.name,
+				generateActionDefinition(*param, true),
+			),
+		)
+	}
+}
@@ -0,0 +1,276 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Localization
+
+t("key") is replaced with the text for the key in the string table of the locale being compiled.
+String tables are JSON files in the locales directory next to the file being compiled, named after
+a value of the language enum (e.g. locales/de-DE.json), nested objects are flattened into dotted keys.
+
+A Shortcut is compiled for each locale if the file uses t(), or for a single locale using --locale.
+Keys missing from the string table of a locale are reported, and --extract-strings lists every key used.
+
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/electrikmilk/args-parser"
+)
+
+// stringTables contains the string table of each locale.
+var stringTables map[string]map[string]string
+
+// currentLocale is the locale being compiled.
+var currentLocale string
+
+var translateRegex = regexp.MustCompile(`^t\(\s*"((?:[^"\\]|\\.)*)"\s*\)`)
+var translateUsageRegex = regexp.MustCompile(`(?:^|[^\w.])t\(\s*"`)
+
+const localesDirectory = "locales"
+
+// handleLocales compiles the Shortcut for each locale if string tables are defined and used, returns true if the locales were compiled.
+func handleLocales() bool {
+	if args.Using("locale") {
+		currentLocale = args.Value("locale")
+		return false
+	}
+	if args.Using("extract-strings") {
+		return false
+	}
+
+	var locales = localeNames(filepath.Join(filepath.Dir(filePath), localesDirectory))
+	if len(locales) < 2 || !usesLocalization() {
+		return false
+	}
+
+	for _, locale := range locales {
+		fmt.Println(ansi(fmt.Sprintf("Compiling locale %s...", locale), bold))
+		if compileErr := runCompiler("--locale=" + locale); compileErr != nil {
+			exit(fmt.Sprintf("Failed to compile locale '%s': %s", locale, compileErr))
+		}
+	}
+
+	return true
+}
+
+// usesLocalization checks if the file being compiled references a key in the string tables.
+func usesLocalization() bool {
+	var fileBytes, readErr = os.ReadFile(filePath)
+	handle(readErr)
+
+	return translateUsageRegex.Match(fileBytes)
+}
+
+// localeNames returns the names of the string tables in directory.
+func localeNames(directory string) (locales []string) {
+	var files, readErr = os.ReadDir(directory)
+	if readErr != nil {
+		return
+	}
+	for _, file := range files {
+		if !file.IsDir() && filepath.Ext(file.Name()) == ".json" {
+			locales = append(locales, strings.TrimSuffix(file.Name(), ".json"))
+		}
+	}
+
+	return
+}
+
+// handleLocalization replaces t("key") with the text for the key in the string table of the current locale.
+func handleLocalization() {
+	if !strings.Contains(contents, "t(") {
+		return
+	}
+
+	parseLocalization()
+}
+
+func parseLocalization() {
+	var keys []string
+	var keyLines = make(map[string]int)
+	var replacements []sourceReplacement
+	for char != -1 {
+		switch {
+		case char == '"':
+			advance()
+			collectString()
+			continue
+		case commentAhead():
+			collectComment()
+		case char == 't' && !isIdentifierChar(prev(1)):
+			var matches = translateRegex.FindStringSubmatch(restOfLine())
+			if matches == nil {
+				break
+			}
+
+			var key = unescapeStringLiteral(matches[1])
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+				keyLines[key] = lineIdx
+			}
+
+			var length = len([]rune(matches[0]))
+			replacements = append(replacements, sourceReplacement{line: lineIdx, column: lineCharIdx, length: length, value: key})
+			advanceTimes(length)
+			continue
+		}
+		advance()
+	}
+	if len(keys) == 0 {
+		resetParse()
+		return
+	}
+
+	loadStringTables()
+
+	if args.Using("extract-strings") {
+		printStringKeys(keys)
+		os.Exit(0)
+	}
+
+	selectLocale(keyLines[keys[0]])
+	reportMissingStrings(keys)
+
+	var table = stringTables[currentLocale]
+	for _, replacement := range slices.Backward(replacements) {
+		var text, found = table[replacement.value]
+		if !found {
+			text = replacement.value
+		}
+
+		var line = []rune(lines[replacement.line])
+		lines[replacement.line] = string(line[:replacement.column]) + stringLiteral(text) + string(line[replacement.column+replacement.length:])
+	}
+
+	resetParse()
+}
+
+// loadStringTables loads the string table of each locale from the locales directory.
+func loadStringTables() {
+	stringTables = make(map[string]map[string]string)
+	var directory = relativePath + localesDirectory
+	for _, locale := range localeNames(directory) {
+		if !slices.Contains(enumerations["language"], locale) {
+			parserError(fmt.Sprintf("Invalid locale '%s', string tables must be named after a language.\n\n%s", locale, generateActionParamEnums(parameterDefinition{enum: "language"})))
+		}
+
+		var tableBytes, readErr = os.ReadFile(filepath.Join(directory, locale+".json"))
+		handle(readErr)
+
+		var table map[string]any
+		if jsonErr := json.Unmarshal(tableBytes, &table); jsonErr != nil {
+			parserError(fmt.Sprintf("Invalid JSON in string table '%s': %s", locale, jsonErr))
+		}
+
+		stringTables[locale] = make(map[string]string)
+		flattenStringTable(stringTables[locale], "", table)
+	}
+	if len(stringTables) == 0 {
+		parserError(fmt.Sprintf("No string tables found, expected: %s/{language}.json", localesDirectory))
+	}
+}
+
+func flattenStringTable(table map[string]string, prefix string, values map[string]any) {
+	for key, value := range values {
+		if nested, ok := value.(map[string]any); ok {
+			flattenStringTable(table, prefix+key+".", nested)
+			continue
+		}
+
+		table[prefix+key] = fmt.Sprintf("%v", value)
+	}
+}
+
+// selectLocale uses the only string table if a locale was not selected.
+func selectLocale(line int) {
+	if currentLocale == "" && args.Using("locale") {
+		currentLocale = args.Value("locale")
+	}
+	if currentLocale == "" {
+		if len(stringTables) != 1 {
+			lineIdx = line
+			parserError(fmt.Sprintf("Multiple string tables, compile for a locale using --locale (e.g. --locale=%s).", slices.Sorted(maps.Keys(stringTables))[0]))
+		}
+		for locale := range stringTables {
+			currentLocale = locale
+		}
+	}
+	if _, found := stringTables[currentLocale]; !found {
+		exit(fmt.Sprintf("No string table for locale '%s', expected: %s/%s.json", currentLocale, localesDirectory, currentLocale))
+	}
+}
+
+// reportMissingStrings warns about keys missing from the string table of the current locale, the key is used as the text instead.
+func reportMissingStrings(keys []string) {
+	var missing = missingStrings(currentLocale, keys)
+	if len(missing) == 0 {
+		return
+	}
+
+	fmt.Println(ansi("Warning:", yellow, bold), fmt.Sprintf("Missing strings for locale '%s':\n- %s\n", currentLocale, strings.Join(missing, "\n- ")))
+}
+
+func missingStrings(locale string, keys []string) (missing []string) {
+	for _, key := range keys {
+		if _, found := stringTables[locale][key]; !found {
+			missing = append(missing, key)
+		}
+	}
+
+	return
+}
+
+// printStringKeys lists every key used and the locales it is missing from.
+func printStringKeys(keys []string) {
+	var locales = slices.Sorted(maps.Keys(stringTables))
+	for _, key := range slices.Sorted(slices.Values(keys)) {
+		var missingFrom []string
+		for _, locale := range locales {
+			if _, found := stringTables[locale][key]; !found {
+				missingFrom = append(missingFrom, locale)
+			}
+		}
+		if len(missingFrom) != 0 {
+			fmt.Printf("%s %s\n", key, ansi(fmt.Sprintf("(missing: %s)", strings.Join(missingFrom, ", ")), yellow))
+			continue
+		}
+
+		fmt.Println(key)
+	}
+}
+
+// stringLiteral makes text into a string literal, braces in the text are parsed as inline variable references.
+func stringLiteral(text string) string {
+	var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+	return fmt.Sprintf("\"%s\"", escaper.Replace(text))
+}
+
+// applyLocaleName adds the current locale to the name of the Shortcut.
+func applyLocaleName() {
+	if currentLocale == "" {
+		return
+	}
+
+	workflowName += localeSuffix()
+}
+
+func localeSuffix() string {
+	if currentLocale == "" {
+		return ""
+	}
+
+	return " " + currentLocale
+}
@@ -0,0 +1,553 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+LZFSE
+
+Decoder for LZFSE compressed data, which is used to compress the contents of signed Shortcuts.
+A stream is a sequence of uncompressed, LZVN or LZFSE (v2) blocks terminated by an end of stream block.
+
+LZFSE blocks contain literals and L, M, D (literal length, match length, match distance) values
+encoded using finite state entropy. Both are read backwards from the end of their payloads.
+
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+const (
+	lzfseEndOfStreamMagic  = "bvx$"
+	lzfseUncompressedMagic = "bvx-"
+	lzfseCompressedV2Magic = "bvx2"
+	lzfseLZVNMagic         = "bvxn"
+)
+
+const (
+	lzfseLSymbols         = 20
+	lzfseMSymbols         = 20
+	lzfseDSymbols         = 64
+	lzfseLiteralSymbols   = 256
+	lzfseLStates          = 64
+	lzfseMStates          = 64
+	lzfseDStates          = 256
+	lzfseLiteralStates    = 1024
+	lzfseLiteralsPerBlock = 4 * 10000
+	lzfseV2HeaderSize     = 32
+)
+
+var errLZFSECorrupt = errors.New("corrupt LZFSE data")
+
+var lzfseLExtraBits = []uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 3, 5, 8}
+var lzfseMExtraBits = []uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 3, 5, 8, 11}
+var lzfseDExtraBits = []uint8{
+	0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3,
+	4, 4, 4, 4, 5, 5, 5, 5, 6, 6, 6, 6, 7, 7, 7, 7,
+	8, 8, 8, 8, 9, 9, 9, 9, 10, 10, 10, 10, 11, 11, 11, 11,
+	12, 12, 12, 12, 13, 13, 13, 13, 14, 14, 14, 14, 15, 15, 15, 15,
+}
+
+// Number of bits and value of the variable length frequencies in the header of v2 blocks, indexed by the next 5 bits.
+var lzfseFreqBits = [32]int{
+	2, 3, 2, 5, 2, 3, 2, 8, 2, 3, 2, 5, 2, 3, 2, 14,
+	2, 3, 2, 5, 2, 3, 2, 8, 2, 3, 2, 5, 2, 3, 2, 14,
+}
+var lzfseFreqValues = [32]uint16{
+	0, 2, 1, 4, 0, 3, 1, 0, 0, 2, 1, 5, 0, 3, 1, 0,
+	0, 2, 1, 6, 0, 3, 1, 0, 0, 2, 1, 7, 0, 3, 1, 0,
+}
+
+type lzfseBlockHeader struct {
+	rawBytes            uint32
+	literals            uint32
+	matches             uint32
+	literalPayloadBytes uint32
+	lmdPayloadBytes     uint32
+	literalBits         int
+	literalStates       [4]int
+	lmdBits             int
+	lState              int
+	mState              int
+	dState              int
+	freq                [lzfseLSymbols + lzfseMSymbols + lzfseDSymbols + lzfseLiteralSymbols]uint16
+}
+
+// fseInStream reads bits backwards from src, starting at the end of a payload.
+type fseInStream struct {
+	src       []byte
+	pos       int
+	accum     uint64
+	accumBits int
+}
+
+type fseDecoderEntry struct {
+	bits   int
+	symbol uint8
+	delta  int
+}
+
+type fseValueDecoderEntry struct {
+	totalBits int
+	valueBits uint8
+	delta     int
+	base      int
+}
+
+// lzfseDecompress decompresses the LZFSE stream at the start of src and returns the number of bytes of src it used.
+func lzfseDecompress(src []byte) (dst []byte, read int, err error) {
+	var pos int
+	for {
+		if pos+8 > len(src) {
+			if pos+4 <= len(src) && string(src[pos:pos+4]) == lzfseEndOfStreamMagic {
+				return dst, pos + 4, nil
+			}
+			return nil, 0, errLZFSECorrupt
+		}
+
+		var rawBytes = int(binary.LittleEndian.Uint32(src[pos+4:]))
+		var blockStart = len(dst)
+		switch string(src[pos : pos+4]) {
+		case lzfseEndOfStreamMagic:
+			return dst, pos + 4, nil
+		case lzfseUncompressedMagic:
+			if pos+8+rawBytes > len(src) {
+				return nil, 0, errLZFSECorrupt
+			}
+			dst = append(dst, src[pos+8:pos+8+rawBytes]...)
+			pos += 8 + rawBytes
+		case lzfseLZVNMagic:
+			if pos+12 > len(src) {
+				return nil, 0, errLZFSECorrupt
+			}
+			var payloadEnd = pos + 12 + int(binary.LittleEndian.Uint32(src[pos+8:]))
+			if payloadEnd > len(src) {
+				return nil, 0, errLZFSECorrupt
+			}
+			if dst, err = lzvnDecode(dst, src[pos+12:payloadEnd]); err != nil {
+				return nil, 0, err
+			}
+			pos = payloadEnd
+		case lzfseCompressedV2Magic:
+			var header, headerSize, headerErr = lzfseV2BlockHeader(src[pos:])
+			if headerErr != nil {
+				return nil, 0, headerErr
+			}
+			pos += headerSize
+			if dst, pos, err = lzfseDecodeBlock(dst, src, pos, &header); err != nil {
+				return nil, 0, err
+			}
+		default:
+			return nil, 0, errLZFSECorrupt
+		}
+
+		if len(dst)-blockStart != rawBytes {
+			return nil, 0, errLZFSECorrupt
+		}
+	}
+}
+
+// lzfseStreamIndex returns the index of the first block of an LZFSE stream in src, or -1 if there is none.
+func lzfseStreamIndex(src []byte) int {
+	for i := 0; i+4 <= len(src); i++ {
+		switch string(src[i : i+4]) {
+		case lzfseUncompressedMagic, lzfseLZVNMagic, lzfseCompressedV2Magic:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// lzfseV2BlockHeader decodes the packed fields and frequency tables of the header of a v2 block.
+func lzfseV2BlockHeader(block []byte) (header lzfseBlockHeader, size int, err error) {
+	if len(block) < lzfseV2HeaderSize {
+		return header, 0, errLZFSECorrupt
+	}
+
+	var v0 = binary.LittleEndian.Uint64(block[8:])
+	var v1 = binary.LittleEndian.Uint64(block[16:])
+	var v2 = binary.LittleEndian.Uint64(block[24:])
+
+	header.rawBytes = binary.LittleEndian.Uint32(block[4:])
+	header.literals = packedField(v0, 0, 20)
+	header.literalPayloadBytes = packedField(v0, 20, 20)
+	header.matches = packedField(v0, 40, 20)
+	header.literalBits = int(packedField(v0, 60, 3)) - 7
+	for i := range header.literalStates {
+		header.literalStates[i] = int(packedField(v1, i*10, 10))
+	}
+	header.lmdPayloadBytes = packedField(v1, 40, 20)
+	header.lmdBits = int(packedField(v1, 60, 3)) - 7
+	header.lState = int(packedField(v2, 32, 10))
+	header.mState = int(packedField(v2, 42, 10))
+	header.dState = int(packedField(v2, 52, 10))
+
+	size = int(packedField(v2, 0, 32))
+	if size < lzfseV2HeaderSize || size > len(block) {
+		return header, 0, errLZFSECorrupt
+	}
+	if size == lzfseV2HeaderSize {
+		return header, size, nil
+	}
+
+	var pos = lzfseV2HeaderSize
+	var accum uint32
+	var accumBits int
+	for i := range header.freq {
+		for pos < size && accumBits+8 <= 32 {
+			accum |= uint32(block[pos]) << accumBits
+			accumBits += 8
+			pos++
+		}
+
+		var nbits = lzfseFreqBits[accum&31]
+		switch nbits {
+		case 8:
+			header.freq[i] = uint16(8 + (accum>>4)&0xf)
+		case 14:
+			header.freq[i] = uint16(24 + (accum>>4)&0x3ff)
+		default:
+			header.freq[i] = lzfseFreqValues[accum&31]
+		}
+		if nbits > accumBits {
+			return header, 0, errLZFSECorrupt
+		}
+
+		accum >>= nbits
+		accumBits -= nbits
+	}
+	if accumBits >= 8 || pos != size {
+		return header, 0, errLZFSECorrupt
+	}
+
+	return header, size, nil
+}
+
+func packedField(v uint64, offset int, nbits int) uint32 {
+	return uint32((v >> offset) & (1<<nbits - 1))
+}
+
+// lzfseDecodeBlock decodes the literals and matches of a compressed block with its payload at pos in src.
+func lzfseDecodeBlock(dst []byte, src []byte, pos int, header *lzfseBlockHeader) ([]byte, int, error) {
+	var literalsEnd = pos + int(header.literalPayloadBytes)
+	var lmdEnd = literalsEnd + int(header.lmdPayloadBytes)
+	if lmdEnd > len(src) || header.literals > lzfseLiteralsPerBlock || header.literals%4 != 0 {
+		return nil, 0, errLZFSECorrupt
+	}
+
+	var lFreq = header.freq[:lzfseLSymbols]
+	var mFreq = header.freq[lzfseLSymbols : lzfseLSymbols+lzfseMSymbols]
+	var dFreq = header.freq[lzfseLSymbols+lzfseMSymbols : lzfseLSymbols+lzfseMSymbols+lzfseDSymbols]
+	var literalFreq = header.freq[lzfseLSymbols+lzfseMSymbols+lzfseDSymbols:]
+
+	var literalTable, literalErr = fseDecoderTable(lzfseLiteralStates, literalFreq)
+	var lTable, lErr = fseValueDecoderTable(lzfseLStates, lFreq, lzfseLExtraBits)
+	var mTable, mErr = fseValueDecoderTable(lzfseMStates, mFreq, lzfseMExtraBits)
+	var dTable, dErr = fseValueDecoderTable(lzfseDStates, dFreq, lzfseDExtraBits)
+	if tableErr := errors.Join(literalErr, lErr, mErr, dErr); tableErr != nil {
+		return nil, 0, tableErr
+	}
+
+	var literals = make([]byte, header.literals)
+	var in = fseInStream{src: src}
+	if err := in.init(literalsEnd, header.literalBits); err != nil {
+		return nil, 0, err
+	}
+	var states = header.literalStates
+	for i := 0; i < len(literals); i += 4 {
+		if err := in.flush(); err != nil {
+			return nil, 0, err
+		}
+		for s := range states {
+			var symbol, decodeErr = fseDecode(&states[s], literalTable, &in)
+			if decodeErr != nil {
+				return nil, 0, decodeErr
+			}
+			literals[i+s] = symbol
+		}
+	}
+
+	in = fseInStream{src: src}
+	if err := in.init(lmdEnd, header.lmdBits); err != nil {
+		return nil, 0, err
+	}
+	var lState, mState, dState = header.lState, header.mState, header.dState
+	var literal int
+	var distance = -1
+	for range header.matches {
+		if err := in.flush(); err != nil {
+			return nil, 0, err
+		}
+		var l, lDecodeErr = fseValueDecode(&lState, lTable, &in)
+		var m, mDecodeErr = fseValueDecode(&mState, mTable, &in)
+		var d, dDecodeErr = fseValueDecode(&dState, dTable, &in)
+		if decodeErr := errors.Join(lDecodeErr, mDecodeErr, dDecodeErr); decodeErr != nil {
+			return nil, 0, decodeErr
+		}
+		if d != 0 {
+			distance = d
+		}
+
+		if literal+l > len(literals) {
+			return nil, 0, errLZFSECorrupt
+		}
+		dst = append(dst, literals[literal:literal+l]...)
+		literal += l
+
+		var copyErr error
+		if dst, copyErr = copyMatch(dst, distance, m); copyErr != nil {
+			return nil, 0, copyErr
+		}
+	}
+
+	return dst, lmdEnd, nil
+}
+
+// copyMatch appends length bytes starting distance bytes back from the end of dst, the match can overlap itself.
+func copyMatch(dst []byte, distance int, length int) ([]byte, error) {
+	if length == 0 {
+		return dst, nil
+	}
+	if distance <= 0 || distance > len(dst) {
+		return nil, errLZFSECorrupt
+	}
+
+	for range length {
+		dst = append(dst, dst[len(dst)-distance])
+	}
+
+	return dst, nil
+}
+
+func (in *fseInStream) init(end int, nbits int) error {
+	if nbits != 0 {
+		if end < 8 {
+			return errLZFSECorrupt
+		}
+		in.pos = end - 8
+		in.accum = binary.LittleEndian.Uint64(in.src[in.pos:end])
+		in.accumBits = nbits + 64
+	} else {
+		if end < 7 {
+			return errLZFSECorrupt
+		}
+		in.pos = end - 7
+		var accum [8]byte
+		copy(accum[:], in.src[in.pos:end])
+		in.accum = binary.LittleEndian.Uint64(accum[:])
+		in.accumBits = 56
+	}
+
+	if in.accumBits < 56 || in.accumBits >= 64 || in.accum>>in.accumBits != 0 {
+		return errLZFSECorrupt
+	}
+
+	return nil
+}
+
+// flush reads whole bytes into the accumulator until it holds at least 56 bits.
+func (in *fseInStream) flush() error {
+	var nbits = (63 - in.accumBits) & -8
+	var nbytes = nbits >> 3
+	if in.pos < nbytes {
+		return errLZFSECorrupt
+	}
+
+	in.pos -= nbytes
+	var incoming uint64
+	for i := nbytes - 1; i >= 0; i-- {
+		incoming = incoming<<8 | uint64(in.src[in.pos+i])
+	}
+	in.accum = in.accum<<nbits | incoming
+	in.accumBits += nbits
+
+	return nil
+}
+
+func (in *fseInStream) pull(nbits int) (uint64, error) {
+	if nbits > in.accumBits {
+		return 0, errLZFSECorrupt
+	}
+
+	in.accumBits -= nbits
+	var result = in.accum >> in.accumBits
+	in.accum &= 1<<in.accumBits - 1
+
+	return result, nil
+}
+
+// fseDecoderTable makes a table of the symbol, number of bits and state delta for each state.
+func fseDecoderTable(states int, freq []uint16) ([]fseDecoderEntry, error) {
+	var table = make([]fseDecoderEntry, 0, states)
+	for symbol, f := range freq {
+		if f == 0 {
+			continue
+		}
+		if len(table)+int(f) > states {
+			return nil, errLZFSECorrupt
+		}
+
+		var k, j0 = fseStateBits(states, int(f))
+		for j := range int(f) {
+			var entry = fseDecoderEntry{symbol: uint8(symbol)}
+			if j < j0 {
+				entry.bits = k
+				entry.delta = ((int(f) + j) << k) - states
+			} else {
+				entry.bits = k - 1
+				entry.delta = (j - j0) << (k - 1)
+			}
+			table = append(table, entry)
+		}
+	}
+
+	return table, nil
+}
+
+// fseValueDecoderTable makes a table of the value base, number of value bits and state delta for each state.
+func fseValueDecoderTable(states int, freq []uint16, extraBits []uint8) ([]fseValueDecoderEntry, error) {
+	var table = make([]fseValueDecoderEntry, 0, states)
+	var base int
+	for symbol, f := range freq {
+		var symbolBase = base
+		base += 1 << extraBits[symbol]
+		if f == 0 {
+			continue
+		}
+		if len(table)+int(f) > states {
+			return nil, errLZFSECorrupt
+		}
+
+		var k, j0 = fseStateBits(states, int(f))
+		for j := range int(f) {
+			var entry = fseValueDecoderEntry{valueBits: extraBits[symbol], base: symbolBase}
+			if j < j0 {
+				entry.totalBits = k + int(entry.valueBits)
+				entry.delta = ((int(f) + j) << k) - states
+			} else {
+				entry.totalBits = k - 1 + int(entry.valueBits)
+				entry.delta = (j - j0) << (k - 1)
+			}
+			table = append(table, entry)
+		}
+	}
+
+	return table, nil
+}
+
+// fseStateBits returns the number of bits read for the states of a symbol with frequency f,
+// and the number of its states that read one bit less than that.
+func fseStateBits(states int, f int) (k int, j0 int) {
+	k = bits.LeadingZeros32(uint32(f)) - bits.LeadingZeros32(uint32(states))
+	j0 = ((2 * states) >> k) - f
+	return
+}
+
+func fseDecode(state *int, table []fseDecoderEntry, in *fseInStream) (uint8, error) {
+	if *state >= len(table) {
+		return 0, errLZFSECorrupt
+	}
+
+	var entry = table[*state]
+	var stateBits, pullErr = in.pull(entry.bits)
+	if pullErr != nil {
+		return 0, pullErr
+	}
+	*state = entry.delta + int(stateBits)
+
+	return entry.symbol, nil
+}
+
+func fseValueDecode(state *int, table []fseValueDecoderEntry, in *fseInStream) (int, error) {
+	if *state >= len(table) {
+		return 0, errLZFSECorrupt
+	}
+
+	var entry = table[*state]
+	var stateAndValueBits, pullErr = in.pull(entry.totalBits)
+	if pullErr != nil {
+		return 0, pullErr
+	}
+	*state = entry.delta + int(stateAndValueBits>>entry.valueBits)
+
+	return entry.base + int(stateAndValueBits&(1<<entry.valueBits-1)), nil
+}
+
+// lzvnDecode decodes an LZVN payload, matches can refer to data already in dst.
+func lzvnDecode(dst []byte, src []byte) ([]byte, error) {
+	var pos int
+	var distance int
+	for pos < len(src) {
+		var opcode = src[pos]
+		var literals, length, size int
+		switch {
+		case opcode == 0x06:
+			return dst, nil
+		case opcode == 0x0e || opcode == 0x16:
+			pos++
+			continue
+		case opcode == 0xf0:
+			if pos+2 > len(src) {
+				return nil, errLZFSECorrupt
+			}
+			length, size = int(src[pos+1])+16, 2
+		case opcode > 0xf0:
+			length, size = int(opcode&0x0f), 1
+		case opcode == 0xe0:
+			if pos+2 > len(src) {
+				return nil, errLZFSECorrupt
+			}
+			literals, size = int(src[pos+1])+16, 2
+		case opcode > 0xe0:
+			literals, size = int(opcode&0x0f), 1
+		case opcode >= 0x70 && opcode < 0x80, opcode >= 0xd0:
+			return nil, errLZFSECorrupt
+		case opcode >= 0xa0 && opcode < 0xc0:
+			if pos+3 > len(src) {
+				return nil, errLZFSECorrupt
+			}
+			var operand = binary.LittleEndian.Uint16(src[pos+1:])
+			literals = int(opcode>>3) & 3
+			length = (int(opcode&7)<<2 | int(operand&3)) + 3
+			distance = int(operand >> 2)
+			size = 3
+		case opcode&7 == 6:
+			if opcode < 0x40 {
+				return nil, errLZFSECorrupt
+			}
+			literals, length, size = int(opcode>>6), int(opcode>>3&7)+3, 1
+		case opcode&7 == 7:
+			if pos+3 > len(src) {
+				return nil, errLZFSECorrupt
+			}
+			literals, length, size = int(opcode>>6), int(opcode>>3&7)+3, 3
+			distance = int(binary.LittleEndian.Uint16(src[pos+1:]))
+		default:
+			if pos+2 > len(src) {
+				return nil, errLZFSECorrupt
+			}
+			literals, length, size = int(opcode>>6), int(opcode>>3&7)+3, 2
+			distance = int(opcode&7)<<8 | int(src[pos+1])
+		}
+		pos += size
+
+		if pos+literals > len(src) {
+			return nil, errLZFSECorrupt
+		}
+		dst = append(dst, src[pos:pos+literals]...)
+		pos += literals
+
+		var copyErr error
+		if dst, copyErr = copyMatch(dst, distance, length); copyErr != nil {
+			return nil, copyErr
+		}
+	}
+
+	return nil, errLZFSECorrupt
+}
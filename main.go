@@ -35,13 +35,27 @@ func main() {
 	filePath = fileArg()
 	if filePath != "" {
 		filename = checkFile(filePath)
+		if handleBuildVariants() || handleLocales() {
+			return
+		}
+
+		if args.Using("roundtrip") {
+			args.Args["derive-uuids"] = ""
+		}
 
 		handleFile()
 
 		initParse()
+		applyVariantName()
+		applyLocaleName()
 
 		generateShortcut()
 
+		if args.Using("roundtrip") {
+			roundTrip()
+			return
+		}
+
 		createShortcut()
 		return
 	}
@@ -97,6 +111,18 @@ func main() {
 		os.Exit(0)
 	}
 
+	if args.Using("import-dir") && args.Value("import-dir") != "" {
+		importDir(args.Value("import-dir"))
+
+		os.Exit(0)
+	}
+
+	if args.Using("coverage") && args.Value("coverage") != "" {
+		coverage(args.Value("coverage"))
+
+		os.Exit(0)
+	}
+
 	if args.Using("refs") && args.Value("refs") != "" {
 		var shortcutBytes = importShortcut(args.Value("refs"))
 		extractReferences(shortcutBytes)
@@ -112,6 +138,14 @@ func main() {
 		os.Exit(0)
 	}
 
+	if args.Using("methods") {
+		markBuiltins()
+		defineRawAction()
+		loadStandardActions()
+		handleMethodSearch()
+		os.Exit(0)
+	}
+
 	if args.Using("glyph") {
 		handleGlyphSearch()
 		os.Exit(0)
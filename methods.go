@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+var methodCallRegex = regexp.MustCompile(`^@[a-zA-Z_]\w*(?:\['[^']*'])?\.(?:[a-zA-Z_]\w*\.)?[a-zA-Z_]\w*\(`)
+var methodRegex = regexp.MustCompile(`^(?:[a-zA-Z_]\w*\.)?[a-zA-Z_]\w*\(`)
+
+// methodCallAhead checks if the current statement is a method call on a variable (e.g. @text.uppercase()).
+func methodCallAhead() bool {
+	return methodCallRegex.MatchString(lookAheadUntil('\n'))
+}
+
+// collectMethodCallStatement collects a method call on a variable used as a statement.
+func collectMethodCallStatement() {
+	reachable()
+
+	var valueType tokenType
+	var value any
+	collectValue(&valueType, &value, '\n')
+
+	var methodAction = value.(action)
+	tokens = append(tokens, token{
+		typeof:    Action,
+		ident:     methodAction.ident,
+		valueType: Action,
+		value:     methodAction,
+	})
+	actionIndex++
+}
+
+// collectMethodCall collects a call to the action named method that receives the receiver as its first argument.
+func collectMethodCall(receiver varValue, method string) action {
+	var receiverType = methodReceiverType(receiver)
+	var identifier = resolveMethod(method, receiverType)
+
+	advance()
+	setCurrentAction(identifier, actions[identifier])
+
+	var receiverArgument = actionArgument{
+		valueType: Variable,
+		value:     receiver,
+	}
+	checkArg(&currentAction.definition.parameters[0], &receiverArgument)
+
+	var arguments = continueArguments([]actionArgument{receiverArgument})
+	currentAction.arguments = arguments
+
+	checkAction()
+	var value = makeActionValue(identifier, arguments)
+
+	advance()
+
+	return value
+}
+
+// methodReceiverType returns the type of the value of the receiver of a method call, respecting type coercion.
+func methodReceiverType(receiver varValue) tokenType {
+	if coercedValueType, coerced := coercedType(receiver.coerce); coerced {
+		return coercedValueType
+	}
+
+	var identifier = receiver.value.(string)
+	var variable = realVariableValue(identifier, String)
+	var valueType = checkTypeTransform(variable.valueType)
+	if valueType == Action {
+		if a, ok := variable.value.(action); ok && a.def != nil {
+			valueType = a.def.outputType
+		}
+	}
+
+	return valueType
+}
+
+// methodAliases maps the alternative names of methods to the actions they call.
+var methodAliases = map[string]string{
+	"lower": "lowercase",
+	"upper": "uppercase",
+}
+
+// resolveMethod finds the action named method, or the action method is an alias of,
+// that accepts a value of receiverType as its first argument.
+func resolveMethod(method string, receiverType tokenType) string {
+	var identifier = method
+	if alias, found := methodAliases[method]; found {
+		identifier = alias
+	}
+	if definition, found := actions[identifier]; found {
+		if len(definition.parameters) > 0 && methodAcceptsType(&definition.parameters[0], receiverType, true) {
+			return identifier
+		}
+	}
+
+	parserError(fmt.Sprintf("No method '%s()' for value of type '%s'.\n\nAvailable methods can be listed using: cherri --methods=%s", method, receiverType, receiverType))
+
+	return ""
+}
+
+// methodCandidates returns the identifiers of the actions that accept a value of receiverType as their first argument.
+func methodCandidates(receiverType tokenType, anyType bool) (candidates []string) {
+	for identifier, definition := range actions {
+		if len(definition.parameters) == 0 {
+			continue
+		}
+		if methodAcceptsType(&definition.parameters[0], receiverType, anyType) {
+			candidates = append(candidates, identifier)
+		}
+	}
+	slices.Sort(candidates)
+
+	return
+}
+
+// methodAcceptsType checks if param accepts a value of valueType, when anyType is true a variable parameter accepts any type.
+func methodAcceptsType(param *parameterDefinition, valueType tokenType, anyType bool) bool {
+	switch {
+	case param.validType == valueType:
+		return true
+	case param.validType == Variable || valueType == Variable:
+		return anyType
+	case param.validType == String && (valueType == RawString || valueType == Date):
+		return true
+	case (param.validType == Date || param.validType == Regex) && (valueType == String || valueType == RawString):
+		return true
+	case param.validType == Integer && valueType == Float:
+		return true
+	}
+
+	return false
+}
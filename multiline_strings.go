@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Multiline Strings
+
+Triple-quoted strings ("""...""") are replaced with a single-line string literal so that inline variables
+are handled as in any other string. Triple-quoted raw strings ('''...''') are replaced with a raw string.
+
+A line break directly after the opening delimiter is removed. If the closing delimiter is on its own line,
+its indentation is removed from each line, otherwise the indentation common to each line is removed.
+Line breaks removed from the source are added after the line of the closing delimiter so that line numbers
+in errors are preserved.
+
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const multilineString = `"""`
+const multilineRawString = `'''`
+
+func handleMultilineStrings() {
+	if !strings.Contains(contents, multilineString) && !strings.Contains(contents, multilineRawString) {
+		return
+	}
+
+	parseMultilineStrings()
+}
+
+func parseMultilineStrings() {
+	var source = []rune(contents)
+	var processed strings.Builder
+	var removedLines int
+	var line int
+	for i := 0; i < len(source); i++ {
+		var r = source[i]
+		switch {
+		case r == '\n':
+			processed.WriteRune(r)
+			processed.WriteString(strings.Repeat("\n", removedLines))
+			line++
+			removedLines = 0
+		case hasRunePrefix(source[i:], multilineString), hasRunePrefix(source[i:], multilineRawString):
+			var delimiter = string(source[i : i+3])
+			var end = multilineStringEnd(source, i+3, delimiter)
+			if end == -1 {
+				lineIdx = line
+				lineCharIdx = 0
+				parserError(fmt.Sprintf("Multiline string is not terminated, expected closing %s", delimiter))
+			}
+
+			var text = dedentMultilineString(string(source[i+3 : end]))
+			var sourceBreaks = strings.Count(string(source[i:end]), "\n")
+			if delimiter == multilineString {
+				processed.WriteString(multilineStringLiteral(text))
+				removedLines += sourceBreaks
+			} else {
+				processed.WriteString(multilineRawStringLiteral(text))
+				removedLines += sourceBreaks - strings.Count(text, "\n")
+			}
+			line += sourceBreaks
+			i = end + 2
+		case r == '"' || r == '\'':
+			var end = quotedStringEnd(source, i+1, r)
+			processed.WriteString(string(source[i:end]))
+			i = end - 1
+		case r == '/' && i+1 < len(source) && (source[i+1] == '/' || source[i+1] == '*'):
+			var end = commentEnd(source, i)
+			processed.WriteString(string(source[i:end]))
+			line += strings.Count(string(source[i:end]), "\n")
+			i = end - 1
+		default:
+			processed.WriteRune(r)
+		}
+	}
+	processed.WriteString(strings.Repeat("\n", removedLines))
+
+	lines = strings.Split(processed.String(), "\n")
+	resetParse()
+}
+
+func hasRunePrefix(source []rune, prefix string) bool {
+	return strings.HasPrefix(string(source[:min(len(source), len(prefix))]), prefix)
+}
+
+// multilineStringEnd returns the index of the closing delimiter, or -1 if the string is not terminated.
+func multilineStringEnd(source []rune, start int, delimiter string) int {
+	for i := start; i < len(source); i++ {
+		if source[i] == '\\' && delimiter == multilineString {
+			i++
+			continue
+		}
+		if hasRunePrefix(source[i:], delimiter) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// quotedStringEnd returns the index after the closing quote of a single-line string.
+func quotedStringEnd(source []rune, start int, quote rune) int {
+	for i := start; i < len(source); i++ {
+		switch source[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		case '\n':
+			return i
+		}
+	}
+
+	return len(source)
+}
+
+// commentEnd returns the index after the end of the comment at start, excluding the line break of a single-line comment.
+func commentEnd(source []rune, start int) int {
+	if source[start+1] == '/' {
+		for i := start; i < len(source); i++ {
+			if source[i] == '\n' {
+				return i
+			}
+		}
+		return len(source)
+	}
+	for i := start + 2; i < len(source)-1; i++ {
+		if source[i] == '*' && source[i+1] == '/' {
+			return i + 2
+		}
+	}
+
+	return len(source)
+}
+
+// dedentMultilineString removes the line break after the opening delimiter and the indentation of each line.
+func dedentMultilineString(text string) string {
+	var textLines = strings.Split(text, "\n")
+	if len(textLines) == 1 {
+		return text
+	}
+	if strings.TrimSpace(textLines[0]) == "" {
+		textLines = textLines[1:]
+	}
+
+	var indent string
+	var lastLine = textLines[len(textLines)-1]
+	if strings.TrimSpace(lastLine) == "" {
+		indent = lastLine
+		textLines = textLines[:len(textLines)-1]
+	} else {
+		indent = commonIndent(textLines)
+	}
+
+	for i, textLine := range textLines {
+		if strings.HasPrefix(textLine, indent) {
+			textLines[i] = strings.TrimPrefix(textLine, indent)
+			continue
+		}
+
+		textLines[i] = strings.TrimLeftFunc(textLine, unicode.IsSpace)
+	}
+
+	return strings.Join(textLines, "\n")
+}
+
+func commonIndent(textLines []string) (indent string) {
+	var found bool
+	for _, textLine := range textLines {
+		if strings.TrimSpace(textLine) == "" {
+			continue
+		}
+
+		var lineIndent = textLine[:len(textLine)-len(strings.TrimLeftFunc(textLine, unicode.IsSpace))]
+		if !found || len(lineIndent) < len(indent) {
+			indent = lineIndent
+			found = true
+		}
+	}
+
+	return
+}
+
+// multilineStringLiteral makes the text of a multiline string into a string literal, escape sequences are kept.
+func multilineStringLiteral(text string) string {
+	var literal strings.Builder
+	literal.WriteRune('"')
+	var textChars = []rune(text)
+	for i := 0; i < len(textChars); i++ {
+		switch textChars[i] {
+		case '\\':
+			if i+1 == len(textChars) || textChars[i+1] == '\n' {
+				literal.WriteString(`\\`)
+				continue
+			}
+			literal.WriteRune('\\')
+			literal.WriteRune(textChars[i+1])
+			i++
+		case '"':
+			literal.WriteString(`\"`)
+		case '\n':
+			literal.WriteString(`\n`)
+		case '\r':
+			continue
+		default:
+			literal.WriteRune(textChars[i])
+		}
+	}
+	literal.WriteRune('"')
+
+	return literal.String()
+}
+
+func multilineRawStringLiteral(text string) string {
+	return fmt.Sprintf("'%s'", strings.ReplaceAll(strings.ReplaceAll(text, "\r", ""), "'", `\'`))
+}
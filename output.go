@@ -5,9 +5,11 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/electrikmilk/args-parser"
@@ -36,6 +38,14 @@ func getOutputPath(name string) string {
 		if _, err := os.Stat(relativeOutputPath); os.IsNotExist(err) {
 			exit(fmt.Sprintf("Output path '%s' does not exist!", relativeOutputPath))
 		}
+		if currentVariant != nil || currentLocale != "" {
+			var extension = filepath.Ext(outputPathArg)
+			var suffix = localeSuffix()
+			if currentVariant != nil {
+				suffix = currentVariant.suffix() + suffix
+			}
+			return strings.TrimSuffix(outputPathArg, extension) + suffix + extension
+		}
 
 		return outputPathArg
 	}
@@ -54,6 +64,7 @@ func createShortcut() {
 	if args.Using("debug") {
 		writeShortcut(relativeFile+".plist", workflowName+".plist")
 	}
+	checkSecretLeaks()
 	writeShortcut(relativeFile+unsignedEnd, workflowName+unsignedEnd)
 
 	inputPath = fmt.Sprintf("%s%s%s", relativePath, workflowName, unsignedEnd)
@@ -86,11 +97,8 @@ func writeShortcut(path string, debug string) {
 		fmt.Printf("Writing to %s...", debug)
 	}
 
-	var unsignedFile, unsignedFileErr = os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
-	handle(unsignedFileErr)
-	defer unsignedFile.Close()
-
-	var plistEncoder = plist.NewEncoder(unsignedFile)
+	var encoded bytes.Buffer
+	var plistEncoder = plist.NewEncoder(&encoded)
 	if args.Using("debug") {
 		plistEncoder.Indent("\t")
 	}
@@ -98,6 +106,14 @@ func writeShortcut(path string, debug string) {
 	var encodeErr = plistEncoder.Encode(shortcut)
 	handle(encodeErr)
 
+	var plistData = encoded.Bytes()
+	if strings.HasSuffix(path, ".plist") {
+		plistData = []byte(redactSecrets(encoded.String()))
+	}
+
+	var writeErr = os.WriteFile(path, plistData, 0644)
+	handle(writeErr)
+
 	if writeDebugOutput {
 		fmt.Println(ansi("Done.", green))
 	}
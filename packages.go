@@ -7,6 +7,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
@@ -30,6 +31,7 @@ type cherriPackage struct {
 	Uri      string
 	Archived bool
 	Packages []cherriPackage
+	Variants []buildVariant `plist:",omitempty"`
 }
 
 func (pkg *cherriPackage) installed() (installed bool) {
@@ -187,15 +189,20 @@ func printPackage(pkg *cherriPackage) {
 
 // initPackage initializes a package in the current directory using an info.plist file based on cherriPackage.
 func initPackage() {
-	if _, statErr := os.Stat("info.plist"); !os.IsNotExist(statErr) {
+	createPackage(".", args.Value("init"))
+
+	fmt.Println(ansi("Initialized Cherri package", green))
+}
+
+// createPackage creates the info.plist file of a new package with the signature pkgSig in dir.
+func createPackage(dir string, pkgSig string) {
+	var infoPath = filepath.Join(dir, "info.plist")
+	if _, statErr := os.Stat(infoPath); !os.IsNotExist(statErr) {
 		exit("info.plist already exists. Delete it to create new package.")
 	}
-	var pkgSig = args.Value("init")
 	var newPkg = newPackage(pkgSig)
 	currentPkg = &newPkg
-	writePackage()
-
-	fmt.Println(ansi("Initialized Cherri package", green))
+	writePackageFile(infoPath)
 }
 
 var trustedPackagesPlistPath = os.ExpandEnv("$HOME/.cherri/trusted.plist")
@@ -257,12 +264,16 @@ func loadPackage(path string) (pkg *cherriPackage, found bool) {
 
 // writePackage writes the current package to the info.plist file in the current directory.
 func writePackage() {
+	writePackageFile("info.plist")
+}
+
+func writePackageFile(path string) {
 	var writeDebugOutput = args.Using("debug")
 	if writeDebugOutput {
-		fmt.Printf("Writing to info.plist...")
+		fmt.Printf("Writing to %s...", path)
 	}
 
-	var info, infoErr = os.OpenFile("info.plist", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	var info, infoErr = os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	handle(infoErr)
 	defer info.Close()
 
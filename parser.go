@@ -29,6 +29,7 @@ type controlFlowGroup struct {
 	identifier string
 	groupType  tokenType
 	uuid       string
+	enumerated bool // enumerated is true if a repeat each statement has an index variable.
 }
 
 var controlFlowGroups map[int]controlFlowGroup
@@ -40,6 +41,7 @@ var isFirstCommentAction = true
 // then reset the chars and lines, then reset the parser cursor position.
 // This is usually done when something modifies the contents of the file like functions or includes.
 func resetParse() {
+	mapInsertedLines()
 	contents = strings.Join(lines, "\n")
 	chars = []rune(contents)
 	lines = strings.Split(contents, "\n")
@@ -63,14 +65,59 @@ func (lineRef *lineReference) replaceLines() {
 	}
 }
 
+// sourceLines maps each line to the line it was on once includes were resolved, and sourceText contains those lines,
+// so that errors are reported on the line that was written when lines have since been inserted.
+var sourceLines []int
+var sourceText []string
+
+// mapSourceLines starts mapping lines to the lines they are currently on.
+func mapSourceLines() {
+	sourceText = slices.Clone(lines)
+	sourceLines = make([]int, len(lines))
+	for i := range lines {
+		sourceLines[i] = i
+	}
+}
+
+// mapInsertedLines maps lines inserted into a line to the line they were inserted into.
+func mapInsertedLines() {
+	if len(sourceLines) != len(lines) {
+		sourceLines = nil
+		return
+	}
+
+	var mapped = make([]int, 0, len(lines))
+	for i, line := range lines {
+		for range strings.Count(line, "\n") + 1 {
+			mapped = append(mapped, sourceLines[i])
+		}
+	}
+	sourceLines = mapped
+}
+
+// sourceLine returns the index and text of the line that line was on once includes were resolved.
+func sourceLine(line int) (int, string) {
+	if line < len(sourceLines) {
+		return sourceLines[line], sourceText[sourceLines[line]]
+	}
+
+	return line, lines[line]
+}
+
 func initParse() {
 	if args.Using("debug") {
 		fmt.Printf("Parsing %s...\n", filename)
 	}
 	variables = make(map[string]varValue)
+	scopes = make(map[int]map[string]string)
+	outOfScope = make(map[string]bool)
+	rangeIdx = 0
 	questions = make(map[string]*question)
 	controlFlowGroups = make(map[int]controlFlowGroup)
 	definitions = make(map[string]any)
+	constants = make(map[string]*constantValue)
+	sourceLines = nil
+	applyVariantDefinitions()
 	originalContents = contents
 	chars = []rune(contents)
 	lines = strings.Split(contents, "\n")
@@ -103,6 +150,7 @@ func initParse() {
 	controlFlowGroups = map[int]controlFlowGroup{}
 	groupingIdx = 0
 	includes = []include{}
+	sourceLines = nil
 
 	if args.Using("debug") {
 		fmt.Println(ansi("Done.", green) + "\n")
@@ -129,11 +177,19 @@ func preParse() {
 	}
 
 	includeBasicStandardActions()
+	handleMultilineStrings()
+	handleConditionalCompilation()
 	handleIncludes()
+	mapSourceLines()
+	handleEnvironment()
+	handleAssertions()
 
 	handleImports()
 	handleCopyPastes()
+	handleRecords()
 	handleActionDefinitions()
+	handleLocalization()
+	handleLambdas()
 	handleFunctions()
 
 	writeProcessed()
@@ -147,7 +203,7 @@ func writeProcessed() {
 	var path = fmt.Sprintf("%s%s_processed.cherri", relativePath, workflowName)
 	fmt.Printf("Writing processed version to %s...", path)
 
-	var writeErr = os.WriteFile(path, []byte(contents), 0600)
+	var writeErr = os.WriteFile(path, []byte(redactSecrets(contents)), 0600)
 	handle(writeErr)
 
 	fmt.Println(ansi("Done.", green))
@@ -185,7 +241,7 @@ func printParsingDebug() {
 	fmt.Print("\n")
 
 	fmt.Println(ansi("## REFERENCES ##", bold))
-	fmt.Println(references)
+	fmt.Println(redactSecrets(fmt.Sprint(references)))
 	fmt.Print("\n")
 
 	fmt.Println(ansi("## VARIABLES ##", bold))
@@ -193,11 +249,11 @@ func printParsingDebug() {
 	fmt.Print("\n")
 
 	fmt.Println(ansi("## MENUS ##", bold))
-	fmt.Println(menus)
+	fmt.Println(redactSecrets(fmt.Sprint(menus)))
 	fmt.Print("\n")
 
 	fmt.Println(ansi("## IMPORT QUESTIONS ##", bold))
-	fmt.Println(questions)
+	fmt.Println(redactSecrets(fmt.Sprint(questions)))
 	fmt.Print("\n")
 }
 
@@ -215,11 +271,16 @@ func parse() {
 	case startOfLineTokenAhead(Reference):
 		advance()
 		collectEncodedReference()
+	case char == '@' && methodCallAhead():
+		collectMethodCallStatement()
 	case isChar('@'):
 		collectVariable(false)
 	case tokenAhead(Constant):
 		advance()
 		collectVariable(true)
+	case tokenAhead(Let):
+		advance()
+		collectScopedVariable()
 	case tokenAhead(Repeat):
 		collectRepeat("")
 	case tokenAhead(RepeatWithEach):
@@ -322,12 +383,14 @@ func collectVariableValue(constant bool, valueType *tokenType, value *any) {
 
 	var aheadOfValue = lookAheadUntil('\n')
 	if strings.Contains(aheadOfValue, "//") || strings.Contains(aheadOfValue, "/*") {
+		foldConstantReference(valueType, value)
 		return
 	}
 	if containsExpressionTokens(aheadOfValue) {
 		collectExpression(valueType, value)
 		return
 	}
+	foldConstantReference(valueType, value)
 	if constant && (*valueType == Arr || *valueType == Variable) {
 		parserError(fmt.Sprintf("Type %v values cannot be constants.", *valueType))
 	}
@@ -337,9 +400,14 @@ func collectExpression(valueType *tokenType, value *any) {
 	if !slices.Contains([]tokenType{Integer, Float, Variable}, *valueType) {
 		parserError(fmt.Sprintf("Value of type '%s' not allowed in expression", *valueType))
 	}
+	constantExpression = false
 	if *valueType == Variable {
-		var valueRef = *value
-		*value = fmt.Sprintf("{%s}", valueRef.(varValue).value)
+		var valueRef = (*value).(varValue)
+		if operand, folded := constantOperand(valueRef); folded {
+			*value = operand
+		} else {
+			*value = fmt.Sprintf("{%s}", valueRef.value)
+		}
 	} else {
 		*value = fmt.Sprintf("%v", *value)
 	}
@@ -348,6 +416,10 @@ func collectExpression(valueType *tokenType, value *any) {
 	for char != -1 && char != '\n' {
 		collectExpressionValue(value)
 	}
+
+	if constantExpression {
+		foldExpression(valueType, value)
+	}
 }
 
 func collectExpressionValue(value *any) {
@@ -390,6 +462,10 @@ func collectExpressionValue(value *any) {
 		varRef = true
 	}
 	collectReference(&refType, &refValue, &until, varRef)
+	if operand, folded := constantOperand(refValue.(varValue)); folded {
+		*value = fmt.Sprintf("%s%s", *value, operand)
+		return
+	}
 	*value = fmt.Sprintf("%s{%s}", *value, refValue.(varValue).value)
 }
 
@@ -399,6 +475,8 @@ func collectValue(valueType *tokenType, value *any, until rune) {
 		parserError("Value expected")
 	}
 	switch {
+	case durationLiteralAhead():
+		collectDurationLiteral(valueType, value)
 	case intChar(char):
 		*valueType = Integer
 		if strings.Contains(ahead, ".") {
@@ -407,6 +485,10 @@ func collectValue(valueType *tokenType, value *any, until rune) {
 		collectIntegerValue(valueType, value)
 	case char == '"':
 		collectStringValue(valueType, value)
+	case char == 'd' && next(1) == '"':
+		collectDateLiteral(valueType, value)
+	case regexLiteralAhead():
+		collectRegexLiteral(valueType, value)
 	case char == '\'':
 		advance()
 		*valueType = RawString
@@ -426,6 +508,8 @@ func collectValue(valueType *tokenType, value *any, until rune) {
 	case char == '@':
 		advance()
 		collectReference(valueType, value, &until, true)
+	case tokenAhead(Embed):
+		collectEmbedValue(valueType, value)
 	case tokenAhead(Color):
 		*valueType = Color
 		collectColorValue(value)
@@ -523,6 +607,7 @@ func collectStringValue(valueType *tokenType, value *any) {
 	var stringValue = fmt.Sprintf("%s", *value)
 	if strings.ContainsAny(stringValue, "{}") {
 		checkInlineVars(&stringValue)
+		*value = stringValue
 	}
 }
 
@@ -541,6 +626,7 @@ func collectActionValue(valueType *tokenType, value *any) {
 var checkInlineVarRegex = regexp.MustCompile(`\{(.*?)(?:\['(.*?)'])?(?:\.(.*?))?}`)
 
 func checkInlineVars(value *string) {
+	*value = foldInlineConstants(*value)
 	var matches = checkInlineVarRegex.FindAllStringSubmatch(*value, -1)
 	if matches == nil {
 		return
@@ -558,15 +644,26 @@ func checkInlineVars(value *string) {
 
 		if startsWith("@", identifier) {
 			identifier = strings.TrimPrefix(identifier, "@")
+			var scopedIdentifier = identifier
+			checkScopedReference(&scopedIdentifier)
+			if scopedIdentifier != identifier {
+				replaceInlineVariable(value, identifier, scopedIdentifier)
+				identifier = scopedIdentifier
+			}
 			if !validVariableReference(&identifier) {
 				parserError(fmt.Sprintf("Undefined inline variable reference '%s'", identifier))
 			}
+			useConstant(identifier)
+			if match[2] == "" && match[3] != "" {
+				replaceRecordFields(value, identifier, match[3])
+			}
 			continue
 		}
 
 		if !validReference(identifier) {
 			parserError(fmt.Sprintf("Undefined inline reference '%s'", identifier))
 		}
+		useConstant(identifier)
 	}
 }
 
@@ -614,6 +711,7 @@ func collectReference(valueType *tokenType, value *any, until *rune, variable bo
 		}
 	} else {
 		reference = strings.TrimPrefix(reference, "@")
+		checkScopedReference(&reference)
 		if !validVariableReference(&reference) {
 			parserError(fmt.Sprintf("Undefined variable reference '%s'", reference))
 		}
@@ -630,12 +728,41 @@ func collectReference(valueType *tokenType, value *any, until *rune, variable bo
 		advance()
 		getAs = key
 	}
+	var method string
 	if char == '.' {
 		advance()
-		coerce = collectUntil(*until)
+		if methodRegex.MatchString(lookAheadUntil(*until)) {
+			var identifiers = strings.Split(methodRegex.FindString(lookAheadUntil(*until)), ".")
+			method = strings.TrimSuffix(identifiers[len(identifiers)-1], "(")
+			if len(identifiers) == 2 {
+				coerce = identifiers[0]
+			}
+			advanceUntil('(')
+		} else {
+			coerce = collectUntil(*until)
+		}
+	}
+	if variable {
+		recordFieldReference(reference, &getAs, &coerce)
 	}
 
 	isInputVariable(reference)
+	useConstant(reference)
+
+	if method != "" {
+		if !variable {
+			parserError(fmt.Sprintf("Methods can only be called on variables, use @%s.%s()", reference, method))
+		}
+		*valueType = Action
+		*value = collectMethodCall(varValue{
+			variableType: "Variable",
+			valueType:    Variable,
+			value:        reference,
+			coerce:       coerce,
+			getAs:        getAs,
+		}, method)
+		return
+	}
 
 	*valueType = Variable
 	*value = varValue{
@@ -709,9 +836,14 @@ func collectEnumeration() {
 }
 
 func collectArguments() (arguments []actionArgument) {
+	return continueArguments(arguments)
+}
+
+// continueArguments collects the rest of the arguments for the current action following the arguments already collected.
+func continueArguments(arguments []actionArgument) []actionArgument {
 	var params = currentAction.definition.parameters
 	var paramsSize = len(params)
-	var argIndex = 0
+	var argIndex = len(arguments)
 	var param parameterDefinition
 	for {
 		if char == ')' || char == -1 {
@@ -723,7 +855,7 @@ func collectArguments() (arguments []actionArgument) {
 		arguments = append(arguments, collectArgument(&argIndex, &param, &paramsSize))
 		argIndex++
 	}
-	return
+	return arguments
 }
 
 func collectArgument(argIndex *int, param *parameterDefinition, paramsSize *int) (argument actionArgument) {
@@ -749,6 +881,7 @@ func collectArgument(argIndex *int, param *parameterDefinition, paramsSize *int)
 		valueType: valueType,
 		value:     value,
 	}
+	foldArgumentConstant(param, &argument)
 	if !param.infinite && (valueType != Nil && value != nil) {
 		checkArg(param, &argument)
 	}
@@ -798,11 +931,47 @@ func collectVariable(constant bool) {
 	reachable()
 
 	var identifier = collectIdentifier()
+	if !constant && !resolveScopedIdentifier(&identifier) && outOfScope[identifier] {
+		if slices.Contains([]rune{'+', '-', '*', '/'}, next(1)) {
+			checkScopedReference(&identifier)
+		}
+		delete(outOfScope, identifier)
+	}
 	availableIdentifier(&identifier)
 
+	collectVariableDeclaration(identifier, constant)
+}
+
+// collectScopedVariable collects a `let` declaration, which is only visible within the block it was declared in.
+func collectScopedVariable() {
+	reachable()
+
+	var identifier = collectIdentifier()
+	if slices.Contains([]rune{'+', '-', '*', '/'}, next(1)) {
+		parserError(fmt.Sprintf("Block-scoped variable '%s' must be declared before it can be modified.", identifier))
+	}
+
+	var declaredAs = identifier
+	declareScopedVariable(&identifier)
+
+	collectVariableDeclaration(identifier, false)
+
+	if v, found := variables[identifier]; found && identifier != declaredAs {
+		v.declaredAs = declaredAs
+		variables[identifier] = v
+	}
+}
+
+func collectVariableDeclaration(identifier string, constant bool) {
 	var valueType tokenType
 	var value any
 	var varType = Variable
+	var record = collectRecordAnnotation()
+	var declaredType tokenType
+	if record == nil {
+		declaredType = collectTypeAnnotation()
+	}
+	var recordDeclaration bool
 	switch {
 	case strings.Contains(lookAheadUntil('\n'), "="):
 		collectVariableModifier(constant, &varType)
@@ -816,6 +985,16 @@ func collectVariable(constant bool) {
 		if valueType == Variable && value.(varValue).value == "Ask" {
 			parserError("Ask global cannot be used as a variable value.")
 		}
+		if constant && varType == Variable {
+			declareConstant(identifier, &valueType, &value)
+		}
+	case record != nil:
+		if constant {
+			parserError("Constants cannot be initialized without a value")
+		}
+		valueType = Dict
+		value = make(map[string]interface{})
+		recordDeclaration = true
 	case tokenAhead(Colon):
 		if constant {
 			parserError("Constants cannot be initialized without a value")
@@ -836,13 +1015,76 @@ func collectVariable(constant bool) {
 	if varType != Variable {
 		return
 	}
-	if _, found := variables[identifier]; !found {
+	var existing, declared = variables[identifier]
+	switch {
+	case record == nil && declared:
+		record = existing.record
+	case record == nil:
+		record = recordOfValue(valueType, value)
+	}
+	if declaredType != "" {
+		checkDeclaredType(declaredType, valueType)
+		valueType = declaredType
+	}
+	if record != nil && !recordDeclaration {
+		checkRecordValue(record, valueType, value)
+	}
+	if declared && existing.record != record {
+		existing.record = record
+		variables[identifier] = existing
+	}
+	if declared && declaredType != "" {
+		existing.valueType = declaredType
+		existing.value = value
+		variables[identifier] = existing
+	}
+	if !declared {
 		variables[identifier] = varValue{
 			variableType: "Variable",
 			valueType:    valueType,
 			value:        value,
 			constant:     constant,
+			record:       record,
 		}
+	} else if lambdaResults[identifier] && varType == Variable {
+		// The result of reduce() takes on the type of the lambda's value.
+		var result = variables[identifier]
+		result.valueType = valueType
+		result.value = value
+		variables[identifier] = result
+		delete(lambdaResults, identifier)
+	}
+}
+
+// collectTypeAnnotation collects the type of a variable declared with a type and a value (e.g. @x: number = @y),
+// which the variable is checked as instead of the type of its value.
+func collectTypeAnnotation() (valueType tokenType) {
+	if char != ':' || !strings.Contains(lookAheadUntil('\n'), "=") {
+		return
+	}
+	advance()
+	skipWhitespace()
+
+	var value any
+	collectType(&valueType, &value, ' ')
+
+	return
+}
+
+// checkDeclaredType checks that a literal value matches the type a variable was declared with.
+func checkDeclaredType(declaredType tokenType, valueType tokenType) {
+	switch valueType {
+	case String, RawString, Integer, Float, Bool, Arr, Dict:
+	default:
+		return
+	}
+
+	switch {
+	case valueType == declaredType:
+	case valueType == RawString && declaredType == String:
+	case valueType == Integer && declaredType == Float:
+	default:
+		parserError(fmt.Sprintf("Value of type '%s' does not match declared type '%s'.", valueType, declaredType))
 	}
 }
 
@@ -902,10 +1144,10 @@ func collectType(valueType *tokenType, value *any, until rune) {
 		*value = ""
 	case tokenAhead(Integer):
 		*valueType = Integer
-		*value = "0"
+		*value = 0
 	case tokenAhead(Float):
 		*valueType = Float
-		*value = "0.0"
+		*value = 0.0
 	case tokenAhead(Bool):
 		*valueType = Bool
 		*value = false
@@ -920,8 +1162,10 @@ func collectType(valueType *tokenType, value *any, until rune) {
 		*valueType = Color
 	case tokenAhead(Date):
 		*valueType = Date
+	case tokenAhead(Regex):
+		*valueType = Regex
 	default:
-		parserError(fmt.Sprintf("Unknown type '%s'\n\nAvailable types: \n- text\n- rawtext\n- number\n- float\n- bool\n- array\n- dictionary\n- variable\n- color\n- date", collectUntil(until)))
+		parserError(fmt.Sprintf("Unknown type '%s'\n\nAvailable types: \n- text\n- rawtext\n- number\n- float\n- bool\n- array\n- dictionary\n- variable\n- color\n- date\n- regex", collectUntil(until)))
 	}
 }
 
@@ -971,6 +1215,8 @@ func collectDefinition() {
 	case tokenAhead(Version):
 		collectVersionDefinition()
 	}
+
+	applyVariantDefinitions()
 }
 
 func collectNameDefinition() {
@@ -1153,10 +1399,6 @@ func collectRepeat(identifier string) {
 	reachable()
 	var group = groupStatement(Repeat, &identifier)
 
-	var index string
-	if repeatIndexDepth > 1 {
-		index = fmt.Sprintf(" %d", repeatIndexDepth)
-	}
 	var repeatIndexIdentifier = collectIdentifier()
 
 	advance()
@@ -1168,47 +1410,214 @@ func collectRepeat(identifier string) {
 		parserError("Expected number of times to repeat")
 	}
 
+	if rangeAhead() {
+		collectRange(&group, repeatIndexIdentifier)
+		return
+	}
+
 	var timesType tokenType
 	var timesValue any
 	collectValue(&timesType, &timesValue, '{')
 	advanceTimes(2)
 
-	tokens = append(tokens,
-		token{
-			typeof:    Repeat,
-			ident:     group.uuid,
-			valueType: timesType,
-			value:     timesValue,
-		}, token{
-			typeof:    Variable,
-			ident:     repeatIndexIdentifier,
+	tokens = append(tokens, token{
+		typeof:    Repeat,
+		ident:     group.uuid,
+		valueType: timesType,
+		value:     timesValue,
+	})
+
+	addRepeatIndexVariable(repeatIndexIdentifier)
+}
+
+func addRepeatIndexVariable(identifier string) {
+	var index string
+	if repeatIndexDepth > 1 {
+		index = fmt.Sprintf(" %d", repeatIndexDepth)
+	}
+
+	tokens = append(tokens, token{
+		typeof:    Variable,
+		ident:     identifier,
+		valueType: Variable,
+		value: varValue{
 			valueType: Variable,
-			value: varValue{
-				valueType: Variable,
-				value:     fmt.Sprintf("Repeat Index%s", index),
-			},
+			value:     fmt.Sprintf("Repeat Index%s", index),
 		},
-	)
+	})
 
-	variables[repeatIndexIdentifier] = varValue{
+	variables[identifier] = varValue{
 		variableType: "Variable",
 		valueType:    Integer,
-		value:        repeatIndexIdentifier,
+		value:        identifier,
 		repeatItem:   true,
 	}
 
 	repeatIndexDepth++
 }
 
+var rangeRegex = regexp.MustCompile(`^(-?\d+|@[a-zA-Z_]\w*)\s*\.\.\s*(-?\d+|@[a-zA-Z_]\w*)(?:\s+step\s+(-?\d+))?$`)
+
+// rangeBound is the start or end of a range, either an integer literal or a variable reference.
+type rangeBound struct {
+	literal  bool
+	integer  int
+	variable string
+}
+
+func (bound *rangeBound) expression() string {
+	if bound.literal {
+		return strconv.Itoa(bound.integer)
+	}
+
+	return fmt.Sprintf("{%s}", bound.variable)
+}
+
+func rangeAhead() bool {
+	return rangeRegex.MatchString(strings.TrimSpace(strings.TrimSuffix(lookAheadUntil('{'), "{")))
+}
+
+var rangeIdx int
+
+// collectRange collects a range of integers to repeat over, lowered to a repeat with a count
+// and a repeat index variable that is adjusted to the current value of the range.
+func collectRange(group *controlFlowGroup, identifier string) {
+	var rangeStatement = strings.TrimSpace(collectUntil('{'))
+	advanceTimes(2)
+
+	var matches = rangeRegex.FindStringSubmatch(rangeStatement)
+	var start = collectRangeBound(matches[1])
+	var end = collectRangeBound(matches[2])
+	var step = 1
+	if matches[3] != "" {
+		var stepErr error
+		step, stepErr = strconv.Atoi(matches[3])
+		handle(stepErr)
+	}
+	if step == 0 {
+		parserError("Range step cannot be 0.")
+	}
+
+	var countType tokenType = Integer
+	var countValue any
+	if start.literal && end.literal {
+		var count = (end.integer-start.integer)/step + 1
+		if count <= 0 {
+			parserError(fmt.Sprintf("Range %s is empty, it would repeat %d times.", rangeStatement, count))
+		}
+		countValue = count
+	} else {
+		if step != 1 && step != -1 {
+			parserError("Ranges with variable bounds can only step by 1 or -1.")
+		}
+
+		var count = fmt.Sprintf("%s - %s + 1", end.expression(), start.expression())
+		if step == -1 {
+			count = fmt.Sprintf("%s - %s + 1", start.expression(), end.expression())
+		}
+
+		rangeIdx++
+		var countIdentifier = fmt.Sprintf("_range_cherri_count_%d", rangeIdx)
+		tokens = append(tokens, token{
+			typeof:    Variable,
+			ident:     countIdentifier,
+			valueType: Expression,
+			value:     count,
+		})
+		variables[countIdentifier] = varValue{
+			variableType: "Variable",
+			valueType:    Expression,
+			value:        count,
+		}
+
+		countType = Variable
+		countValue = varValue{
+			variableType: "Variable",
+			valueType:    Integer,
+			value:        countIdentifier,
+		}
+	}
+
+	tokens = append(tokens, token{
+		typeof:    Repeat,
+		ident:     group.uuid,
+		valueType: countType,
+		value:     countValue,
+	})
+
+	addRepeatIndexVariable(identifier)
+
+	if start.literal && start.integer == 1 && step == 1 {
+		return
+	}
+
+	// The repeat index starts at 1, the current value of the range is: (index - 1) * step + start
+	var current = fmt.Sprintf("{%s}", identifier)
+	switch {
+	case start.literal:
+		if step != 1 {
+			current += fmt.Sprintf(" * %d", step)
+		}
+		var offset = start.integer - step
+		if offset > 0 {
+			current += fmt.Sprintf(" + %d", offset)
+		} else if offset < 0 {
+			current += fmt.Sprintf(" - %d", -offset)
+		}
+	case step == 1:
+		current += fmt.Sprintf(" - 1 + %s", start.expression())
+	default:
+		current = fmt.Sprintf("(%s - 1) * %d + %s", current, step, start.expression())
+	}
+
+	tokens = append(tokens, token{
+		typeof:    Variable,
+		ident:     identifier,
+		valueType: Expression,
+		value:     current,
+	})
+}
+
+func collectRangeBound(bound string) (rangeValue rangeBound) {
+	if strings.HasPrefix(bound, "@") {
+		rangeValue.variable = strings.TrimPrefix(bound, "@")
+		checkScopedReference(&rangeValue.variable)
+		if !validVariableReference(&rangeValue.variable) {
+			parserError(fmt.Sprintf("Undefined variable reference '%s'", rangeValue.variable))
+		}
+		return
+	}
+
+	var integer, convErr = strconv.Atoi(bound)
+	handle(convErr)
+
+	rangeValue.literal = true
+	rangeValue.integer = integer
+
+	return
+}
+
 func collectRepeatEach(identifier string) {
 	reachable()
-	var group = groupStatement(RepeatWithEach, &identifier)
 
-	var index string
-	if repeatItemIndex > 1 {
-		index = fmt.Sprintf(" %d", repeatItemIndex)
+	var repeatIndexIdentifier string
+	var repeatItemIdentifier string
+	if isChar('(') {
+		skipWhitespace()
+		repeatIndexIdentifier = collectIdentifier()
+		skipWhitespace()
+		if !isChar(',') {
+			parserError(fmt.Sprintf("Expected `,` followed by item identifier, got: %c", char))
+		}
+		skipWhitespace()
+		repeatItemIdentifier = collectIdentifier()
+		skipWhitespace()
+		if !isChar(')') {
+			parserError(fmt.Sprintf("Expected `)`, got: %c", char))
+		}
+	} else {
+		repeatItemIdentifier = collectIdentifier()
 	}
-	var repeatItemIdentifier = collectIdentifier()
 
 	advance()
 	if !tokenAhead(In) {
@@ -1220,6 +1629,22 @@ func collectRepeatEach(identifier string) {
 		parserError("Expected value")
 	}
 
+	if rangeAhead() {
+		if repeatIndexIdentifier != "" {
+			parserError("Ranges cannot be enumerated, the item is the index.")
+		}
+		var group = groupStatement(Repeat, &identifier)
+		collectRange(&group, repeatItemIdentifier)
+		return
+	}
+
+	var group = groupStatement(RepeatWithEach, &identifier)
+
+	var index string
+	if repeatItemIndex > 1 {
+		index = fmt.Sprintf(" %d", repeatItemIndex)
+	}
+
 	var iterableType tokenType
 	var iterableValue any
 	collectValue(&iterableType, &iterableValue, '{')
@@ -1249,6 +1674,12 @@ func collectRepeatEach(identifier string) {
 		repeatItem:   true,
 	}
 
+	if repeatIndexIdentifier != "" {
+		group.enumerated = true
+		controlFlowGroups[groupingIdx] = group
+		addRepeatIndexVariable(repeatIndexIdentifier)
+	}
+
 	repeatItemIndex++
 }
 
@@ -1355,6 +1786,7 @@ func collectConditional() (conditional condition) {
 		var variableTwoType tokenType
 		var variableTwoValue any
 		collectValue(&variableTwoType, &variableTwoValue, ' ')
+		foldConstantReference(&variableTwoType, &variableTwoValue, String, RawString, Integer, Float)
 		conditional.arguments = append(conditional.arguments, actionArgument{
 			valueType: variableTwoType,
 			value:     variableTwoValue,
@@ -1367,6 +1799,7 @@ func collectConditional() (conditional condition) {
 			var variableThreeValue any
 
 			collectValue(&variableThreeType, &variableThreeValue, '{')
+			foldConstantReference(&variableThreeType, &variableThreeValue, String, RawString, Integer, Float)
 			conditional.arguments = append(conditional.arguments, actionArgument{
 				valueType: variableThreeType,
 				value:     variableThreeValue,
@@ -1385,6 +1818,8 @@ func checkConditionalTypes(conditional *tokenType, variableType tokenType, value
 		var variableValue, found = getVariableValue(variable.value.(string))
 		if found && variableValue.valueType != Variable {
 			variableType = variableValue.valueType
+		} else if reference, ok := variableValue.value.(varValue); found && ok && reference.coerce != "" {
+			variableType = tokenType(reference.coerce)
 		}
 		if variableType == Action {
 			if a, ok := variableValue.value.(action); ok && a.def != nil {
@@ -1440,6 +1875,7 @@ func collectMenuItem() {
 		parserError("Item has no starting menu statement.")
 	}
 	var group = controlFlowGroups[groupingIdx]
+	exitScope()
 
 	var itemType tokenType
 	var itemValue any
@@ -1474,6 +1910,7 @@ func collectEndStatement() {
 		if _, ok := controlFlowGroups[groupingIdx]; !ok {
 			parserError("Else has no starting if statement.")
 		}
+		exitScope()
 		tokens = append(tokens, token{
 			typeof:    Conditional,
 			ident:     controlFlowGroups[groupingIdx].uuid,
@@ -1488,11 +1925,14 @@ func collectEndStatement() {
 		parserError("Ending has no starting statement.")
 	}
 
+	exitScope()
+
 	var controlFlowGroup = controlFlowGroups[groupingIdx]
 	if controlFlowGroup.groupType == Repeat || controlFlowGroup.groupType == RepeatWithEach {
 		if controlFlowGroup.groupType == RepeatWithEach {
 			repeatItemIndex--
-		} else {
+		}
+		if controlFlowGroup.groupType == Repeat || controlFlowGroup.enumerated {
 			repeatIndexDepth--
 		}
 		reachable()
@@ -1587,6 +2027,10 @@ func collectString() string {
 				collection.WriteRune('\r')
 			case '\\':
 				collection.WriteRune('\\')
+			case '{':
+				collection.WriteString(literalOpenBrace)
+			case '}':
+				collection.WriteString(literalCloseBrace)
 			default:
 				collection.WriteRune(next(1))
 			}
@@ -1629,7 +2073,7 @@ func collectArray() (array interface{}) {
 	if err := json.Unmarshal([]byte(rawJSON), &array); err != nil {
 		if args.Using("debug") {
 			fmt.Println(ansi("\n### COLLECTED ARRAY ###", bold))
-			fmt.Println(rawJSON)
+			fmt.Println(redactSecrets(rawJSON))
 			fmt.Print("\n")
 		}
 		parserError(fmt.Sprintf("JSON array error: %s", err))
@@ -1647,7 +2091,7 @@ func collectDictionary() (dictionary interface{}) {
 	var rawJSON = "{" + collectObject() + "}"
 	if args.Using("debug") {
 		fmt.Println(ansi("\n\n### COLLECTED DICTIONARY ###", bold))
-		fmt.Println(rawJSON)
+		fmt.Println(redactSecrets(rawJSON))
 		fmt.Print("\n")
 	}
 	if err := json.Unmarshal([]byte(rawJSON), &dictionary); err != nil {
@@ -1864,6 +2308,7 @@ func firstChar() {
 	lineIdx = 0
 	lineCharIdx = -1
 	idx = -1
+	char = -1
 	advance()
 }
 
@@ -1881,32 +2326,36 @@ func skipInlineWhitespace() {
 
 func printVariables() {
 	for identifier, v := range variables {
+		var line strings.Builder
 		if v.constant {
-			fmt.Print("const ")
+			line.WriteString("const ")
 		} else {
-			fmt.Print("@")
+			line.WriteString("@")
 		}
-		fmt.Print(identifier)
+		line.WriteString(identifier)
 
 		if v.getAs != "" {
-			fmt.Printf("[%s]", v.getAs)
+			fmt.Fprintf(&line, "[%s]", v.getAs)
 		}
 		if v.coerce != "" {
-			fmt.Printf(".%s", v.coerce)
+			fmt.Fprintf(&line, ".%s", v.coerce)
 		}
 		if v.variableType != "Variable" {
-			fmt.Printf(" (%s)", v.variableType)
+			fmt.Fprintf(&line, " (%s)", v.variableType)
 		}
 		if v.value != nil {
-			fmt.Printf(" = %s", v.value)
+			fmt.Fprintf(&line, " = %s", v.value)
 		}
 		if string(v.valueType) != "" {
-			fmt.Printf(" (%s)", v.valueType)
+			fmt.Fprintf(&line, " (%s)", v.valueType)
 		}
 		if v.repeatItem {
-			fmt.Print(" (repeat item var)")
+			line.WriteString(" (repeat item var)")
 		}
-		fmt.Print("\n")
+		if v.declaredAs != "" {
+			fmt.Fprintf(&line, " (let %s)", v.declaredAs)
+		}
+		fmt.Println(redactSecrets(line.String()))
 	}
 }
 
@@ -1916,7 +2365,7 @@ func printTokens(tokens []token) {
 	for i, token := range tokens {
 		var idx = i + 1
 		var spaces = pad - len(fmt.Sprintf("%d", idx))
-		fmt.Printf("%s%d | %s\n", strings.Repeat(" ", spaces), idx, token)
+		fmt.Println(redactSecrets(fmt.Sprintf("%s%d | %s", strings.Repeat(" ", spaces), idx, token)))
 	}
 }
 
@@ -0,0 +1,395 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Record Types
+
+A record type is a named set of typed fields (e.g. type Contact { text name; text email }).
+Records only exist at compile time, a record value is a dictionary whose keys and values
+are checked against the fields of the record, and field access (e.g. @contact.name) is
+lowered to a dictionary value aggrandizement coerced to the type of the field.
+
+*/
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/electrikmilk/args-parser"
+)
+
+// recordField is a field of a record type.
+type recordField struct {
+	name      string
+	valueType tokenType
+	record    *recordType
+}
+
+// recordType contains the collected declaration of a record type.
+type recordType struct {
+	name   string
+	fields []recordField
+}
+
+// records is a map of all the record types that have been declared.
+var records map[string]*recordType
+
+var builtinTypes = []tokenType{String, RawString, Integer, Float, Bool, Arr, Dict, Variable, Color, Date}
+
+// handleRecords parses declared record types, so that they can be used as types in the rest of the Shortcut.
+func handleRecords() {
+	records = make(map[string]*recordType)
+	if !regexp.MustCompile(`(?m)^type `).MatchString(contents) {
+		return
+	}
+
+	parseRecords()
+
+	if args.Using("debug") {
+		printRecordsDebug()
+	}
+}
+
+func parseRecords() {
+	for char != -1 {
+		switch {
+		case char == '"':
+			advance()
+			collectString()
+		case commentAhead():
+			collectComment()
+		case startOfLineTokenAhead(Type):
+			collectRecordDeclaration()
+		}
+		advance()
+	}
+
+	resetParse()
+}
+
+func collectRecordDeclaration() {
+	var lineRef = newLineReference()
+
+	skipInlineWhitespace()
+	var identifier = collectIdentifier()
+	if identifier == "" {
+		parserError("Expected record type name.")
+	}
+	if slices.Contains(builtinTypes, tokenType(strings.ToLower(identifier))) {
+		parserError(fmt.Sprintf("Cannot declare record type '%s', '%s' is a built-in type.", identifier, strings.ToLower(identifier)))
+	}
+	if _, found := records[identifier]; found {
+		parserError(fmt.Sprintf("Duplicate declaration of record type '%s'.", identifier))
+	}
+
+	skipWhitespace()
+	if char != '{' {
+		parserError(fmt.Sprintf("Expected '{' after record type name '%s', got: %c", identifier, char))
+	}
+	advance()
+
+	var record = &recordType{name: identifier}
+	records[identifier] = record
+
+	for {
+		skipWhitespace()
+		for char == ';' || char == ',' {
+			advance()
+			skipWhitespace()
+		}
+		if char == '}' {
+			break
+		}
+		if char == -1 {
+			parserError(fmt.Sprintf("Expected '}' to close record type '%s'.", identifier))
+		}
+
+		record.fields = append(record.fields, collectRecordField(record))
+	}
+
+	if len(record.fields) == 0 {
+		parserError(fmt.Sprintf("Record type '%s' must have at least one field.", identifier))
+	}
+
+	lineRef.replaceLines()
+}
+
+func collectRecordField(record *recordType) (field recordField) {
+	var value any
+	if field.record = collectRecordType(&field.valueType); field.record == nil {
+		collectType(&field.valueType, &value, ' ')
+	}
+	if field.record == record {
+		parserError(fmt.Sprintf("Record type '%s' cannot contain itself.", record.name))
+	}
+
+	skipInlineWhitespace()
+	field.name = collectIdentifier()
+	if field.name == "" {
+		parserError(fmt.Sprintf("Expected field name in record type '%s'.", record.name))
+	}
+	if _, found := record.field(field.name); found {
+		parserError(fmt.Sprintf("Duplicate field '%s' in record type '%s'.", field.name, record.name))
+	}
+
+	return
+}
+
+// collectRecordType collects the name of a record type and sets valueType to dictionary,
+// returns nil if the type ahead is not a record type.
+func collectRecordType(valueType *tokenType) *recordType {
+	var record, length = recordAhead(0)
+	if record == nil {
+		return nil
+	}
+
+	advanceTimes(length)
+	*valueType = Dict
+
+	return record
+}
+
+// collectRecordAnnotation collects a record type annotation on a variable declaration (e.g. @contact: Contact).
+func collectRecordAnnotation() *recordType {
+	if char != ':' {
+		return nil
+	}
+
+	var offset = 1
+	for next(offset) == ' ' {
+		offset++
+	}
+	var record, length = recordAhead(offset)
+	if record == nil {
+		return nil
+	}
+
+	advanceTimes(offset + length)
+
+	return record
+}
+
+// recordAhead returns the record type whose name is at offset from the current char and the length of the name.
+func recordAhead(offset int) (*recordType, int) {
+	var start = idx + offset
+	var end = start
+	for end < len(chars) && (unicode.IsLetter(chars[end]) || unicode.IsDigit(chars[end]) || chars[end] == '_') {
+		end++
+	}
+	if end == start || (end < len(chars) && chars[end] == '(') {
+		return nil, 0
+	}
+
+	var record, found = records[string(chars[start:end])]
+	if !found {
+		return nil, 0
+	}
+
+	return record, end - start
+}
+
+func (record *recordType) field(name string) (*recordField, bool) {
+	for i := range record.fields {
+		if record.fields[i].name == name {
+			return &record.fields[i], true
+		}
+	}
+
+	return nil, false
+}
+
+func (record *recordType) fieldList() string {
+	var list strings.Builder
+	for _, field := range record.fields {
+		list.WriteString(fmt.Sprintf("\n- %s %s", field.typeName(), field.name))
+	}
+
+	return list.String()
+}
+
+func (field *recordField) typeName() string {
+	if field.record != nil {
+		return field.record.name
+	}
+
+	return string(field.valueType)
+}
+
+// contentItem returns the content item a field value is coerced to when it is accessed.
+func (field *recordField) contentItem() string {
+	switch field.valueType {
+	case String, RawString:
+		return "text"
+	case Integer, Float, Bool:
+		return "number"
+	case Dict:
+		return "dictionary"
+	case Date:
+		return "date"
+	}
+
+	return ""
+}
+
+// checkRecordValue checks that a value assigned to a record type is a dictionary of its fields.
+func checkRecordValue(record *recordType, valueType tokenType, value any) {
+	switch valueType {
+	case Dict:
+		if dictionary, ok := value.(map[string]interface{}); ok {
+			checkRecordDictionary(record, dictionary)
+		}
+	case Variable, Action:
+		var valueRecord = recordOfValue(valueType, value)
+		if valueRecord != nil && valueRecord != record {
+			parserError(fmt.Sprintf("Cannot use value of record type '%s' as record type '%s'.", valueRecord.name, record.name))
+		}
+	case Nil:
+	default:
+		parserError(fmt.Sprintf("Invalid value of type '%s' for record type '%s'.", valueType, record.name))
+	}
+}
+
+// checkRecordDictionary checks that the keys of dictionary are the fields of record and that their values have the type of the field.
+func checkRecordDictionary(record *recordType, dictionary map[string]interface{}) {
+	for _, key := range slices.Sorted(maps.Keys(dictionary)) {
+		if _, found := record.field(key); !found {
+			parserError(fmt.Sprintf("Record type '%s' has no field '%s'.\n\nFields:%s", record.name, key, record.fieldList()))
+		}
+	}
+
+	for _, field := range record.fields {
+		var value, found = dictionary[field.name]
+		if !found {
+			parserError(fmt.Sprintf("Missing field '%s' for record type '%s'.\n\nFields:%s", field.name, record.name, record.fieldList()))
+		}
+
+		var valueType = dictionaryValueType(value)
+		if field.record != nil {
+			if nested, ok := value.(map[string]interface{}); ok {
+				checkRecordDictionary(field.record, nested)
+				continue
+			}
+		}
+		if !fieldAcceptsType(&field, valueType, value) {
+			parserError(fmt.Sprintf("Invalid value %v (%s) for field '%s' (%s) of record type '%s'.", value, valueType, field.name, field.typeName(), record.name))
+		}
+	}
+}
+
+func dictionaryValueType(value any) tokenType {
+	switch value.(type) {
+	case string:
+		return String
+	case float64:
+		return Integer
+	case bool:
+		return Bool
+	case []interface{}:
+		return Arr
+	case map[string]interface{}:
+		return Dict
+	case nil:
+		return Nil
+	}
+
+	return Variable
+}
+
+func fieldAcceptsType(field *recordField, valueType tokenType, value any) bool {
+	switch {
+	case field.valueType == Variable || valueType == Nil:
+		return true
+	case valueType == String && strings.Contains(value.(string), "{"):
+		// Text containing inline variables may evaluate to any type.
+		return true
+	case field.valueType == valueType:
+		return true
+	case field.valueType == Float && valueType == Integer:
+		return true
+	case valueType == String && (field.valueType == RawString || field.valueType == Date):
+		return true
+	}
+
+	return false
+}
+
+// recordOfValue returns the record type of a variable reference, or of the dictionary of a variable reference.
+func recordOfValue(valueType tokenType, value any) *recordType {
+	switch valueType {
+	case Variable:
+		if reference, ok := value.(varValue); ok && reference.getAs == "" && reference.coerce == "" {
+			if identifier, ok := reference.value.(string); ok {
+				return variables[identifier].record
+			}
+		}
+	case Action:
+		if getDictionary, ok := value.(action); ok && getDictionary.ident == "getDictionary" && len(getDictionary.args) == 1 {
+			return recordOfValue(getDictionary.args[0].valueType, getDictionary.args[0].value)
+		}
+	}
+
+	return nil
+}
+
+// checkRecordArgument checks that an argument for a parameter typed as a record is a value of that record type.
+func checkRecordArgument(param *parameterDefinition, argument *actionArgument) {
+	var valueType = argument.valueType
+	if valueType == Variable {
+		if coercedValueType, coerced := coercedType(argument.value.(varValue).coerce); coerced && coercedValueType != Dict {
+			return
+		}
+	}
+
+	checkRecordValue(param.record, valueType, argument.value)
+}
+
+// recordFieldReference lowers access to a field of a variable with a record type (e.g. @contact.name)
+// to getting the value for the key of the field coerced to the type of the field.
+func recordFieldReference(identifier string, getAs *string, coerce *string) {
+	var record = variables[identifier].record
+	if record == nil || *getAs != "" || *coerce == "" {
+		return
+	}
+
+	var field, found = record.field(*coerce)
+	if !found {
+		if _, contentItem := contentItems[*coerce]; contentItem {
+			return
+		}
+		parserError(fmt.Sprintf("Record type '%s' has no field '%s'.\n\nFields:%s", record.name, *coerce, record.fieldList()))
+	}
+
+	*getAs = field.name
+	*coerce = field.contentItem()
+}
+
+// replaceRecordFields lowers field access of a variable with a record type within an inline variable reference.
+func replaceRecordFields(value *string, identifier string, field string) {
+	var getAs, coerce = "", field
+	recordFieldReference(identifier, &getAs, &coerce)
+	if getAs == "" {
+		return
+	}
+
+	var lowered = fmt.Sprintf("{@%s['%s']", identifier, getAs)
+	if coerce != "" {
+		lowered += "." + coerce
+	}
+	*value = strings.ReplaceAll(*value, fmt.Sprintf("{@%s.%s}", identifier, field), lowered+"}")
+}
+
+func printRecordsDebug() {
+	fmt.Println(ansi("### RECORDS ###", bold))
+	for name, record := range records {
+		fmt.Printf("type %s {%s\n}\n", name, record.fieldList())
+	}
+	fmt.Print("\n")
+}
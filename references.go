@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"reflect"
+	"slices"
+	"strconv"
 
 	"github.com/electrikmilk/args-parser"
 	"howett.net/plist"
@@ -47,27 +51,8 @@ func extractReferences(b []byte) {
 // extractParameterReferences extracts references from a workflow action parameter.
 func extractParameterReferences(index int, identifier string, params map[string]interface{}) {
 	for _, value := range params {
-		var ref = extractedReference{
-			action: identifier,
-			index:  index + 1,
-		}
-		if value == nil || reflect.TypeOf(value).Kind() != reflect.Map {
-			continue
-		}
-		var valueMap = value.(map[string]interface{})
-		if valueMap["fileLocation"] != nil {
-			ref.value = extractFileReference(&ref, valueMap)
-		}
-		if valueMap["persistentIdentifier"] != nil {
-			ref.value = extractMediaReference(&ref, valueMap)
-		}
-		if valueMap["CustomOutputName"] != nil {
-			ref.identifier = valueMap["CustomOutputName"].(string)
-		}
-
-		sanitizeIdentifier(&ref.identifier)
-
-		if skipDuplicateReference(ref) || ref.value == nil {
+		var ref, found = parameterReference(index, identifier, value)
+		if !found || skipDuplicateReference(ref) {
 			continue
 		}
 
@@ -76,6 +61,31 @@ func extractParameterReferences(index int, identifier string, params map[string]
 	return
 }
 
+// parameterReference extracts a reference from the value of a workflow action parameter if it is a file or media item.
+func parameterReference(index int, identifier string, value any) (ref extractedReference, found bool) {
+	ref = extractedReference{
+		action: identifier,
+		index:  index + 1,
+	}
+	if value == nil || reflect.TypeOf(value).Kind() != reflect.Map {
+		return
+	}
+	var valueMap = value.(map[string]interface{})
+	if valueMap["fileLocation"] != nil {
+		ref.value = extractFileReference(&ref, valueMap)
+	}
+	if valueMap["persistentIdentifier"] != nil {
+		ref.value = extractMediaReference(&ref, valueMap)
+	}
+	if valueMap["CustomOutputName"] != nil {
+		ref.identifier = valueMap["CustomOutputName"].(string)
+	}
+
+	sanitizeIdentifier(&ref.identifier)
+
+	return ref, ref.value != nil
+}
+
 func skipDuplicateReference(ref extractedReference) bool {
 	for _, existingRef := range extractedReferences {
 		if existingRef.identifier == ref.identifier {
@@ -134,12 +144,40 @@ func decodeReferenceHash(hash string) (ref map[string]any, err error) {
 		return nil, fmt.Errorf("could not decode hashed JSON: %s", decodeErr)
 	}
 
-	var unmarshalErr = json.Unmarshal(decodedBytes, &ref)
+	var decoder = json.NewDecoder(bytes.NewReader(decodedBytes))
+	decoder.UseNumber()
+	var unmarshalErr = decoder.Decode(&ref)
 	if unmarshalErr != nil {
 		return nil, fmt.Errorf("could not unmarshal decoded JSON: %s", unmarshalErr)
 	}
 
-	return ref, nil
+	return referenceNumbers(ref).(map[string]any), nil
+}
+
+// referenceNumbers converts the numbers in a decoded reference to integers where possible,
+// so that large identifiers like the persistent identifiers of media items are not rounded.
+func referenceNumbers(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, item := range value {
+			value[key] = referenceNumbers(item)
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = referenceNumbers(item)
+		}
+	case json.Number:
+		if integer, intErr := value.Int64(); intErr == nil {
+			return integer
+		}
+		if integer, uintErr := strconv.ParseUint(value.String(), 10, 64); uintErr == nil {
+			return integer
+		}
+		var float, _ = value.Float64()
+		return float
+	}
+
+	return value
 }
 
 // makeRefCode returns the reference in Cherri reference syntax.
@@ -160,3 +198,95 @@ func printReference(ref *extractedReference) {
 		fmt.Println(ansi("---\n", dim))
 	}
 }
+
+// decompReferences maps the index of an action and a parameter key to the identifier of a reference.
+var decompReferences map[int]map[string]string
+
+// decompReferenceCode is the reference syntax for the references used by the decompiled actions.
+var decompReferenceCode []string
+
+// mapReferences creates references for the file and media item parameters of actions that accept references.
+// The reference encodes the entire parameter value, so the action is compiled with the same value.
+func mapReferences() {
+	decompReferences = make(map[int]map[string]string)
+	decompReferenceCode = []string{}
+
+	var hashes = make(map[string]string)
+	var identifiers = make(map[string]bool)
+	for i, action := range shortcut.WFWorkflowActions {
+		for _, key := range slices.Sorted(maps.Keys(action.WFWorkflowActionParameters)) {
+			var value = action.WFWorkflowActionParameters[key]
+			var ref, found = parameterReference(i, action.WFWorkflowActionIdentifier, value)
+			if !found || !acceptsReference(&action, key) {
+				continue
+			}
+
+			ref.value = value
+			var hash = makeReferenceHash(&ref)
+			if _, found := hashes[hash]; !found {
+				hashes[hash] = referenceIdentifier(ref.identifier, identifiers)
+				ref.identifier = hashes[hash]
+				decompReferenceCode = append(decompReferenceCode, makeRefCode(&ref))
+			}
+
+			if decompReferences[i] == nil {
+				decompReferences[i] = make(map[string]string)
+			}
+			decompReferences[i][key] = hashes[hash]
+		}
+	}
+}
+
+// acceptsReference returns true if the parameter of action with key accepts a reference.
+func acceptsReference(action *ShortcutAction, key string) bool {
+	var identifier, definition = matchAction(action)
+	if identifier == "" {
+		checkMissingStandardInclude(&action.WFWorkflowActionIdentifier, false)
+		identifier, definition = matchAction(action)
+	}
+
+	var param, found = definitionParameter(&definition, key)
+	if !found && includeSplitActions(action.WFWorkflowActionIdentifier) {
+		_, definition = matchAction(action)
+		param, found = definitionParameter(&definition, key)
+	}
+
+	return found && param.ref
+}
+
+func definitionParameter(definition *actionDefinition, key string) (parameterDefinition, bool) {
+	for _, param := range definition.parameters {
+		if param.key == key {
+			return param, true
+		}
+	}
+
+	return parameterDefinition{}, false
+}
+
+// referenceIdentifier makes a unique identifier for a reference.
+func referenceIdentifier(identifier string, identifiers map[string]bool) string {
+	if identifier == "" {
+		identifier = "reference"
+	}
+
+	var unique = identifier
+	for i := 2; identifiers[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", identifier, i)
+	}
+	identifiers[unique] = true
+
+	return unique
+}
+
+// decompileReferences writes the references used by the decompiled actions.
+func decompileReferences() {
+	if len(decompReferenceCode) == 0 {
+		return
+	}
+
+	for _, refCode := range decompReferenceCode {
+		newCodeLine(refCode)
+	}
+	newCodeLine("\n")
+}
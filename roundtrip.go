@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Round Trips
+
+Using --roundtrip, the compiled Shortcut is decompiled and the Cherri code is compiled again, then the two
+Shortcuts are compared and the first action and parameter path that differs is reported.
+
+UUIDs are derived using --derive-uuids and compared by the position of the action they belong to, output
+names are ignored, as the decompiler renames variables and outputs, and the order of the content item classes
+and types of the Shortcut is ignored. The name and identifier of the Shortcut in references to itself are
+ignored, as the decompiled code is compiled from a file with a different name. Comment actions are decompiled
+as comment actions, so they are kept when the decompiled code is compiled.
+
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"howett.net/plist"
+)
+
+// roundTrip decompiles the compiled Shortcut, compiles it again and exits if the Shortcuts are not the same.
+func roundTrip() {
+	var tempDir, tempErr = os.MkdirTemp("", "cherri-roundtrip")
+	handle(tempErr)
+	defer os.RemoveAll(tempDir)
+
+	var compiled, marshalErr = plist.Marshal(shortcut, plist.BinaryFormat)
+	handle(marshalErr)
+
+	var originalPath = filepath.Join(tempDir, "original.shortcut")
+	var writeErr = os.WriteFile(originalPath, compiled, 0600)
+	handle(writeErr)
+
+	var original, originalErr = readShortcut(originalPath)
+	handle(originalErr)
+
+	var recompiled, recompileErr = recompileRoundTrip(tempDir)
+	if recompileErr != nil {
+		os.RemoveAll(tempDir)
+		exit(fmt.Sprintf("roundtrip: %s", recompileErr))
+	}
+
+	if difference := shortcutDifference(original, recompiled); difference != "" {
+		os.RemoveAll(tempDir)
+		exit(fmt.Sprintf("roundtrip: %s", difference))
+	}
+
+	fmt.Println(ansi(fmt.Sprintf("Round trip of %d actions is equivalent.", len(original.WFWorkflowActions)), green))
+}
+
+// recompileRoundTrip decompiles the original Shortcut in tempDir and returns the Shortcut compiled from the Cherri code.
+func recompileRoundTrip(tempDir string) (recompiled Shortcut, err error) {
+	var decompiledPath = filepath.Join(tempDir, "decompiled.cherri")
+	var importOutput, importErr = runCompilerOutput(tempDir, "--import=original.shortcut", "--output="+decompiledPath, "--comments", "--no-ansi")
+	if importErr != nil {
+		return recompiled, fmt.Errorf("decompile failed: %s", lastOutputLine(importOutput))
+	}
+
+	var compileOutput, compileErr = runCompilerOutput(tempDir, "decompiled.cherri", "--skip-sign", "--derive-uuids", "--no-ansi")
+	if compileErr != nil {
+		return recompiled, fmt.Errorf("decompiled code failed to compile: %s", lastOutputLine(compileOutput))
+	}
+
+	var compiledPaths, _ = filepath.Glob(filepath.Join(tempDir, "*"+unsignedEnd))
+	if len(compiledPaths) == 0 {
+		return recompiled, errors.New("decompiled code did not compile a Shortcut")
+	}
+
+	return readShortcut(compiledPaths[0])
+}
+
+// shortcutDifference returns a description of the first difference between the Shortcuts a and b, or an empty string if they are the same.
+func shortcutDifference(a Shortcut, b Shortcut) string {
+	if difference := actionsDifference(a.WFWorkflowActions, b.WFWorkflowActions); difference != "" {
+		return difference
+	}
+
+	a.WFWorkflowActions = nil
+	b.WFWorkflowActions = nil
+	for _, contents := range []*Shortcut{&a, &b} {
+		slices.Sort(contents.WFWorkflowInputContentItemClasses)
+		slices.Sort(contents.WFWorkflowOutputContentItemClasses)
+		slices.Sort(contents.WFWorkflowTypes)
+		slices.Sort(contents.WFQuickActionSurfaces)
+	}
+	var path, expected, got, differs = valueDifference("", shortcutValue(a), shortcutValue(b))
+	if differs {
+		return fmt.Sprintf("%s is %s, got %s", path, expected, got)
+	}
+
+	return ""
+}
+
+// actionsDifference returns a description of the first difference between the actions a and b apart from their UUIDs and output names,
+// or an empty string if they are the same.
+func actionsDifference(a []ShortcutAction, b []ShortcutAction) string {
+	var actionsA = canonicalActions(a, 0, len(a))
+	var actionsB = canonicalActions(b, 0, len(b))
+	for i := range min(len(actionsA), len(actionsB)) {
+		ignoreSelfReference(&actionsA[i])
+		ignoreSelfReference(&actionsB[i])
+
+		var identifier = actionsA[i].WFWorkflowActionIdentifier
+		if identifier != actionsB[i].WFWorkflowActionIdentifier {
+			return fmt.Sprintf("action %d is %s, got %s", i, identifier, actionsB[i].WFWorkflowActionIdentifier)
+		}
+
+		var path, expected, got, differs = valueDifference("", actionsA[i].WFWorkflowActionParameters, actionsB[i].WFWorkflowActionParameters)
+		if differs {
+			return fmt.Sprintf("action %d (%s) parameter %s is %s, got %s", i, identifier, path, expected, got)
+		}
+	}
+	switch {
+	case len(actionsA) > len(actionsB):
+		return fmt.Sprintf("action %d (%s) is missing, got %d actions instead of %d", len(actionsB), actionsA[len(actionsB)].WFWorkflowActionIdentifier, len(actionsB), len(actionsA))
+	case len(actionsB) > len(actionsA):
+		return fmt.Sprintf("unexpected action %d (%s), got %d actions instead of %d", len(actionsA), actionsB[len(actionsA)].WFWorkflowActionIdentifier, len(actionsB), len(actionsA))
+	}
+
+	return ""
+}
+
+// ignoreSelfReference removes the identifier and name of the Shortcut from a reference to itself,
+// as the decompiled code is compiled from a file with a different name.
+func ignoreSelfReference(action *ShortcutAction) {
+	var workflow, isWorkflow = action.WFWorkflowActionParameters["WFWorkflow"].(map[string]any)
+	if !isWorkflow || workflow["isSelf"] != true {
+		return
+	}
+
+	delete(workflow, "workflowIdentifier")
+	delete(workflow, "workflowName")
+}
+
+// shortcutValue returns the Shortcut as it is stored in a property list.
+func shortcutValue(contents Shortcut) (value map[string]any) {
+	var encoded, marshalErr = plist.Marshal(contents, plist.BinaryFormat)
+	handle(marshalErr)
+
+	var _, unmarshalErr = plist.Unmarshal(encoded, &value)
+	handle(unmarshalErr)
+
+	return
+}
+
+// valueDifference returns the path and values of the first difference between the property list values a and b.
+func valueDifference(path string, a any, b any) (diffPath string, expected string, got string, differs bool) {
+	switch a := a.(type) {
+	case map[string]any:
+		var mapB, isMap = b.(map[string]any)
+		if !isMap {
+			break
+		}
+
+		var keys []string
+		for key := range a {
+			keys = append(keys, key)
+		}
+		for key := range mapB {
+			if _, found := a[key]; !found {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			var keyPath = strings.TrimPrefix(path+"."+key, ".")
+			var valueA, foundA = a[key]
+			var valueB, foundB = mapB[key]
+			switch {
+			case !foundA:
+				return keyPath, "missing", formatValue(valueB), true
+			case !foundB:
+				return keyPath, formatValue(valueA), "missing", true
+			}
+			if diffPath, expected, got, differs = valueDifference(keyPath, valueA, valueB); differs {
+				return
+			}
+		}
+		return
+	case []any:
+		var sliceB, isSlice = b.([]any)
+		if !isSlice {
+			break
+		}
+
+		for i := range min(len(a), len(sliceB)) {
+			if diffPath, expected, got, differs = valueDifference(fmt.Sprintf("%s[%d]", path, i), a[i], sliceB[i]); differs {
+				return
+			}
+		}
+		if len(a) != len(sliceB) {
+			return path, fmt.Sprintf("%d items", len(a)), fmt.Sprintf("%d items", len(sliceB)), true
+		}
+		return
+	}
+
+	var numberA, isNumberA = numberValue(a)
+	var numberB, isNumberB = numberValue(b)
+	if isNumberA && isNumberB {
+		if numberA != numberB {
+			return path, formatValue(a), formatValue(b), true
+		}
+		return
+	}
+
+	if formatValue(a) != formatValue(b) {
+		return path, formatValue(a), formatValue(b), true
+	}
+
+	return
+}
+
+// numberValue returns value as a float if it is a number, as numbers can be decoded into different types.
+func numberValue(value any) (float64, bool) {
+	switch value := value.(type) {
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case uint64:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+
+	return 0, false
+}
+
+func formatValue(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "a dictionary"
+	case []any:
+		return "an array"
+	case string:
+		return fmt.Sprintf("%q", value)
+	}
+
+	return fmt.Sprintf("%v", value)
+}
@@ -74,6 +74,31 @@ func actionsSearch() {
 	}
 }
 
+func handleMethodSearch() {
+	var valueType = tokenType(args.Value("methods"))
+	if valueType == "" {
+		fmt.Println(ansi("Provide a type to list methods for (e.g. --methods=text).", yellow))
+		os.Exit(1)
+	}
+
+	var methods = methodCandidates(valueType, true)
+	if len(methods) == 0 {
+		fmt.Println(ansi(fmt.Sprintf("No methods for values of type '%s'.", valueType), red))
+		os.Exit(1)
+	}
+
+	fmt.Println(ansi(fmt.Sprintf("Methods for values of type '%s':\n", valueType), bold))
+	for _, identifier := range methods {
+		setCurrentAction(identifier, actions[identifier])
+		var arguments = generateActionArguments(parameterDefinition{})
+		fmt.Printf("@value.%s(%s)", ansi(identifier, blue, bold), strings.Join(arguments[1:], ", "))
+		if currentAction.definition.outputType != "" {
+			fmt.Printf(": %s", ansi(string(currentAction.definition.outputType), magenta))
+		}
+		fmt.Print("\n")
+	}
+}
+
 func handleGlyphSearch() {
 	if args.Value("glyph") == "" {
 		fmt.Println(ansi("You can generate Shortcut icon code using: https://glyphs.cherrilang.org.\n", cyan))
@@ -44,8 +44,8 @@ type Value struct {
 	Value                       any                          `plist:",omitempty"`
 	Variable                    any                          `plist:",omitempty"`
 	WFDictionaryFieldValueItems []WFDictionaryFieldValueItem `plist:",omitempty"`
-	AttachmentsByRange          map[string]Value             `plist:",omitempty"`
-	String                      string                       `plist:",omitempty"`
+	AttachmentsByRange          map[string]Value             `plist:"attachmentsByRange,omitempty"`
+	String                      string                       `plist:"string,omitempty"`
 	Aggrandizements             []Aggrandizement             `plist:",omitempty"`
 	Prompt                      string                       `plist:",omitempty"`
 }
@@ -149,7 +149,7 @@ type WFConditionValue struct {
 }
 
 type WFConditionParam struct {
-	WFCondition               int             `plist:",omitempty"`
+	WFCondition               int
 	WFInput                   WFInputVariable `plist:",omitempty"`
 	WFConditionalActionString any             `plist:",omitempty"`
 	WFNumberValue             any             `plist:",omitempty"`
@@ -267,7 +267,7 @@ var revContentItems map[string]string
 
 func reversedContentItems() map[string]string {
 	if len(revContentItems) == 0 {
-		var revContentItems = make(map[string]string)
+		revContentItems = make(map[string]string)
 		for key, item := range contentItems {
 			revContentItems[item] = key
 		}
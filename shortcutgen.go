@@ -6,8 +6,10 @@ package main
 
 import (
 	"fmt"
+	"maps"
 	"reflect"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/electrikmilk/args-parser"
@@ -89,6 +91,9 @@ func generateActions() {
 			if actions[tokenAction.ident] == nil {
 				exit(fmt.Sprintf("Undefined action '%s'", tokenAction.ident))
 			}
+			if tokenAction.ident == "comment" && args.Using("release") {
+				continue
+			}
 			setCurrentAction(tokenAction.ident, actions[tokenAction.ident])
 			if tokenAction.ident == "rawAction" && len(tokenAction.args) > 0 {
 				currentAction.definition.overrideIdentifier = getArgValue(tokenAction.args[0]).(string)
@@ -109,7 +114,7 @@ func generateActions() {
 }
 
 func makeCommentAction(comment string) {
-	if args.Using("comments") {
+	if args.Using("comments") && !args.Using("release") {
 		addStdAction("comment", map[string]any{
 			"WFCommentActionText": comment,
 		})
@@ -117,9 +122,16 @@ func makeCommentAction(comment string) {
 }
 
 func makeVariableAction(t *token) {
+	if t.typeof == Variable && foldedConstant(t.ident) {
+		return
+	}
+
 	var setVariableParams = map[string]any{
 		"WFVariableName": t.ident,
 	}
+	if declaredAs := variables[t.ident].declaredAs; declaredAs != "" {
+		setVariableParams[scopedVariableParameter] = declaredAs
+	}
 
 	makeVariableInput(t, setVariableParams)
 
@@ -144,7 +156,7 @@ func makeVariableAction(t *token) {
 	}
 	addStdAction("setvariable", setVariableParams)
 
-	if t.valueType == Arr {
+	if t.valueType == Arr && !isEmbeddedArray(t.value) {
 		makeArrayVariable(t)
 	}
 }
@@ -160,7 +172,7 @@ func makeVariableInput(t *token, params map[string]any) {
 	}
 
 	makeVariableValueAction(t, &outputName, &varUUID)
-	if t.valueType != Arr && t.value != nil {
+	if (t.valueType != Arr || isEmbeddedArray(t.value)) && (t.value != nil || t.valueType == Dict) {
 		if t.typeof == Variable && t.valueType == Variable {
 			params["WFInput"] = variableValue(t.value.(varValue))
 		} else {
@@ -177,9 +189,7 @@ func makeVariableValueAction(token *token, customOutputName *string, varUUID *st
 		UUID:             *varUUID,
 	}
 
-	if (token.typeof == AddTo || token.typeof == SubFrom || token.typeof == MultiplyBy || token.typeof == DivideBy) &&
-		token.valueType != Arr &&
-		variables[token.ident].valueType != Arr {
+	if isValueModifier(token) {
 		variableValueModifier(token, &reference)
 		return
 	}
@@ -195,8 +205,10 @@ func makeVariableValue(reference *WFActionReference, valueType tokenType, value
 		makeBoolValue(reference, value)
 	case String:
 		makeStringValue(reference, value)
-	case RawString:
+	case RawString, Regex:
 		makeRawStringValue(reference, value)
+	case Date:
+		makeDateValue(reference, value)
 	case Expression:
 		makeExpressionValue(reference, value)
 	case Action:
@@ -208,6 +220,10 @@ func makeVariableValue(reference *WFActionReference, valueType tokenType, value
 		addStdAction("dictionary", attachReferenceToParams(map[string]any{
 			"WFItems": makeDictionaryValue(value),
 		}, reference))
+	case Arr:
+		if items, embedded := (*value).(embeddedArray); embedded {
+			makeEmbeddedList(reference, items)
+		}
 	}
 }
 
@@ -229,6 +245,13 @@ func makeRawStringValue(reference *WFActionReference, value *any) {
 	}, reference))
 }
 
+func makeDateValue(reference *WFActionReference, value *any) {
+	addStdAction("date", attachReferenceToParams(map[string]any{
+		"WFDateActionMode": "Specified Date",
+		"WFDateActionDate": fmt.Sprintf("%s", *value),
+	}, reference))
+}
+
 func makeBoolValue(reference *WFActionReference, value *any) {
 	var boolValue = "0"
 	if *value == true {
@@ -288,14 +311,25 @@ func makeDictionaryValue(value *any) WFDictionaryFieldValue {
 	}
 }
 
+// isValueModifier returns true if token modifies the value of a variable that is not an array, which is appended to instead.
+func isValueModifier(token *token) bool {
+	return (token.typeof == AddTo || token.typeof == SubFrom || token.typeof == MultiplyBy || token.typeof == DivideBy) &&
+		token.valueType != Arr &&
+		variables[token.ident].valueType != Arr
+}
+
 func variableValueModifier(token *token, reference *WFActionReference) {
 	var valueType = token.valueType
 	if valueType == Variable {
 		var variable = token.value.(varValue)
 		valueType = variable.valueType
+		// A reference is added according to the type of the variable it modifies.
+		if modified, found := variables[token.ident]; found && (valueType == "" || valueType == Variable) {
+			valueType = modified.valueType
+		}
 	}
 	switch valueType {
-	case Integer:
+	case Integer, Float:
 		var operation string
 		switch token.typeof {
 		case AddTo:
@@ -319,8 +353,13 @@ func variableValueModifier(token *token, reference *WFActionReference) {
 			"WFMathOperation": operation,
 		}, reference))
 	case String, RawString:
-		var varInput = token.value.(string)
-		wrapVariableReference(&varInput)
+		var varInput string
+		if reference, isReference := token.value.(varValue); isReference {
+			varInput = fmt.Sprintf("{%s}", makeVariableReferenceString(reference))
+		} else {
+			varInput = token.value.(string)
+			wrapVariableReference(&varInput)
+		}
 
 		addStdAction("gettext", attachReferenceToParams(map[string]any{
 			"WFTextActionText": paramValue(actionArgument{
@@ -343,11 +382,6 @@ func attachReferenceToParams(params map[string]any, reference *WFActionReference
 
 func inputValue(name string, varUUID string) WFTextTokenAttachment {
 	var value = Value{}
-
-	if varUUID != "" {
-		value.OutputUUID = varUUID
-	}
-
 	if variable, found := variables[name]; found {
 		if !variable.repeatItem && (variable.constant && variable.valueType != Variable) {
 			value.OutputName = name
@@ -364,6 +398,11 @@ func inputValue(name string, varUUID string) WFTextTokenAttachment {
 		value.Type = "ActionOutput"
 	}
 
+	// Only the output of an action is referenced by its UUID.
+	if value.Type == "ActionOutput" {
+		value.OutputUUID = varUUID
+	}
+
 	return WFTextTokenAttachment{
 		Value:               value,
 		WFSerializationType: "WFTextTokenAttachment",
@@ -406,7 +445,10 @@ func variableValueWithSerialization(variable varValue, serializationType string)
 		if variable.valueType == Variable && variableReference.valueType != "" {
 			refValueType = variableReference.valueType
 		}
-		if refValueType == Dict {
+		if a, ok := variableReference.value.(action); ok && refValueType == Action && a.def != nil {
+			refValueType = a.def.outputType
+		}
+		if refValueType == Dict || variableReference.record != nil {
 			aggrandizements = append(aggrandizements, Aggrandizement{
 				Type:          "WFDictionaryValueVariableAggrandizement",
 				DictionaryKey: variable.getAs,
@@ -476,8 +518,9 @@ var inlineVariables []inlineVariable
 var varIndex []attachmentVariable
 
 func attachmentValues(str string) any {
+	str = foldInlineConstants(str)
 	if !strings.ContainsAny(str, "{}") {
-		return str
+		return unescapeBraces(str)
 	}
 
 	varPositions = make(map[string]Value)
@@ -490,7 +533,7 @@ func attachmentValues(str string) any {
 	return WFTextTokenString{
 		Value: WFTextTokenStringValue{
 			AttachmentsByRange: varPositions,
-			String:             noVarString,
+			String:             unescapeBraces(noVarString),
 		},
 		WFSerializationType: "WFTextTokenString",
 	}
@@ -551,6 +594,10 @@ func makeAggrandizement(valueType *tokenType, variable *varValue, getAs string)
 	case Dict:
 		aggrandizement.Type = "WFDictionaryValueVariableAggrandizement"
 	case Action:
+		if variable.record != nil {
+			aggrandizement.Type = "WFDictionaryValueVariableAggrandizement"
+			break
+		}
 		var variableAction = *variable.value.(action).def
 		if variableAction.outputType == Dict {
 			aggrandizement.Type = "WFDictionaryValueVariableAggrandizement"
@@ -653,7 +700,7 @@ func paramValue(arg actionArgument, handleAs tokenType) any {
 	}
 	switch arg.valueType {
 	case Variable:
-		if handleAs == String {
+		if handleAs == String || handleAs == Date || handleAs == Regex {
 			var refStr = makeVariableReferenceString(arg.value.(varValue))
 			return attachmentValues(fmt.Sprintf("{%s}", refStr))
 		}
@@ -678,7 +725,7 @@ func paramValue(arg actionArgument, handleAs tokenType) any {
 		}
 	case Quantity:
 		return makeQuantityFieldValue(arg.value.([]actionArgument))
-	case RawString:
+	case RawString, Regex:
 		return arg.value.(string)
 	default:
 		return attachmentValues(arg.value.(string))
@@ -704,8 +751,10 @@ func makeDictionary(value interface{}) (dictItems []WFDictionaryFieldValueItem)
 	if value == nil {
 		return []WFDictionaryFieldValueItem{}
 	}
-	for key, item := range value.(map[string]interface{}) {
-		dictItems = append(dictItems, makeDictionaryItem(key, item))
+	// Keys are sorted as the order of the keys in the code is not kept, so the same dictionary is always compiled the same way.
+	var dictionary = value.(map[string]interface{})
+	for _, key := range slices.Sorted(maps.Keys(dictionary)) {
+		dictItems = append(dictItems, makeDictionaryItem(key, dictionary[key]))
 	}
 	return
 }
@@ -724,7 +773,7 @@ func makeDictionaryItem(key string, value any) WFDictionaryFieldValueItem {
 		} else {
 			wfValue = WFTextTokenString{
 				WFSerializationType: "WFTextTokenString",
-				Value:               WFTextTokenStringValue{String: v},
+				Value:               WFTextTokenStringValue{String: unescapeBraces(v)},
 			}
 		}
 	case int, float64:
@@ -813,13 +862,20 @@ func makeOutputName(token *token) string {
 			return token.ident
 		}
 	}
+	var typeOfToken = string(token.valueType)
 	if token.valueType == Variable && token.value != nil {
-		var identifier = token.value.(varValue).value.(string)
-		if validReference(identifier) {
-			return identifier
+		// A modified variable is set to the output of the modification rather than the variable it is modified by.
+		if isValueModifier(token) {
+			if modified := variables[token.ident]; modified.valueType != "" {
+				typeOfToken = string(modified.valueType)
+			}
+		} else {
+			var identifier = token.value.(varValue).value.(string)
+			if validReference(identifier) {
+				return identifier
+			}
 		}
 	}
-	var typeOfToken = string(token.valueType)
 	if typeOfToken == "action" {
 		typeOfToken = token.value.(action).ident
 	}
@@ -829,6 +885,10 @@ func makeOutputName(token *token) string {
 	}
 
 	var customOutputName = fmt.Sprintf("%s%s", strings.ToTitle(string(typeOfToken[0])), typeOfToken[1:])
+	if _, isGlobal := globals[customOutputName]; isGlobal {
+		// An output named after a global would be referenced as the global, such as the output of currentDate().
+		customOutputName += " 1"
+	}
 
 	return checkDuplicateOutputName(customOutputName)
 }
@@ -841,7 +901,8 @@ func makeArrayVariable(t *token) {
 		if value == nil {
 			continue
 		}
-		var UUID = createUUID(&t.ident)
+		var itemSalt = fmt.Sprintf("%s[%d]", t.ident, len(shortcut.WFWorkflowActions))
+		var UUID = createUUID(&itemSalt)
 		var valueType tokenType
 		var itemIdent string
 		switch reflect.TypeOf(value).Kind() {
@@ -1030,6 +1091,9 @@ func conditionalParameter(param *WFConditionParam, arg actionArgument, inputType
 		routeConditionalValue(param, paramValue(actionArgument{valueType: Integer, value: boolNumber}, Integer), inputType)
 	case Integer, Float:
 		routeConditionalValue(param, paramValue(arg, arg.valueType), Integer)
+	case Date:
+		var date, _ = parseDateLiteral(arg.value.(string))
+		routeConditionalValue(param, date, Date)
 	default:
 		routeConditionalValue(param, paramValue(arg, arg.valueType), inputType)
 	}
@@ -1060,6 +1124,9 @@ func conditionalParameterLegacy(params map[string]any, arg actionArgument, input
 		routeConditionalValueLegacy(params, paramValue(actionArgument{valueType: Integer, value: boolNumber}, Integer), inputType)
 	case Integer, Float:
 		routeConditionalValueLegacy(params, paramValue(arg, arg.valueType), Integer)
+	case Date:
+		var date, _ = parseDateLiteral(arg.value.(string))
+		routeConditionalValueLegacy(params, date, Date)
 	default:
 		routeConditionalValueLegacy(params, paramValue(arg, arg.valueType), inputType)
 	}
@@ -1193,6 +1260,12 @@ func generateImportQuestions() (importQuestions []WFQuestion) {
 			DefaultValue: q.defaultValue,
 		})
 	}
+	slices.SortFunc(importQuestions, func(a, b WFQuestion) int {
+		if a.ActionIndex != b.ActionIndex {
+			return a.ActionIndex - b.ActionIndex
+		}
+		return strings.Compare(a.ParameterKey, b.ParameterKey)
+	})
 	return
 }
 
@@ -0,0 +1,300 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Signed Shortcuts
+
+Signed Shortcuts are Apple Encrypted Archives (AEA) using the profile that signs but does not encrypt its contents.
+The contents are segments of an LZFSE compressed Apple Archive, which contains the unsigned Shortcut.
+
+The signature and signing certificates are in the authentication data of the archive, they are reported
+but can not be verified offline.
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/electrikmilk/args-parser"
+	"howett.net/plist"
+)
+
+const aeaMagic = "AEA1"
+const aeaPrologueSize = 12
+const aeaSignedProfile = 0
+
+const (
+	aeaSaltSize          = 32
+	aeaMACSize           = 32
+	aeaRootHeaderSize    = 48
+	aeaSegmentHeaderSize = 40
+)
+
+// aeaSignatureSizes are the possible sizes of the padded signature, the root header is checked to find which is used.
+var aeaSignatureSizes = []int{160, 128}
+
+const (
+	aeaNoCompression    = '-'
+	aeaLZFSECompression = 'f'
+)
+
+var appleArchiveMagics = []string{"AA01", "YAA1"}
+
+const signedShortcutFile = "Shortcut.wflow"
+
+type aeaRootHeader struct {
+	OriginalSize       uint64
+	ArchiveSize        uint64
+	SegmentSize        uint32
+	SegmentsPerCluster uint32
+	Compression        uint8
+	Checksum           uint8
+	_                  [22]byte
+}
+
+// readSignedShortcut extracts the unsigned Shortcut from the archive of a signed Shortcut.
+func readSignedShortcut(b []byte) []byte {
+	var shortcutBytes, authData, readErr = signedShortcutContents(b)
+	if readErr != nil {
+		exit(fmt.Sprintf("import: %s", readErr))
+	}
+	reportSigningData(authData)
+
+	return shortcutBytes
+}
+
+// signedShortcutContents returns the unsigned Shortcut and the authentication data of the signed Shortcut b.
+func signedShortcutContents(b []byte) (shortcutBytes []byte, authData []byte, err error) {
+	if !looksLikeSignedShortcut(b) || len(b) < aeaPrologueSize {
+		return nil, nil, errors.New("File is not a Shortcut or is in an unknown format.")
+	}
+
+	var profile = binary.LittleEndian.Uint32(b[4:]) & 0xffffff
+	if profile != aeaSignedProfile {
+		return nil, nil, fmt.Errorf("Encrypted archives are not supported (profile %d), expected a signed Shortcut.", profile)
+	}
+
+	var authDataSize = int(binary.LittleEndian.Uint32(b[8:]))
+	if aeaPrologueSize+authDataSize > len(b) {
+		return nil, nil, errors.New("Signed Shortcut is incomplete.")
+	}
+	authData = b[aeaPrologueSize : aeaPrologueSize+authDataSize]
+
+	var archive, archiveErr = aeaContents(b, aeaPrologueSize+authDataSize)
+	if archiveErr != nil {
+		return nil, nil, fmt.Errorf("Unable to read signed Shortcut: %s", archiveErr)
+	}
+
+	shortcutBytes, err = appleArchiveFile(archive, signedShortcutFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to read signed Shortcut: %s", err)
+	}
+
+	return
+}
+
+// aeaContents returns the decompressed contents of the signed archive b, offset is the end of the authentication data.
+func aeaContents(b []byte, offset int) ([]byte, error) {
+	for _, signatureSize := range aeaSignatureSizes {
+		if contents, contentsErr := aeaSegments(b, offset+signatureSize); contentsErr == nil {
+			return contents, nil
+		}
+	}
+
+	// Fall back to the first compressed stream after the headers.
+	var streamIdx = lzfseStreamIndex(b[offset:])
+	if streamIdx == -1 {
+		return nil, errors.New("no compressed contents found")
+	}
+	var contents, _, decompressErr = lzfseDecompress(b[offset+streamIdx:])
+
+	return contents, decompressErr
+}
+
+// aeaSegments reads the root header at offset and decompresses the segments of each cluster.
+func aeaSegments(b []byte, offset int) ([]byte, error) {
+	var rootHeaderStart = offset + aeaSaltSize + aeaMACSize
+	if rootHeaderStart+aeaRootHeaderSize+aeaMACSize > len(b) {
+		return nil, errors.New("incomplete archive")
+	}
+
+	var rootHeader aeaRootHeader
+	var readErr = binary.Read(bytes.NewReader(b[rootHeaderStart:]), binary.LittleEndian, &rootHeader)
+	if readErr != nil {
+		return nil, readErr
+	}
+	var segmentsPerCluster = int(rootHeader.SegmentsPerCluster)
+	if rootHeader.OriginalSize == 0 || rootHeader.SegmentSize == 0 || segmentsPerCluster == 0 || segmentsPerCluster > len(b) {
+		return nil, errors.New("invalid root header")
+	}
+
+	var contents []byte
+	var clusterStart = rootHeaderStart + aeaRootHeaderSize + aeaMACSize
+	for uint64(len(contents)) < rootHeader.OriginalSize {
+		var segmentStart = clusterStart + segmentsPerCluster*(aeaSegmentHeaderSize+aeaMACSize) + aeaMACSize
+		if segmentStart > len(b) {
+			return nil, errors.New("incomplete cluster")
+		}
+
+		for segment := 0; segment < segmentsPerCluster && uint64(len(contents)) < rootHeader.OriginalSize; segment++ {
+			var segmentHeader = b[clusterStart+segment*aeaSegmentHeaderSize:]
+			var originalSize = int(binary.LittleEndian.Uint32(segmentHeader))
+			var compressedSize = int(binary.LittleEndian.Uint32(segmentHeader[4:]))
+			if originalSize == 0 || originalSize > int(rootHeader.SegmentSize) || segmentStart+compressedSize > len(b) {
+				return nil, errors.New("invalid segment header")
+			}
+
+			var segmentData = b[segmentStart : segmentStart+compressedSize]
+			segmentStart += compressedSize
+			if compressedSize == originalSize || rootHeader.Compression == aeaNoCompression {
+				contents = append(contents, segmentData...)
+				continue
+			}
+			if rootHeader.Compression != aeaLZFSECompression {
+				return nil, fmt.Errorf("unsupported compression '%c'", rootHeader.Compression)
+			}
+
+			var segmentContents, _, decompressErr = lzfseDecompress(segmentData)
+			if decompressErr != nil {
+				return nil, decompressErr
+			}
+			if len(segmentContents) != originalSize {
+				return nil, errors.New("invalid segment size")
+			}
+			contents = append(contents, segmentContents...)
+		}
+
+		clusterStart = segmentStart
+	}
+
+	return contents, nil
+}
+
+// appleArchiveFile returns the data of the file at path in an Apple Archive.
+func appleArchiveFile(archive []byte, path string) ([]byte, error) {
+	var pos int
+	for pos+6 <= len(archive) {
+		var magic = string(archive[pos : pos+4])
+		var headerSize = int(binary.LittleEndian.Uint16(archive[pos+4:]))
+		if !slices.Contains(appleArchiveMagics, magic) || headerSize < 6 || pos+headerSize > len(archive) {
+			return nil, errors.New("invalid archive entry")
+		}
+
+		var entryPath, blobSizes, dataBlob, fieldsErr = appleArchiveFields(archive[pos+6 : pos+headerSize])
+		if fieldsErr != nil {
+			return nil, fieldsErr
+		}
+		pos += headerSize
+
+		for i, blobSize := range blobSizes {
+			if pos+blobSize > len(archive) {
+				return nil, errors.New("incomplete archive entry")
+			}
+			if i == dataBlob && entryPath == path {
+				return archive[pos : pos+blobSize], nil
+			}
+			pos += blobSize
+		}
+	}
+
+	return nil, fmt.Errorf("archive does not contain %s", path)
+}
+
+var appleArchiveFieldSizes = map[byte]int{
+	'*': 0, '1': 1, '2': 2, '4': 4, '8': 8,
+	'S': 8, 'T': 12,
+	'F': 4, 'G': 20, 'H': 32, 'I': 48, 'J': 64,
+}
+
+var appleArchiveBlobSizes = map[byte]int{'A': 2, 'B': 4, 'C': 8}
+
+// appleArchiveFields returns the path, the sizes of the blobs following the header and which blob is the file data.
+func appleArchiveFields(fields []byte) (path string, blobSizes []int, dataBlob int, err error) {
+	dataBlob = -1
+	for pos := 0; pos < len(fields); {
+		if pos+4 > len(fields) {
+			return "", nil, 0, errors.New("invalid archive field")
+		}
+		var key = string(fields[pos : pos+3])
+		var subtype = fields[pos+3]
+		pos += 4
+
+		if size, ok := appleArchiveFieldSizes[subtype]; ok {
+			pos += size
+			continue
+		}
+		if size, ok := appleArchiveBlobSizes[subtype]; ok {
+			if pos+size > len(fields) {
+				return "", nil, 0, errors.New("invalid archive field")
+			}
+			var blobSize [8]byte
+			copy(blobSize[:], fields[pos:pos+size])
+			if key == "DAT" {
+				dataBlob = len(blobSizes)
+			}
+			blobSizes = append(blobSizes, int(binary.LittleEndian.Uint64(blobSize[:])))
+			pos += size
+			continue
+		}
+		if subtype != 'P' || pos+2 > len(fields) {
+			return "", nil, 0, fmt.Errorf("unknown archive field %s%c", key, subtype)
+		}
+
+		var length = int(binary.LittleEndian.Uint16(fields[pos:]))
+		if pos+2+length > len(fields) {
+			return "", nil, 0, errors.New("invalid archive field")
+		}
+		if key == "PAT" {
+			path = string(fields[pos+2 : pos+2+length])
+		}
+		pos += 2 + length
+	}
+
+	return
+}
+
+// reportSigningData prints who signed the Shortcut using the certificates in the authentication data.
+func reportSigningData(authData []byte) {
+	var signingData map[string]any
+	if _, plistErr := plist.Unmarshal(authData, &signingData); plistErr != nil {
+		fmt.Println(ansi("Warning:", orange, bold), "Signed Shortcut has no readable signing data.")
+		return
+	}
+
+	var signedBy = "unknown signer"
+	if chain, ok := signingData["SigningCertificateChain"].([]any); ok && len(chain) != 0 {
+		if der, isData := chain[0].([]byte); isData {
+			if certificate, certErr := x509.ParseCertificate(der); certErr == nil {
+				signedBy = fmt.Sprintf("%s, issued by %s, expires %s",
+					certificate.Subject.CommonName,
+					certificate.Issuer.CommonName,
+					certificate.NotAfter.Format("2006-01-02"),
+				)
+			}
+		}
+	}
+	var signingMode = "anyone"
+	if _, ok := signingData["AppleIDValidationRecord"]; ok {
+		signingMode = "people-who-know-me"
+	}
+
+	fmt.Println(ansi("Signed Shortcut:", bold), signedBy)
+	fmt.Println(ansi("Signing mode:", bold), signingMode)
+	fmt.Println(ansi("The signature was not verified.", dim))
+
+	if args.Using("debug") {
+		for key := range signingData {
+			fmt.Println("signing data:", key)
+		}
+	}
+	fmt.Print("\n")
+}
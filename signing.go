@@ -166,7 +166,7 @@ func requestSignedShortcut(service *SigningService) []byte {
 
 // looksLikeSignedShortcut performs quick checks to make sure response is a signed Shortcut.
 func looksLikeSignedShortcut(buffer []byte) bool {
-	if len(buffer) >= 4 && string(buffer[:4]) == "AEA1" {
+	if len(buffer) >= 4 && string(buffer[:4]) == aeaMagic {
 		return true
 	}
 	return false
@@ -0,0 +1,8 @@
+#!/bin/zsh
+# remove files older than a week from the target directory
+for file in "{@directory}"/*; do
+    if [[ -n $(find "$file" -mtime +7) ]]; then
+        rm -rf "${file}"
+    fi
+done
+echo "Cleaned up {@directory}"
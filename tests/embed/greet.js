@@ -0,0 +1,8 @@
+// greet the user by name
+function greet(name) {
+    /* braces in the script are literal */
+    const message = `Hello, ${name}!`;
+    return message.replace(/\s+/g, " "); // collapse whitespace
+}
+
+document.body.append(document.createTextNode(greet("{@name}")));
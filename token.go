@@ -18,6 +18,7 @@ var tokens []token
 /* Keywords */
 const (
 	Constant       tokenType = "const"
+	Let            tokenType = "let"
 	If             tokenType = "if"
 	Else           tokenType = "else"
 	EndClosure     tokenType = "endif"
@@ -30,10 +31,12 @@ const (
 	Question       tokenType = "#question"
 	Include        tokenType = "#include"
 	Import         tokenType = "#import"
+	Embed          tokenType = "#embed"
 	Reference      tokenType = "#ref"
 	Action         tokenType = "action"
 	ToggleSet      tokenType = "toggleSet"
 	Function       tokenType = "function"
+	Type           tokenType = "type "
 	Copy           tokenType = "copy"
 	Paste          tokenType = "paste"
 	Default        tokenType = "default"
@@ -71,6 +74,7 @@ const (
 	Arr         tokenType = "array"
 	Bool        tokenType = "bool"
 	Date        tokenType = "date"
+	Regex       tokenType = "regex"
 	True        tokenType = "true"
 	False       tokenType = "false"
 	Nil         tokenType = "nil"
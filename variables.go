@@ -26,6 +26,8 @@ type varValue struct {
 	constant     bool
 	repeatItem   bool
 	prompt       string
+	declaredAs   string
+	record       *recordType
 }
 
 var globals = map[string]varValue{
@@ -83,6 +85,102 @@ func availableIdentifier(identifier *string) {
 	}
 }
 
+// scopedVariableSeparator joins a block-scoped variable's name and a counter when it must be renamed to avoid shadowing.
+// It can't be written in an identifier, so a renamed variable can't be confused with a variable declared with that name.
+const scopedVariableSeparator = " #"
+
+// scopedVariableParameter is added to the set variable actions of a renamed block-scoped variable with the name it was declared with.
+// Shortcuts never adds this parameter, so only variables renamed by Cherri are decompiled as block-scoped variables.
+const scopedVariableParameter = "CherriDeclaredAs"
+
+// scopes maps a grouping depth to the block-scoped variables declared in it by their declared name.
+var scopes map[int]map[string]string
+
+// outOfScope contains block-scoped variables that were declared in a block that has since ended.
+var outOfScope map[string]bool
+
+// declareScopedVariable registers a block-scoped variable in the current scope,
+// renaming it if it would otherwise overwrite a variable declared outside the block.
+func declareScopedVariable(identifier *string) {
+	if _, found := scopes[groupingIdx][*identifier]; found {
+		parserError(fmt.Sprintf("Cannot redeclare '%s' in the same scope.", *identifier))
+	}
+	if _, found := variables[*identifier]; found && groupingIdx == 0 && !outOfScope[*identifier] {
+		parserError(fmt.Sprintf("Cannot redeclare '%s' in the same scope.", *identifier))
+	}
+	availableIdentifier(identifier)
+
+	var declaredAs = *identifier
+	if _, found := variables[*identifier]; found && !outOfScope[*identifier] {
+		var count = 2
+		for {
+			var renamed = fmt.Sprintf("%s%s%d", declaredAs, scopedVariableSeparator, count)
+			if _, taken := variables[renamed]; !taken {
+				*identifier = renamed
+				break
+			}
+			count++
+		}
+	}
+
+	if scopes[groupingIdx] == nil {
+		scopes[groupingIdx] = make(map[string]string)
+	}
+	scopes[groupingIdx][declaredAs] = *identifier
+	delete(outOfScope, *identifier)
+}
+
+// resolveScopedIdentifier replaces identifier with the name of the nearest block-scoped variable declared with that name.
+func resolveScopedIdentifier(identifier *string) bool {
+	for depth := groupingIdx; depth >= 0; depth-- {
+		if scoped, found := scopes[depth][*identifier]; found {
+			*identifier = scoped
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkScopedReference resolves a variable reference to its block-scoped variable if there is one,
+// and throws an error if the variable is only declared within a block that has ended.
+func checkScopedReference(identifier *string) {
+	if resolveScopedIdentifier(identifier) {
+		return
+	}
+	if outOfScope[*identifier] {
+		parserError(fmt.Sprintf("Variable '%s' is not in scope, it was declared using let within a block that has ended.", *identifier))
+	}
+}
+
+// exitScope ends the current scope, block-scoped variables declared in it can no longer be referenced.
+func exitScope() {
+	for declaredAs, identifier := range scopes[groupingIdx] {
+		var outerIdentifier = declaredAs
+		if identifier == declaredAs && !resolveOuterScopedIdentifier(&outerIdentifier) {
+			outOfScope[identifier] = true
+		}
+	}
+	delete(scopes, groupingIdx)
+}
+
+func resolveOuterScopedIdentifier(identifier *string) bool {
+	for depth := groupingIdx - 1; depth >= 0; depth-- {
+		if _, found := scopes[depth][*identifier]; found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// replaceInlineVariable replaces inline references to a variable in value with a reference to replacement.
+func replaceInlineVariable(value *string, identifier string, replacement string) {
+	for _, suffix := range []string{"}", "[", "."} {
+		*value = strings.ReplaceAll(*value, "{@"+identifier+suffix, "{@"+replacement+suffix)
+	}
+}
+
 func createUUIDReference(identifier string) string {
 	var actionUUID = createUUID(&identifier)
 	uuids[identifier] = actionUUID
@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) Cherri
+ */
+
+/*
+
+Build Variants
+
+Build variants compile several Shortcuts from the same source file, each with a name suffix,
+icon, mac definition, minimum version and flags for conditional compilation.
+
+Variants are defined in the Variants array of the info.plist of the current package or using
+--variant "Name:key=value,..." and each variant is compiled by a separate run of the compiler.
+
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/electrikmilk/args-parser"
+)
+
+// buildVariant overrides the definitions of a Shortcut to compile a variant of it.
+type buildVariant struct {
+	Name    string
+	Suffix  string            `plist:",omitempty"`
+	Color   string            `plist:",omitempty"`
+	Glyph   string            `plist:",omitempty"`
+	Mac     *bool             `plist:",omitempty"`
+	Version string            `plist:",omitempty"`
+	Defines map[string]string `plist:",omitempty"`
+}
+
+var buildVariants []buildVariant
+
+// currentVariant is the variant currently being compiled.
+var currentVariant *buildVariant
+
+// handleBuildVariants compiles each variant if variants are defined, returns true if the variants were compiled.
+func handleBuildVariants() bool {
+	loadBuildVariants()
+	if len(buildVariants) == 0 {
+		return false
+	}
+
+	if args.Using("build-variant") {
+		var name = args.Value("build-variant")
+		for i := range buildVariants {
+			if buildVariants[i].Name == name {
+				currentVariant = &buildVariants[i]
+				return false
+			}
+		}
+		exit(fmt.Sprintf("Undefined build variant '%s'", name))
+	}
+
+	compileVariants()
+
+	return true
+}
+
+func loadBuildVariants() {
+	buildVariants = []buildVariant{}
+	if pkg, found := loadPackage("info.plist"); found {
+		buildVariants = append(buildVariants, pkg.Variants...)
+	}
+	for i := 1; i < len(os.Args); i++ {
+		switch {
+		case os.Args[i] == "--variant" && i+1 < len(os.Args):
+			i++
+			buildVariants = append(buildVariants, parseVariant(os.Args[i]))
+		case strings.HasPrefix(os.Args[i], "--variant="):
+			buildVariants = append(buildVariants, parseVariant(strings.TrimPrefix(os.Args[i], "--variant=")))
+		}
+	}
+
+	var names []string
+	for _, variant := range buildVariants {
+		if slices.Contains(names, variant.Name) {
+			exit(fmt.Sprintf("Duplicate build variant '%s'", variant.Name))
+		}
+		names = append(names, variant.Name)
+
+		variant.check()
+	}
+}
+
+// parseVariant parses a build variant from the command line (e.g. Mac:mac=true,version=17,DEBUG=1).
+// Keys other than suffix, color, glyph, mac and version are defined as flags.
+func parseVariant(definition string) (variant buildVariant) {
+	var name, settings, _ = strings.Cut(definition, ":")
+	variant.Name = strings.TrimSpace(name)
+	variant.Defines = make(map[string]string)
+	if settings == "" {
+		return
+	}
+
+	for _, setting := range strings.Split(settings, ",") {
+		var key, value, hasValue = strings.Cut(setting, "=")
+		key = strings.TrimSpace(key)
+		if !hasValue {
+			value = "true"
+		}
+
+		switch key {
+		case "suffix":
+			variant.Suffix = value
+		case "color":
+			variant.Color = value
+		case "glyph":
+			variant.Glyph = value
+		case "mac":
+			var mac, parseErr = strconv.ParseBool(value)
+			if parseErr != nil {
+				exit(fmt.Sprintf("Invalid value '%s' for mac in build variant '%s'", value, variant.Name))
+			}
+			variant.Mac = &mac
+		case "version":
+			variant.Version = value
+		default:
+			variant.Defines[key] = value
+		}
+	}
+
+	return
+}
+
+func (variant *buildVariant) check() {
+	if variant.Name == "" {
+		exit("Build variants must have a name.")
+	}
+	if variant.Color != "" {
+		if _, found := colors[strings.ToLower(variant.Color)]; !found {
+			exit(fmt.Sprintf("Invalid icon color '%s' for build variant '%s'", variant.Color, variant.Name))
+		}
+	}
+	if variant.Glyph != "" {
+		if _, found := glyphs[variant.Glyph]; !found {
+			exit(fmt.Sprintf("Invalid icon glyph '%s' for build variant '%s'", variant.Glyph, variant.Name))
+		}
+	}
+	if variant.Version != "" {
+		if _, found := versions[variant.Version]; !found {
+			var list = makeKeyList("Available versions:", versions, variant.Version)
+			exit(fmt.Sprintf("Invalid minimum version '%s' for build variant '%s'\n\n%s", variant.Version, variant.Name, list))
+		}
+	}
+	for name := range variant.Defines {
+		if slices.Contains(reservedCompileFlags, name) {
+			exit(fmt.Sprintf("Cannot define flag '%s' in build variant '%s', it is reserved.", name, variant.Name))
+		}
+	}
+}
+
+// compileVariants runs the compiler for each build variant.
+func compileVariants() {
+	for _, variant := range buildVariants {
+		fmt.Println(ansi(fmt.Sprintf("Compiling variant %s...", variant.Name), bold))
+		if compileErr := runCompiler("--build-variant=" + variant.Name); compileErr != nil {
+			exit(fmt.Sprintf("Failed to compile variant '%s': %s", variant.Name, compileErr))
+		}
+	}
+}
+
+// runCompiler runs the compiler again with the current arguments and additional arguments.
+func runCompiler(additionalArgs ...string) error {
+	var executable, executableErr = os.Executable()
+	handle(executableErr)
+
+	var compiler = exec.Command(executable, append(os.Args[1:], additionalArgs...)...)
+	compiler.Stdout = os.Stdout
+	compiler.Stderr = os.Stderr
+
+	return compiler.Run()
+}
+
+// suffix returns the suffix added to the name of the Shortcut for the variant.
+func (variant *buildVariant) suffix() string {
+	if variant.Suffix != "" {
+		return variant.Suffix
+	}
+
+	return " " + variant.Name
+}
+
+// applyVariantDefinitions overrides the definitions of the Shortcut with those of the current variant.
+func applyVariantDefinitions() {
+	if currentVariant == nil {
+		return
+	}
+	if currentVariant.Color != "" {
+		iconColor = colors[strings.ToLower(currentVariant.Color)]
+	}
+	if currentVariant.Glyph != "" {
+		iconGlyph = int64(glyphs[currentVariant.Glyph])
+	}
+	if currentVariant.Mac != nil {
+		definitions["mac"] = *currentVariant.Mac
+	}
+	if currentVariant.Version != "" {
+		clientVersion = versions[currentVariant.Version]
+		iosVersion, _ = strconv.ParseFloat(currentVariant.Version, 32)
+	}
+}
+
+// applyVariantName adds the suffix of the current variant to the name of the Shortcut.
+func applyVariantName() {
+	if currentVariant == nil {
+		return
+	}
+
+	workflowName += currentVariant.suffix()
+}